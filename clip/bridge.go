@@ -0,0 +1,375 @@
+// Package clip implements a bridge using version 2 of the hue api, also known as CLIP v2.
+package clip
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"github.com/pkg/errors"
+	"github.com/tkw1536/huelio/engine"
+)
+
+// Bridge is a hue bridge that is accessed using the v2 api.
+// It implements engine.WatchingBridge.
+//
+// Resources of the bridge are cached while the event stream is being watched, see Watch.
+// Otherwise every request fetches all resources from the bridge.
+type Bridge struct {
+	host string // base url of the bridge
+	key  string // application key
+
+	// Client is used to make requests to the bridge.
+	// It only accepts the pinned certificate of the bridge, see New.
+	Client *http.Client
+
+	// StreamClient is used to connect to the event stream.
+	// It must not time out requests, and also only accepts the pinned certificate.
+	StreamClient *http.Client
+
+	l         sync.Mutex
+	resources resources // cached resources, nil when not synced
+
+	pl  sync.Mutex
+	pin []byte // sha256 hash of the pinned certificate, nil until pinned
+}
+
+// ResourcePath and EventStreamPath are the paths of the v2 api
+const (
+	ResourcePath    = "/clip/v2/resource"
+	EventStreamPath = "/eventstream/clip/v2"
+)
+
+// KeyHeader is the header holding the application key
+const KeyHeader = "hue-application-key"
+
+// New creates a new bridge at the given host, using the given application key.
+//
+// The host is always accessed using https, any scheme it has is ignored.
+// This allows using the hostnames of the v1 api, which are typically prefixed with "http://".
+//
+// Hue bridges use self-signed certificates, which can not be verified using the system roots.
+// Instead, the certificate of the bridge is pinned:
+// Unless a certificate is pinned using Pin, the certificate presented upon the first connection is trusted.
+// All later connections must present the same certificate.
+func New(host, key string) *Bridge {
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	host = "https://" + host
+
+	b := &Bridge{
+		host: strings.TrimSuffix(host, "/"),
+		key:  key,
+	}
+	pinned := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true, // the certificate is verified by verifyConnection instead
+			VerifyConnection:   b.verifyConnection,
+		},
+	}
+	b.Client = &http.Client{Transport: pinned, Timeout: 10 * time.Second}
+	b.StreamClient = &http.Client{Transport: pinned}
+	return b
+}
+
+var ErrBridgeCertificate = errors.New("Bridge: certificate does not match pinned certificate")
+
+// Pin pins the certificate with the given fingerprint, as returned by Fingerprint.
+// Connections to the bridge fail unless it presents this certificate.
+func (b *Bridge) Pin(fingerprint string) error {
+	pin, err := hex.DecodeString(fingerprint)
+	if err != nil || len(pin) != sha256.Size {
+		return errors.Errorf("Bridge: invalid fingerprint %q", fingerprint)
+	}
+
+	b.pl.Lock()
+	defer b.pl.Unlock()
+
+	b.pin = pin
+	return nil
+}
+
+// Fingerprint returns the fingerprint of the pinned certificate, that is its hex-encoded SHA-256 hash.
+// When no certificate has been pinned yet, returns the empty string.
+func (b *Bridge) Fingerprint() string {
+	b.pl.Lock()
+	defer b.pl.Unlock()
+
+	return hex.EncodeToString(b.pin)
+}
+
+// verifyConnection checks that the bridge presents the pinned certificate, pinning it if needed
+func (b *Bridge) verifyConnection(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return ErrBridgeCertificate
+	}
+	sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+
+	b.pl.Lock()
+	defer b.pl.Unlock()
+
+	if b.pin == nil {
+		b.pin = sum[:]
+		return nil
+	}
+	if !bytes.Equal(b.pin, sum[:]) {
+		return ErrBridgeCertificate
+	}
+	return nil
+}
+
+var ErrBridgeNotFound = errors.New("Bridge: resource not found")
+var ErrBridgeRequest = errors.New("Bridge: request failed")
+
+func (b *Bridge) Host() string {
+	return b.host
+}
+
+// request makes a request to the given path of the bridge, and returns the data of the response.
+func (b *Bridge) request(ctx context.Context, method, path string, body interface{}) (json.RawMessage, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.host+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(KeyHeader, b.key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := b.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var result response
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, errors.Wrapf(ErrBridgeRequest, "%s %s: %s", method, path, res.Status)
+	}
+	if len(result.Errors) > 0 {
+		return nil, errors.Wrapf(ErrBridgeRequest, "%s %s: %s", method, path, result.Errors[0].Description)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(ErrBridgeRequest, "%s %s: %s", method, path, res.Status)
+	}
+	return result.Data, nil
+}
+
+// GetResources fetches all resources from the bridge
+func (b *Bridge) GetResources(ctx context.Context) ([]Resource, error) {
+	data, err := b.request(ctx, http.MethodGet, ResourcePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var all []Resource
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// update sends an update to the resource with the given type and id
+func (b *Bridge) update(ctx context.Context, rtype, id string, update Update) error {
+	_, err := b.request(ctx, http.MethodPut, fmt.Sprintf("%s/%s/%s", ResourcePath, rtype, id), update)
+	return err
+}
+
+// view calls f with the current resources of the bridge.
+// When the resources are not cached, they are fetched first.
+//
+// f must not keep references to the resources.
+func (b *Bridge) view(ctx context.Context, f func(rs resources) error) error {
+	b.l.Lock()
+	if b.resources != nil {
+		defer b.l.Unlock()
+		return f(b.resources)
+	}
+	b.l.Unlock()
+
+	all, err := b.GetResources(ctx)
+	if err != nil {
+		return err
+	}
+	return f(newResources(all))
+}
+
+func (b *Bridge) GetGroups(ctx context.Context) (groups []huego.Group, err error) {
+	err = b.view(ctx, func(rs resources) error {
+		groups = rs.groups()
+		return nil
+	})
+	return
+}
+
+func (b *Bridge) GetGroup(ctx context.Context, id int) (group *huego.Group, err error) {
+	err = b.view(ctx, func(rs resources) error {
+		g, ok := rs.v1Group(id)
+		if !ok {
+			return errors.Wrapf(ErrBridgeNotFound, "group %d", id)
+		}
+		group = &g
+		return nil
+	})
+	return
+}
+
+func (b *Bridge) GetLights(ctx context.Context) (lights []huego.Light, err error) {
+	err = b.view(ctx, func(rs resources) error {
+		lights = rs.lights()
+		return nil
+	})
+	return
+}
+
+func (b *Bridge) GetLight(ctx context.Context, id int) (light *huego.Light, err error) {
+	err = b.view(ctx, func(rs resources) error {
+		r, ok := rs.byV1(typeLight, "lights", id)
+		if !ok {
+			return errors.Wrapf(ErrBridgeNotFound, "light %d", id)
+		}
+		l := rs.light(r)
+		light = &l
+		return nil
+	})
+	return
+}
+
+func (b *Bridge) GetScenes(ctx context.Context) (scenes []huego.Scene, err error) {
+	err = b.view(ctx, func(rs resources) error {
+		scenes = rs.scenes()
+		return nil
+	})
+	return
+}
+
+func (b *Bridge) GetScene(ctx context.Context, id string) (scene *huego.Scene, err error) {
+	err = b.view(ctx, func(rs resources) error {
+		r, ok := rs.scene(id)
+		if !ok {
+			return errors.Wrapf(ErrBridgeNotFound, "scene %q", id)
+		}
+		s := rs.v1Scene(r)
+		scene = &s
+		return nil
+	})
+	return
+}
+
+func (b *Bridge) GetSensors(ctx context.Context) (sensors []huego.Sensor, err error) {
+	err = b.view(ctx, func(rs resources) error {
+		sensors = rs.sensors()
+		return nil
+	})
+	return
+}
+
+func (b *Bridge) SetGroupState(ctx context.Context, id int, state huego.State) error {
+	if state.Scene != "" {
+		return b.RecallScene(ctx, state.Scene, id, engine.Transition(state.TransitionTime))
+	}
+
+	var grouped string
+	var lights []string
+	err := b.view(ctx, func(rs resources) error {
+		var ok bool
+		grouped, lights, ok = rs.groupTarget(id)
+		if !ok {
+			return errors.Wrapf(ErrBridgeNotFound, "group %d", id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	update := newUpdate(state)
+	if grouped != "" {
+		return b.update(ctx, typeGroupedLight, grouped, update)
+	}
+
+	// groups without a grouped light (such as entertainment areas) are set light by light
+	for _, light := range lights {
+		if err := b.update(ctx, typeLight, light, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bridge) SetLightState(ctx context.Context, id int, state huego.State) error {
+	var light string
+	err := b.view(ctx, func(rs resources) error {
+		r, ok := rs.byV1(typeLight, "lights", id)
+		if !ok {
+			return errors.Wrapf(ErrBridgeNotFound, "light %d", id)
+		}
+		light = r.ID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return b.update(ctx, typeLight, light, newUpdate(state))
+}
+
+// RecallScene activates the scene with the given id.
+// The id may be the id of the scene in the v1 api, or in the v2 api.
+// Scenes in the v2 api belong to a single group, so group is ignored.
+func (b *Bridge) RecallScene(ctx context.Context, id string, group int, transition engine.Transition) error {
+	var scene string
+	err := b.view(ctx, func(rs resources) error {
+		r, ok := rs.scene(id)
+		if !ok {
+			return errors.Wrapf(ErrBridgeNotFound, "scene %q", id)
+		}
+		scene = r.ID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return b.update(ctx, typeScene, scene, Update{
+		Recall: &Recall{Action: "active", Duration: int(transition) * 100},
+	})
+}
+
+// Identify returns the id and name of the bridge
+func (b *Bridge) Identify(ctx context.Context) (id, name string, err error) {
+	err = b.view(ctx, func(rs resources) error {
+		for _, r := range rs {
+			if r.Type != typeBridge {
+				continue
+			}
+			id = strings.ToUpper(r.BridgeID)
+			if r.Owner != nil {
+				if device, ok := rs[r.Owner.RID]; ok && device.Metadata != nil {
+					name = device.Metadata.Name
+				}
+			}
+			return nil
+		}
+		return errors.Wrap(ErrBridgeNotFound, "bridge")
+	})
+	return
+}
@@ -0,0 +1,73 @@
+package clip_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tkw1536/huelio/clip"
+	"github.com/tkw1536/huelio/fakebridge"
+)
+
+func TestBridge_Pin(t *testing.T) {
+	server, ts := newTestServer(t)
+	sum := sha256.Sum256(ts.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	// other serves the same bridge using a different certificate
+	cert, err := fakebridge.SelfSignedCertificate("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := httptest.NewUnstartedServer(server)
+	other.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	other.StartTLS()
+	t.Cleanup(other.Close)
+
+	t.Run("first connection", func(t *testing.T) {
+		bridge := clip.New(ts.URL, testUser)
+		if got := bridge.Fingerprint(); got != "" {
+			t.Errorf("Fingerprint() = %q before connecting, want empty", got)
+		}
+		if _, _, err := bridge.Identify(context.Background()); err != nil {
+			t.Fatalf("Identify() err = %v", err)
+		}
+		if got := bridge.Fingerprint(); got != fingerprint {
+			t.Errorf("Fingerprint() = %q, want %q", got, fingerprint)
+		}
+	})
+
+	t.Run("pinned certificate", func(t *testing.T) {
+		bridge := clip.New(ts.URL, testUser)
+		if err := bridge.Pin(fingerprint); err != nil {
+			t.Fatalf("Pin() err = %v", err)
+		}
+		if _, _, err := bridge.Identify(context.Background()); err != nil {
+			t.Errorf("Identify() err = %v", err)
+		}
+	})
+
+	t.Run("other certificate", func(t *testing.T) {
+		bridge := clip.New(other.URL, testUser)
+		if err := bridge.Pin(fingerprint); err != nil {
+			t.Fatalf("Pin() err = %v", err)
+		}
+		if _, _, err := bridge.Identify(context.Background()); !errors.Is(err, clip.ErrBridgeCertificate) {
+			t.Errorf("Identify() err = %v, want %v", err, clip.ErrBridgeCertificate)
+		}
+		if got := bridge.Fingerprint(); got != fingerprint {
+			t.Errorf("Fingerprint() = %q, want pinned %q", got, fingerprint)
+		}
+	})
+
+	t.Run("invalid fingerprint", func(t *testing.T) {
+		bridge := clip.New(ts.URL, testUser)
+		if err := bridge.Pin("abc"); err == nil {
+			t.Error("Pin() err = nil, want error")
+		}
+	})
+}
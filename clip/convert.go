@@ -0,0 +1,518 @@
+package clip
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amimof/huego"
+	"github.com/tkw1536/huelio/engine"
+)
+
+// types of resources used by huelio
+const (
+	typeBridge          = "bridge"
+	typeBridgeHome      = "bridge_home"
+	typeDevice          = "device"
+	typeDevicePower     = "device_power"
+	typeEntertainment   = "entertainment_configuration"
+	typeGroupedLight    = "grouped_light"
+	typeLight           = "light"
+	typeLightLevel      = "light_level"
+	typeMotion          = "motion"
+	typeRoom            = "room"
+	typeScene           = "scene"
+	typeTemperature     = "temperature"
+	typeZigbeeConnected = "zigbee_connectivity"
+	typeZone            = "zone"
+)
+
+// effects of the v2 api
+const (
+	effectNone  = "no_effect"
+	effectPrism = "prism" // the closest to a colorloop
+)
+
+// resources holds resources of the bridge by their id.
+// It converts them into their representation in the v1 api, which is used by the engine.
+type resources map[string]Resource
+
+func newResources(all []Resource) resources {
+	rs := make(resources, len(all))
+	for _, r := range all {
+		rs[r.ID] = r
+	}
+	return rs
+}
+
+// v1ID returns the numerical id of a resource in the v1 api, e.g. 3 for "/lights/3"
+func v1ID(r Resource, kind string) (int, bool) {
+	prefix := "/" + kind + "/"
+	if !strings.HasPrefix(r.IDv1, prefix) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.IDv1, prefix))
+	return id, err == nil
+}
+
+// byType returns all resources of the given type, ordered by id
+func (rs resources) byType(rtype string) []Resource {
+	var result []Resource
+	for _, r := range rs {
+		if r.Type == rtype {
+			result = append(result, r)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// byV1 returns the resource of the given type with the given v1 id
+func (rs resources) byV1(rtype, kind string, id int) (Resource, bool) {
+	for _, r := range rs {
+		if rid, ok := v1ID(r, kind); r.Type == rtype && ok && rid == id {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+// service returns the service of the given type belonging to the same device as r
+func (rs resources) service(r Resource, rtype string) (Resource, bool) {
+	if r.Owner == nil {
+		return Resource{}, false
+	}
+	device, ok := rs[r.Owner.RID]
+	if !ok {
+		return Resource{}, false
+	}
+	for _, ref := range device.Services {
+		if ref.RType == rtype {
+			service, ok := rs[ref.RID]
+			return service, ok
+		}
+	}
+	return Resource{}, false
+}
+
+// reachable returns if the device of r is connected
+func (rs resources) reachable(r Resource) bool {
+	connectivity, ok := rs.service(r, typeZigbeeConnected)
+	if !ok {
+		return true
+	}
+	var status string
+	_ = json.Unmarshal(connectivity.Status, &status)
+	return status == "" || status == "connected"
+}
+
+//
+// LIGHTS
+//
+
+func (rs resources) lights() []huego.Light {
+	var lights []huego.Light
+	for _, r := range rs.byType(typeLight) {
+		if _, ok := v1ID(r, "lights"); ok {
+			lights = append(lights, rs.light(r))
+		}
+	}
+	sort.Slice(lights, func(i, j int) bool {
+		return lights[i].ID < lights[j].ID
+	})
+	return lights
+}
+
+func (rs resources) light(r Resource) huego.Light {
+	id, _ := v1ID(r, "lights")
+	light := huego.Light{
+		ID:    id,
+		Name:  name(r),
+		Type:  lightType(r),
+		State: rs.state(r),
+	}
+	if r.Owner != nil {
+		light.UniqueID = r.Owner.RID
+		if device, ok := rs[r.Owner.RID]; ok && device.ProductData != nil {
+			light.ModelID = device.ProductData.ModelID
+		}
+	}
+	return light
+}
+
+// lightType returns the type of light in the v1 api
+func lightType(r Resource) string {
+	switch {
+	case r.Color != nil && r.ColorTemperature != nil:
+		return "Extended color light"
+	case r.Color != nil:
+		return "Color light"
+	case r.ColorTemperature != nil:
+		return "Color temperature light"
+	default:
+		return "Dimmable light"
+	}
+}
+
+// state returns the state of a light, or of a scene action
+func (rs resources) state(r Resource) *huego.State {
+	state := v1State(Update{
+		On:               r.On,
+		Dimming:          r.Dimming,
+		ColorTemperature: r.ColorTemperature,
+		Color:            r.Color,
+		Effects:          r.Effects,
+	})
+	state.Alert = "none"
+	state.Reachable = rs.reachable(r)
+	return &state
+}
+
+// v1State turns the given update into a state of the v1 api
+func v1State(update Update) huego.State {
+	var state huego.State
+	if update.On != nil {
+		state.On = update.On.On
+	}
+	if update.Dimming != nil {
+		state.Bri = uint8(math.Max(1, math.Round(update.Dimming.Brightness*2.54)))
+	}
+	if update.Color != nil {
+		state.Xy = []float32{float32(update.Color.XY.X), float32(update.Color.XY.Y)}
+		state.ColorMode = "xy"
+	}
+	if ct := update.ColorTemperature; ct != nil && ct.Mirek != nil {
+		state.Ct = *ct.Mirek
+		if ct.MirekValid || update.Color == nil {
+			state.ColorMode = "ct"
+		}
+	}
+	if update.Effects != nil {
+		effect := update.Effects.Status
+		if effect == "" {
+			effect = update.Effects.Effect
+		}
+		if effect == effectPrism {
+			state.Effect = "colorloop"
+		} else {
+			state.Effect = "none"
+		}
+	}
+	return state
+}
+
+// newUpdate turns a state of the v1 api into an update
+func newUpdate(state huego.State) Update {
+	update := Update{On: &On{On: state.On}}
+	if state.Bri != 0 {
+		update.Dimming = &Dimming{Brightness: math.Round(float64(state.Bri)/2.54*100) / 100}
+	}
+	if len(state.Xy) == 2 {
+		update.Color = &Color{XY: XY{X: float64(state.Xy[0]), Y: float64(state.Xy[1])}}
+	}
+	if state.Ct != 0 {
+		ct := state.Ct
+		update.ColorTemperature = &ColorTemperature{Mirek: &ct}
+	}
+	switch state.Effect {
+	case "colorloop":
+		update.Effects = &Effects{Effect: effectPrism}
+	case "none":
+		update.Effects = &Effects{Effect: effectNone}
+	}
+	switch state.Alert {
+	case "select", "lselect":
+		update.Alert = &Alert{Action: "breathe"}
+	}
+	if state.TransitionTime != 0 {
+		update.Dynamics = &Dynamics{Duration: int(state.TransitionTime) * 100}
+	}
+	return update
+}
+
+//
+// GROUPS
+//
+
+func (rs resources) groups() []huego.Group {
+	var groups []huego.Group
+	for _, rtype := range []string{typeRoom, typeZone, typeEntertainment} {
+		for _, r := range rs.byType(rtype) {
+			if id, ok := v1ID(r, "groups"); ok {
+				groups = append(groups, rs.group(id, r))
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	return groups
+}
+
+// v1Group returns the group with the given v1 id.
+// Like in the v1 api, the group of all lights is not part of groups, but can be accessed by its id.
+func (rs resources) v1Group(id int) (huego.Group, bool) {
+	r, ok := rs.groupResource(id)
+	if !ok {
+		return huego.Group{}, false
+	}
+	return rs.group(id, r), true
+}
+
+// groupResource returns the room, zone, entertainment area or home with the given v1 id
+func (rs resources) groupResource(id int) (Resource, bool) {
+	if id == engine.AllLightsID {
+		homes := rs.byType(typeBridgeHome)
+		if len(homes) == 0 {
+			return Resource{}, false
+		}
+		return homes[0], true
+	}
+	for _, rtype := range []string{typeRoom, typeZone, typeEntertainment} {
+		if r, ok := rs.byV1(rtype, "groups", id); ok {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+func (rs resources) group(id int, r Resource) huego.Group {
+	group := huego.Group{
+		ID:   id,
+		Name: name(r),
+	}
+	if group.Name == "" {
+		group.Name = fmt.Sprintf("Group %d", id)
+	}
+	switch r.Type {
+	case typeRoom:
+		group.Type = "Room"
+	case typeZone:
+		group.Type = "Zone"
+	case typeEntertainment:
+		group.Type = "Entertainment"
+	default:
+		group.Type = "LightGroup"
+	}
+	if r.Metadata != nil && r.Metadata.Archetype != "" {
+		class := strings.ReplaceAll(r.Metadata.Archetype, "_", " ")
+		group.Class = strings.ToUpper(class[:1]) + class[1:]
+	}
+
+	lights := rs.groupLights(r)
+	state := &huego.GroupState{AllOn: len(lights) > 0}
+	for _, light := range lights {
+		lID, _ := v1ID(light, "lights")
+		group.Lights = append(group.Lights, strconv.Itoa(lID))
+
+		on := light.On != nil && light.On.On
+		state.AnyOn = state.AnyOn || on
+		state.AllOn = state.AllOn && on
+	}
+	group.GroupState = state
+
+	// the last action of a group is approximated by the state of its first light
+	if len(lights) > 0 {
+		group.State = rs.state(lights[0])
+	}
+	return group
+}
+
+// groupLights returns the lights in the given room, zone, entertainment area or home, ordered by their v1 id
+func (rs resources) groupLights(r Resource) []Resource {
+	var lights []Resource
+	add := func(ref Reference) {
+		light, ok := rs[ref.RID]
+		if _, hasID := v1ID(light, "lights"); ok && hasID && light.Type == typeLight {
+			lights = append(lights, light)
+		}
+	}
+
+	switch r.Type {
+	case typeBridgeHome:
+		for _, light := range rs.byType(typeLight) {
+			add(Reference{RID: light.ID, RType: typeLight})
+		}
+	case typeEntertainment:
+		for _, ref := range r.LightServices {
+			add(ref)
+		}
+	default:
+		for _, ref := range r.Children {
+			switch ref.RType {
+			case typeLight:
+				add(ref)
+			case typeDevice:
+				for _, service := range rs[ref.RID].Services {
+					if service.RType == typeLight {
+						add(service)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Slice(lights, func(i, j int) bool {
+		a, _ := v1ID(lights[i], "lights")
+		b, _ := v1ID(lights[j], "lights")
+		return a < b
+	})
+	return lights
+}
+
+// groupTarget returns the grouped light to update for the group with the given v1 id.
+// When the group has no grouped light, returns the ids of its lights instead.
+func (rs resources) groupTarget(id int) (grouped string, lights []string, ok bool) {
+	group, ok := rs.groupResource(id)
+	if !ok {
+		return "", nil, false
+	}
+
+	for _, service := range group.Services {
+		if service.RType == typeGroupedLight {
+			return service.RID, nil, true
+		}
+	}
+	for _, light := range rs.groupLights(group) {
+		lights = append(lights, light.ID)
+	}
+	return "", lights, true
+}
+
+//
+// SCENES
+//
+
+// sceneID returns the id of a scene used by the engine.
+// This is the id in the v1 api, or the v2 id if the scene has none.
+func sceneID(r Resource) string {
+	if strings.HasPrefix(r.IDv1, "/scenes/") {
+		return strings.TrimPrefix(r.IDv1, "/scenes/")
+	}
+	return r.ID
+}
+
+// scene returns the scene with the given v1 or v2 id
+func (rs resources) scene(id string) (Resource, bool) {
+	for _, r := range rs {
+		if r.Type == typeScene && (r.ID == id || sceneID(r) == id) {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+func (rs resources) scenes() []huego.Scene {
+	var scenes []huego.Scene
+	for _, r := range rs.byType(typeScene) {
+		scenes = append(scenes, rs.v1Scene(r))
+	}
+	sort.Slice(scenes, func(i, j int) bool {
+		return scenes[i].ID < scenes[j].ID
+	})
+	return scenes
+}
+
+func (rs resources) v1Scene(r Resource) huego.Scene {
+	scene := huego.Scene{
+		ID:          sceneID(r),
+		Name:        name(r),
+		Type:        "GroupScene",
+		LightStates: make(map[int]huego.State, len(r.Actions)),
+	}
+	if r.Group != nil {
+		if group, ok := rs[r.Group.RID]; ok {
+			if id, ok := v1ID(group, "groups"); ok {
+				scene.Group = strconv.Itoa(id)
+			}
+		}
+	}
+	for _, action := range r.Actions {
+		id, ok := v1ID(rs[action.Target.RID], "lights")
+		if !ok {
+			continue
+		}
+		scene.Lights = append(scene.Lights, strconv.Itoa(id))
+		scene.LightStates[id] = v1State(action.Action)
+	}
+	return scene
+}
+
+//
+// SENSORS
+//
+
+// sensorTypes maps types of resources to the type of sensor in the v1 api
+var sensorTypes = map[string]string{
+	typeMotion:      "ZLLPresence",
+	typeTemperature: "ZLLTemperature",
+	typeLightLevel:  "ZLLLightLevel",
+}
+
+func (rs resources) sensors() []huego.Sensor {
+	var sensors []huego.Sensor
+	for rtype := range sensorTypes {
+		for _, r := range rs.byType(rtype) {
+			if _, ok := v1ID(r, "sensors"); ok {
+				sensors = append(sensors, rs.sensor(r))
+			}
+		}
+	}
+	sort.Slice(sensors, func(i, j int) bool {
+		return sensors[i].ID < sensors[j].ID
+	})
+	return sensors
+}
+
+func (rs resources) sensor(r Resource) huego.Sensor {
+	id, _ := v1ID(r, "sensors")
+	sensor := huego.Sensor{
+		ID:     id,
+		Type:   sensorTypes[r.Type],
+		Name:   name(r),
+		State:  make(map[string]interface{}),
+		Config: make(map[string]interface{}),
+	}
+
+	// the engine groups sensors of the same device by their unique id
+	if r.Owner != nil {
+		sensor.UniqueID = strings.ReplaceAll(r.Owner.RID, "-", "") + "-" + r.Type
+		if device, ok := rs[r.Owner.RID]; ok {
+			sensor.Name = name(device)
+			if device.ProductData != nil {
+				sensor.ModelID = device.ProductData.ModelID
+			}
+		}
+	}
+
+	switch {
+	case r.Motion != nil:
+		sensor.State["presence"] = r.Motion.Motion
+	case r.Temperature != nil:
+		sensor.State["temperature"] = math.Round(r.Temperature.Temperature * 100)
+	case r.Light != nil:
+		sensor.State["lightlevel"] = float64(r.Light.LightLevel)
+	}
+
+	if r.Enabled != nil {
+		sensor.Config["on"] = *r.Enabled
+	}
+	sensor.Config["reachable"] = rs.reachable(r)
+	if power, ok := rs.service(r, typeDevicePower); ok && power.PowerState != nil {
+		sensor.Config["battery"] = float64(power.PowerState.BatteryLevel)
+	}
+	return sensor
+}
+
+// name returns the name of a resource
+func name(r Resource) string {
+	if r.Metadata == nil {
+		return ""
+	}
+	return r.Metadata.Name
+}
@@ -0,0 +1,177 @@
+package clip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// backoff when reconnecting to the event stream
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Watch keeps the cached resources of this bridge up to date using the event stream of the bridge.
+// changed is called whenever the resources of the bridge have changed.
+//
+// When the connection to the event stream is lost, Watch reconnects automatically.
+// While it is not connected, resources are fetched from the bridge for every request.
+//
+// Watch blocks until ctx is closed.
+func (b *Bridge) Watch(ctx context.Context, changed func()) {
+	logger := zerolog.Ctx(ctx).With().Str("component", "clip.Bridge").Str("host", b.host).Logger()
+
+	backoff := minBackoff
+	for {
+		connected, err := b.stream(ctx, logger, changed)
+		b.setResources(nil)
+
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = minBackoff
+		}
+		logger.Warn().Err(err).Dur("backoff", backoff).Msg("event stream disconnected")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+var ErrBridgeStream = errors.New("Bridge: event stream closed")
+
+// stream connects to the event stream and applies events to the cached resources until the stream is closed.
+// connected indicates if the connection was established.
+func (b *Bridge) stream(ctx context.Context, logger zerolog.Logger, changed func()) (connected bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.host+EventStreamPath, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(KeyHeader, b.key)
+	req.Header.Set("Accept", "text/event-stream")
+
+	res, err := b.StreamClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return false, errors.Wrap(ErrBridgeRequest, res.Status)
+	}
+
+	// fetch all resources only once connected, so that no event is missed
+	all, err := b.GetResources(ctx)
+	if err != nil {
+		return false, err
+	}
+	b.setResources(newResources(all))
+	changed()
+
+	logger.Info().Msg("event stream connected")
+
+	var data bytes.Buffer
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		// an empty line ends a message
+		if len(line) == 0 {
+			if data.Len() > 0 && b.apply(data.Bytes()) {
+				changed()
+			}
+			data.Reset()
+			continue
+		}
+
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue // comments, ids and event types are not used
+		}
+		value := bytes.TrimPrefix(line, []byte("data:"))
+		if data.Len() > 0 {
+			data.WriteByte('\n')
+		}
+		data.Write(bytes.TrimPrefix(value, []byte(" ")))
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, ErrBridgeStream
+}
+
+// setResources sets the cached resources
+func (b *Bridge) setResources(rs resources) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	b.resources = rs
+}
+
+// apply applies the events in the given message to the cached resources.
+// It returns if any resource was changed.
+func (b *Bridge) apply(message []byte) (changed bool) {
+	var events []Event
+	if err := json.Unmarshal(message, &events); err != nil {
+		return false
+	}
+
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if b.resources == nil {
+		return false
+	}
+
+	for _, event := range events {
+		for _, data := range event.Data {
+			var header struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(data, &header); err != nil || header.ID == "" {
+				continue
+			}
+
+			switch event.Type {
+			case "add":
+				var r Resource
+				if err := json.Unmarshal(data, &r); err != nil {
+					continue
+				}
+				b.resources[r.ID] = r
+			case "update":
+				r, ok := b.resources[header.ID]
+				if !ok {
+					continue
+				}
+				// updates only contain changed fields, so they are merged into the existing resource.
+				if err := json.Unmarshal(data, &r); err != nil {
+					continue
+				}
+				b.resources[r.ID] = r
+			case "delete":
+				delete(b.resources, header.ID)
+			default:
+				continue
+			}
+			changed = true
+		}
+	}
+	return
+}
@@ -0,0 +1,209 @@
+package clip_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+	"github.com/tkw1536/huelio/clip"
+	"github.com/tkw1536/huelio/fakebridge"
+)
+
+// testUser is an application key that is authorized on servers returned by newTestServer
+const testUser = "testuser"
+
+// newTestServer starts a new fake bridge holding the default fixture, serving the v2 api
+func newTestServer(t *testing.T) (*fakebridge.Server, *httptest.Server) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	server := fakebridge.NewServer(fakebridge.DefaultFixture(), ctx)
+	server.AddUser(testUser)
+
+	ts := httptest.NewTLSServer(server)
+	t.Cleanup(ts.Close)
+
+	return server, ts
+}
+
+// watch starts watching bridge, and waits until it is connected.
+// The returned channel receives a value whenever the resources have changed.
+func watch(t *testing.T, bridge *clip.Bridge) <-chan struct{} {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	changed := make(chan struct{}, 1)
+	go bridge.Watch(ctx, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	waitChanged(t, changed)
+	return changed
+}
+
+// waitChanged waits until changed receives a value
+func waitChanged(t *testing.T, changed <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resources did not change")
+	}
+}
+
+// lightID returns the id of the v2 resource of the light with the given v1 path
+func lightID(t *testing.T, bridge *clip.Bridge, v1 string) string {
+	t.Helper()
+
+	all, err := bridge.GetResources(context.Background())
+	if err != nil {
+		t.Fatalf("GetResources() err = %v", err)
+	}
+	for _, r := range all {
+		if r.Type == "light" && r.IDv1 == v1 {
+			return r.ID
+		}
+	}
+	t.Fatalf("GetResources() contains no light %s", v1)
+	return ""
+}
+
+// publish publishes a single event with the given type and data to all clients of server
+func publish(t *testing.T, server *fakebridge.Server, tp string, data ...clip.Resource) {
+	t.Helper()
+
+	event := clip.Event{ID: "test-event", Type: tp}
+	for _, r := range data {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Data = append(event.Data, raw)
+	}
+	server.Publish(event)
+}
+
+// hasLight checks if bridge has a light with the given id, and returns its name
+func hasLight(t *testing.T, bridge *clip.Bridge, id int) (name string, ok bool) {
+	t.Helper()
+
+	lights, err := bridge.GetLights(context.Background())
+	if err != nil {
+		t.Fatalf("GetLights() err = %v", err)
+	}
+	for _, light := range lights {
+		if light.ID == id {
+			return light.Name, true
+		}
+	}
+	return "", false
+}
+
+func TestBridge_Watch(t *testing.T) {
+	t.Run("update", func(t *testing.T) {
+		server, ts := newTestServer(t)
+		bridge := clip.New(ts.URL, testUser)
+		changed := watch(t, bridge)
+
+		before, err := bridge.GetLight(context.Background(), 2)
+		if err != nil {
+			t.Fatalf("GetLight() err = %v", err)
+		}
+
+		// the fake bridge itself does not change, so the update is only visible in the cache
+		publish(t, server, "update", clip.Resource{ID: lightID(t, bridge, "/lights/2"), Type: "light", Dimming: &clip.Dimming{Brightness: 50}})
+		waitChanged(t, changed)
+
+		after, err := bridge.GetLight(context.Background(), 2)
+		if err != nil {
+			t.Fatalf("GetLight() err = %v", err)
+		}
+		if after.State.Bri != 127 {
+			t.Errorf("GetLight() brightness = %d, want 127", after.State.Bri)
+		}
+		if after.Name != before.Name || after.State.On != before.State.On || after.State.Ct != before.State.Ct {
+			t.Errorf("GetLight() = %+v, want other attributes of %+v", after.State, before.State)
+		}
+	})
+
+	t.Run("change", func(t *testing.T) {
+		_, ts := newTestServer(t)
+		bridge := clip.New(ts.URL, testUser)
+		changed := watch(t, bridge)
+
+		// changes made by another client are received as events
+		other := clip.New(ts.URL, testUser)
+		if err := other.SetLightState(context.Background(), 3, huego.State{On: true}); err != nil {
+			t.Fatalf("SetLightState() err = %v", err)
+		}
+		waitChanged(t, changed)
+
+		light, err := bridge.GetLight(context.Background(), 3)
+		if err != nil {
+			t.Fatalf("GetLight() err = %v", err)
+		}
+		if !light.State.On {
+			t.Error("GetLight() is off, want on")
+		}
+	})
+
+	t.Run("add", func(t *testing.T) {
+		server, ts := newTestServer(t)
+		bridge := clip.New(ts.URL, testUser)
+		changed := watch(t, bridge)
+
+		publish(t, server, "add", clip.Resource{
+			ID:       "added-light",
+			IDv1:     "/lights/7",
+			Type:     "light",
+			Metadata: &clip.Metadata{Name: "Added Lamp"},
+			On:       &clip.On{On: true},
+		})
+		waitChanged(t, changed)
+
+		if name, ok := hasLight(t, bridge, 7); !ok || name != "Added Lamp" {
+			t.Errorf("GetLights() light 7 = %q, %v, want added light", name, ok)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		server, ts := newTestServer(t)
+		bridge := clip.New(ts.URL, testUser)
+		changed := watch(t, bridge)
+
+		publish(t, server, "delete", clip.Resource{ID: lightID(t, bridge, "/lights/2"), Type: "light"})
+		waitChanged(t, changed)
+
+		if _, ok := hasLight(t, bridge, 2); ok {
+			t.Error("GetLights() contains deleted light 2")
+		}
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		server, ts := newTestServer(t)
+		bridge := clip.New(ts.URL, testUser)
+		changed := watch(t, bridge)
+
+		publish(t, server, "delete", clip.Resource{ID: lightID(t, bridge, "/lights/2"), Type: "light"})
+		waitChanged(t, changed)
+
+		// reconnecting fetches all resources again
+		ts.CloseClientConnections()
+		waitChanged(t, changed)
+
+		if _, ok := hasLight(t, bridge, 2); !ok {
+			t.Error("GetLights() does not contain light 2 after reconnecting")
+		}
+	})
+}
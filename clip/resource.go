@@ -0,0 +1,159 @@
+package clip
+
+import "encoding/json"
+
+// Resource is a resource of the v2 api.
+//
+// Only the fields used by huelio are included.
+// Which fields are set depends on the type of the resource.
+type Resource struct {
+	ID   string `json:"id"`
+	IDv1 string `json:"id_v1,omitempty"`
+	Type string `json:"type"`
+
+	Owner    *Reference `json:"owner,omitempty"`
+	Metadata *Metadata  `json:"metadata,omitempty"`
+
+	// lights and grouped lights
+	On               *On               `json:"on,omitempty"`
+	Dimming          *Dimming          `json:"dimming,omitempty"`
+	ColorTemperature *ColorTemperature `json:"color_temperature,omitempty"`
+	Color            *Color            `json:"color,omitempty"`
+	Effects          *Effects          `json:"effects,omitempty"`
+
+	// rooms, zones, devices and the bridge home
+	Children []Reference `json:"children,omitempty"`
+	Services []Reference `json:"services,omitempty"`
+
+	// devices
+	ProductData *ProductData `json:"product_data,omitempty"`
+
+	// scenes
+	Group   *Reference    `json:"group,omitempty"`
+	Actions []SceneAction `json:"actions,omitempty"`
+
+	// entertainment configurations
+	LightServices []Reference `json:"light_services,omitempty"`
+
+	// sensors
+	Enabled     *bool        `json:"enabled,omitempty"`
+	Motion      *Motion      `json:"motion,omitempty"`
+	Temperature *Temperature `json:"temperature,omitempty"`
+	Light       *LightLevel  `json:"light,omitempty"`
+	PowerState  *PowerState  `json:"power_state,omitempty"`
+
+	// Status is a string for zigbee connectivity, and an object for scenes
+	Status json.RawMessage `json:"status,omitempty"`
+
+	// the bridge
+	BridgeID string `json:"bridge_id,omitempty"`
+}
+
+// Reference references another resource
+type Reference struct {
+	RID   string `json:"rid"`
+	RType string `json:"rtype"`
+}
+
+type Metadata struct {
+	Name      string `json:"name,omitempty"`
+	Archetype string `json:"archetype,omitempty"`
+}
+
+type On struct {
+	On bool `json:"on"`
+}
+
+type Dimming struct {
+	Brightness float64 `json:"brightness"` // in percent
+}
+
+type ColorTemperature struct {
+	Mirek      *uint16 `json:"mirek"`
+	MirekValid bool    `json:"mirek_valid,omitempty"`
+}
+
+type Color struct {
+	XY        XY     `json:"xy"`
+	GamutType string `json:"gamut_type,omitempty"`
+}
+
+type XY struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type Effects struct {
+	Effect string `json:"effect,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+type ProductData struct {
+	ModelID     string `json:"model_id,omitempty"`
+	ProductName string `json:"product_name,omitempty"`
+}
+
+// SceneAction is the state a scene sets a single light to
+type SceneAction struct {
+	Target Reference `json:"target"`
+	Action Update    `json:"action"`
+}
+
+type Motion struct {
+	Motion      bool `json:"motion"`
+	MotionValid bool `json:"motion_valid"`
+}
+
+type Temperature struct {
+	Temperature      float64 `json:"temperature"` // in degrees celsius
+	TemperatureValid bool    `json:"temperature_valid"`
+}
+
+type LightLevel struct {
+	LightLevel      int  `json:"light_level"` // 10000 * log10(lux) + 1
+	LightLevelValid bool `json:"light_level_valid"`
+}
+
+type PowerState struct {
+	BatteryLevel int `json:"battery_level"`
+}
+
+// Update is a change to the state of a light, grouped light or scene
+type Update struct {
+	On               *On               `json:"on,omitempty"`
+	Dimming          *Dimming          `json:"dimming,omitempty"`
+	ColorTemperature *ColorTemperature `json:"color_temperature,omitempty"`
+	Color            *Color            `json:"color,omitempty"`
+	Effects          *Effects          `json:"effects,omitempty"`
+	Dynamics         *Dynamics         `json:"dynamics,omitempty"`
+	Alert            *Alert            `json:"alert,omitempty"`
+	Recall           *Recall           `json:"recall,omitempty"`
+}
+
+type Dynamics struct {
+	Duration int `json:"duration"` // in milliseconds
+}
+
+type Alert struct {
+	Action string `json:"action"`
+}
+
+type Recall struct {
+	Action   string `json:"action"`
+	Duration int    `json:"duration,omitempty"` // in milliseconds
+}
+
+// Event is an event received from the event stream
+type Event struct {
+	ID   string            `json:"id"`
+	Type string            `json:"type"` // one of "add", "update", "delete" or "error"
+	Data []json.RawMessage `json:"data"`
+}
+
+// response is the envelope of every response of the v2 api
+type response struct {
+	Errors []struct {
+		Description string `json:"description"`
+	} `json:"errors"`
+	Data json.RawMessage `json:"data"`
+}
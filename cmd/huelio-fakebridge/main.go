@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/tkw1536/huelio"
+	"github.com/tkw1536/huelio/fakebridge"
+)
+
+func main() {
+	fixture := fakebridge.DefaultFixture()
+	if flagFixture != "" {
+		var err error
+		fixture, err = fakebridge.LoadFixture(flagFixture)
+		if err != nil {
+			logger.Error().Err(err).Str("path", flagFixture).Msg("Unable to load fixture")
+			return
+		}
+	}
+
+	server := fakebridge.NewServer(fixture, ctx)
+	if flagName != "" {
+		server.Name = flagName
+	}
+	if flagID != "" {
+		server.ID = flagID
+	}
+	server.LinkWindow = flagLinkWindow
+	server.AlwaysLinked = flagLinked
+	if flagUser != "" {
+		server.AddUser(flagUser)
+	}
+
+	// pressing enter presses the link button
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			server.PressLinkButton()
+		}
+	}()
+
+	httpServer := &http.Server{Addr: flagServerBind, Handler: server}
+	if flagTLS {
+		host, _, _ := net.SplitHostPort(flagServerBind)
+		cert, err := fakebridge.SelfSignedCertificate(host, "localhost", "127.0.0.1")
+		if err != nil {
+			logger.Error().Err(err).Msg("Unable to generate certificate")
+			return
+		}
+		httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+
+	logger.Info().Str("bind", flagServerBind).Bool("tls", flagTLS).Msg("fake bridge listening, press enter or POST " + fakebridge.LinkButtonPath + " to press the link button")
+
+	var err error
+	if flagTLS {
+		err = httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		logger.Error().Err(err).Msg("Unable to listen")
+	}
+}
+
+//
+// ctrl+c
+//
+
+var ctx context.Context
+
+func initcontext() {
+	logger = logger.Output(zerolog.ConsoleWriter{
+		Out:        os.Stderr,
+		TimeFormat: time.DateTime,
+	}).With().Timestamp().Logger()
+
+	ctx = logger.WithContext(context.Background())
+
+	// handle ctrl + c
+	var cancel context.CancelFunc
+	ctx, cancel = signal.NotifyContext(ctx, os.Interrupt)
+
+	go func() {
+		defer cancel()
+		<-ctx.Done()
+	}()
+}
+
+//
+// command line flags
+//
+
+var logger = zerolog.New(os.Stdout)
+
+var flagServerBind = "localhost:8081"
+var flagFixture = ""
+var flagUser = ""
+var flagName = ""
+var flagID = ""
+var flagLinked = false
+var flagTLS = false
+var flagLinkWindow = fakebridge.DefaultLinkWindow
+
+func init() {
+	defer initcontext()
+
+	var legalFlag bool = false
+	flag.BoolVar(&legalFlag, "legal", legalFlag, "Display legal notices and exit")
+	defer func() {
+		if legalFlag {
+			fmt.Print(huelio.LegalText())
+			os.Exit(0)
+		}
+	}()
+
+	var flagQuiet bool = false
+	flag.BoolVar(&flagQuiet, "quiet", flagQuiet, "Supress all logging output")
+	defer func() {
+		if flagQuiet {
+			logger = logger.Level(zerolog.Disabled)
+		}
+	}()
+
+	flag.StringVar(&flagServerBind, "bind", flagServerBind, "Address to bind fake bridge on")
+	flag.StringVar(&flagFixture, "fixture", flagFixture, "JSON file holding groups, lights, scenes and sensors of the fake bridge. Defaults to a built-in fixture. ")
+	flag.StringVar(&flagName, "name", flagName, "Name of the fake bridge, overriding the fixture")
+	flag.StringVar(&flagID, "id", flagID, "Bridge id of the fake bridge, overriding the fixture. Use different ids to run several fake bridges. ")
+	flag.StringVar(&flagUser, "user", flagUser, "Username to authorize without pressing the link button")
+	flag.BoolVar(&flagLinked, "linked", flagLinked, "Simulate a link button that is always pressed")
+	flag.BoolVar(&flagTLS, "tls", flagTLS, "Serve https using a self-signed certificate, as required by the v2 api")
+	flag.DurationVar(&flagLinkWindow, "link-window", flagLinkWindow, "Time the link button stays pressed")
+	flag.Parse()
+}
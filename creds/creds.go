@@ -1,20 +1,64 @@
 // Package creds implements facilities for managing and generating hue bridge credentials
 package creds
 
-import "github.com/amimof/huego"
+import (
+	"context"
+
+	"github.com/amimof/huego"
+	"github.com/tkw1536/huelio/clip"
+	"github.com/tkw1536/huelio/engine"
+)
 
 // Credentials represents credentials to a hue bridge
 type Credentials struct {
+	ID   string `json:"id,omitempty"`   // id of the bridge, filled in upon connecting
+	Name string `json:"name,omitempty"` // name to show the bridge as, defaults to the name configured on the bridge
+
 	Hostname string `json:"hostname"`
 	Username string `json:"username"`
+
+	// Fingerprint is the fingerprint of the certificate of the bridge, filled in upon first connecting using version 2 of the hue api.
+	// Later connections only accept the same certificate.
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
-// NewBridge creates a new bridge based on credentials
-func NewBridge(credentials *Credentials) (*huego.Bridge, error) {
+// NewBridge creates a new bridge based on credentials.
+// When the id or name of the credentials are empty, they are filled in using the configuration of the bridge.
+func NewBridge(credentials *Credentials) (engine.Bridge, error) {
 	bridge := huego.New(credentials.Hostname, credentials.Username)
-	_, err := bridge.GetCapabilities()
+	config, err := bridge.GetConfig()
 	if err != nil {
 		return nil, err
 	}
+	if credentials.ID == "" {
+		credentials.ID = config.BridgeID
+	}
+	if credentials.Name == "" {
+		credentials.Name = config.Name
+	}
+	return engine.NewHuegoBridge(bridge), nil
+}
+
+// NewClipBridge is like NewBridge, but creates a bridge using version 2 of the hue api.
+// The username of the credentials is used as the application key.
+// The certificate of the bridge is pinned to the fingerprint of the credentials, which is filled in when empty.
+func NewClipBridge(credentials *Credentials) (engine.Bridge, error) {
+	bridge := clip.New(credentials.Hostname, credentials.Username)
+	if credentials.Fingerprint != "" {
+		if err := bridge.Pin(credentials.Fingerprint); err != nil {
+			return nil, err
+		}
+	}
+	id, name, err := bridge.Identify(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	credentials.Fingerprint = bridge.Fingerprint()
+	if credentials.ID == "" {
+		credentials.ID = id
+	}
+	if credentials.Name == "" {
+		credentials.Name = name
+	}
 	return bridge, nil
 }
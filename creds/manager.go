@@ -2,67 +2,173 @@ package creds
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
 
-	"github.com/amimof/huego"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"github.com/tkw1536/huelio/engine"
 )
 
-// Manager manages credentials for a single Hue Bridge
+// Manager manages credentials for one or more Hue Bridges
 type Manager struct {
 	l sync.Mutex
 
 	Ctx context.Context
 
-	Finder Finder
-	Store  Store
+	// Finders find credentials for bridges that are not in the store yet.
+	// A finder with a hostname is used unless the store holds credentials for that hostname.
+	// A finder without a hostname discovers a bridge, and is only used when the store is empty.
+	Finders []Finder
+	Store   Store
+
+	// Connector creates a bridge from credentials.
+	// When nil, NewBridge is used.
+	Connector func(credentials *Credentials) (engine.Bridge, error)
 }
 
-// Connect connects to a Hue Bridge.
+var ErrManagerNoBridges = errors.New("Manager: unable to connect to any bridge")
+
+// Connect connects to all known Hue Bridges.
 // It is intended to be used by engine.Connect.
-func (sm *Manager) Connect() (*huego.Bridge, error) {
+//
+// Bridges that can not be connected to are skipped, unless no bridge can be connected to.
+func (sm *Manager) Connect() ([]engine.NamedBridge, error) {
 	managerLogger := zerolog.Ctx(sm.Ctx).With().Str("component", "creds.Manager").Logger()
 
 	sm.l.Lock()
 	defer sm.l.Unlock()
 
-	// if we have credentials in the store, return them!
+	// read the credentials in the store
 	managerLogger.Info().Msg("reading credentials from store")
-	creds, err := sm.Store.Read()
+	stored, err := sm.Store.Read()
 	if err != nil {
 		managerLogger.Error().Err(err).Msg("unable to read stored credentials")
 		return nil, errors.Wrap(err, "unable to read stored credentials")
 	}
-	if creds != nil {
-		managerLogger.Info().Msg("using stored credentials")
-		return NewBridge(creds)
-	}
 
-	// create new credentials
-	managerLogger.Info().Msg("finding new credentials")
-	credentials, err := sm.Finder.Find()
-	if err != nil {
-		managerLogger.Error().Err(err).Msg("unable to generate new credentials")
-		return nil, errors.Wrap(err, "unable to generate new credentials")
+	var bridges []engine.NamedBridge
+	var lastErr error
+
+	credentials := make([]Credentials, 0, len(stored))
+	hostnames := make(map[string]struct{}, len(stored))
+	changed := false
+
+	// connect to the stored bridges
+	for _, creds := range stored {
+		hostnames[hostKey(creds.Hostname)] = struct{}{}
+
+		managerLogger.Info().Str("hostname", creds.Hostname).Msg("using stored credentials")
+		id, name, fingerprint := creds.ID, creds.Name, creds.Fingerprint
+		bridge, err := sm.connect(&creds)
+		if err != nil {
+			managerLogger.Error().Err(err).Str("hostname", creds.Hostname).Msg("bridge connection failed")
+			lastErr = err
+		} else {
+			bridges = append(bridges, engine.NamedBridge{Name: creds.Name, Bridge: bridge})
+		}
+
+		// only store the id, so that the name follows the configuration of the bridge
+		creds.Name = name
+		changed = changed || creds.ID != id || creds.Fingerprint != fingerprint
+		credentials = addCredentials(credentials, creds)
 	}
 
-	// make a bridge
-	managerLogger.Info().Msg("connecting to bridge")
-	bridge, err := NewBridge(credentials)
-	if err != nil {
-		managerLogger.Error().Err(err).Msg("bridge connection failed")
-		return nil, errors.Wrap(err, "bridge connection failed")
+	// create new credentials for any other bridges
+	for _, finder := range sm.Finders {
+		if _, ok := hostnames[hostKey(finder.Hostname)]; ok && finder.Hostname != "" {
+			continue
+		}
+		if finder.Hostname == "" && len(stored) > 0 {
+			continue
+		}
+
+		managerLogger.Info().Str("hostname", finder.Hostname).Msg("finding new credentials")
+		creds, err := finder.Find()
+		if err != nil {
+			managerLogger.Error().Err(err).Msg("unable to generate new credentials")
+			lastErr = errors.Wrap(err, "unable to generate new credentials")
+			continue
+		}
+
+		managerLogger.Info().Str("hostname", creds.Hostname).Msg("connecting to bridge")
+		bridge, err := sm.connect(creds)
+		if err != nil {
+			managerLogger.Error().Err(err).Msg("bridge connection failed")
+			lastErr = errors.Wrap(err, "bridge connection failed")
+			continue
+		}
+
+		bridges = append(bridges, engine.NamedBridge{Name: creds.Name, Bridge: bridge})
+		creds.Name = ""
+		credentials = addCredentials(credentials, *creds)
+		changed = true
 	}
 
 	// write the credentials to the store!
-	managerLogger.Info().Msg("writing credentials to store")
-	if err := sm.Store.Write(credentials); err != nil {
-		managerLogger.Error().Err(err).Msg("unable to store credentials")
-		return nil, errors.Wrap(err, "unable to store credentials")
+	if changed {
+		managerLogger.Info().Int("bridges", len(credentials)).Msg("writing credentials to store")
+		if err := sm.Store.Write(credentials); err != nil {
+			managerLogger.Error().Err(err).Msg("unable to store credentials")
+			return nil, errors.Wrap(err, "unable to store credentials")
+		}
+	}
+
+	if len(bridges) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, ErrManagerNoBridges
 	}
 
 	// and return!
-	managerLogger.Info().Msg("connection to bridge finished")
-	return bridge, nil
+	uniqueNames(bridges)
+	managerLogger.Info().Int("bridges", len(bridges)).Msg("connection to bridges finished")
+	return bridges, nil
+}
+
+// connect creates a bridge from the given credentials
+func (sm *Manager) connect(credentials *Credentials) (engine.Bridge, error) {
+	if sm.Connector != nil {
+		return sm.Connector(credentials)
+	}
+	return NewBridge(credentials)
+}
+
+// hostKey returns a key identifying the given hostname, ignoring case and any scheme
+func hostKey(hostname string) string {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+	hostname = strings.TrimPrefix(hostname, "http://")
+	hostname = strings.TrimPrefix(hostname, "https://")
+	return strings.TrimSuffix(hostname, "/")
+}
+
+// addCredentials adds creds to credentials, replacing any existing credentials for the same bridge id
+func addCredentials(credentials []Credentials, creds Credentials) []Credentials {
+	if creds.ID != "" {
+		for i, other := range credentials {
+			if other.ID == creds.ID {
+				credentials[i] = creds
+				return credentials
+			}
+		}
+	}
+	return append(credentials, creds)
+}
+
+// uniqueNames makes the names of the given bridges unique, by appending a number to duplicates
+func uniqueNames(bridges []engine.NamedBridge) {
+	seen := make(map[string]struct{}, len(bridges))
+	for i := range bridges {
+		name := bridges[i].Name
+		for n := 2; ; n++ {
+			if _, ok := seen[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("%s (%d)", bridges[i].Name, n)
+		}
+		seen[name] = struct{}{}
+		bridges[i].Name = name
+	}
 }
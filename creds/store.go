@@ -5,15 +5,15 @@ import (
 	"os"
 )
 
-// Store reads and writes credentials
+// Store reads and writes credentials, holding one entry per bridge
 type Store interface {
-	// Read reads credentials from this store.
+	// Read reads all credentials from this store.
 	// When no credentials exist, returns nil.
-	Read() (*Credentials, error)
+	Read() ([]Credentials, error)
 
-	// Write writes credentials to this store.
+	// Write writes credentials to this store, replacing any existing ones.
 	// Write(nil) deletes any stored credentials
-	Write(credentials *Credentials) error
+	Write(credentials []Credentials) error
 }
 
 // JSONFileStore stores credentials in the provided JSON file on disk.
@@ -22,10 +22,13 @@ type JSONFileStore string
 
 // Read reads credentials from the provided filename on disk.
 //
+// The file holds a JSON array of credentials, one for each bridge.
+// A file holding a single {"hostname", "username"} object, the format used before multiple bridges were supported, is read as the credentials of one bridge.
+//
 // When the file does not exist, the store is considered empty.
 // When the file cannot be considered, or contains data other than credentials, this is considered an error.
-func (f JSONFileStore) Read() (*Credentials, error) {
-	h, err := os.Open(string(f))
+func (f JSONFileStore) Read() ([]Credentials, error) {
+	bytes, err := os.ReadFile(string(f))
 	if err != nil {
 		// file does not exist, meaning the store it empty
 		if os.IsNotExist(err) {
@@ -33,21 +36,28 @@ func (f JSONFileStore) Read() (*Credentials, error) {
 		}
 		return nil, err
 	}
-	defer h.Close()
 
 	// read json from the file
-	credentials := &Credentials{}
-	err = json.NewDecoder(h).Decode(credentials)
-	return credentials, err
+	var credentials []Credentials
+	if err := json.Unmarshal(bytes, &credentials); err == nil {
+		return credentials, nil
+	}
+
+	// single-bridge format
+	var single Credentials
+	if err := json.Unmarshal(bytes, &single); err != nil {
+		return nil, err
+	}
+	return []Credentials{single}, nil
 }
 
 // Write writes credentials to the provided filename on disk.
 //
 // When creating a new file, uses chmod 0600 to prevent other users from accessing the file.
 // When the credentials being written are empty, deletes the file.
-func (f JSONFileStore) Write(credentials *Credentials) error {
+func (f JSONFileStore) Write(credentials []Credentials) error {
 	// delete the credentials
-	if credentials == nil {
+	if len(credentials) == 0 {
 		err := os.Remove(string(f))
 		if err != nil && os.IsNotExist(err) {
 			return nil
@@ -69,16 +79,16 @@ func (f JSONFileStore) Write(credentials *Credentials) error {
 // InMemoryStore stores credentials in-memory.
 // It implements Store.
 type InMemoryStore struct {
-	credentials *Credentials
+	credentials []Credentials
 }
 
 // Read reads credentials from memory
-func (store *InMemoryStore) Read() (*Credentials, error) {
+func (store *InMemoryStore) Read() ([]Credentials, error) {
 	return store.credentials, nil
 }
 
 // Write writes credentials to memory
-func (store *InMemoryStore) Write(credentials *Credentials) error {
-	store.credentials = credentials
+func (store *InMemoryStore) Write(credentials []Credentials) error {
+	store.credentials = append([]Credentials(nil), credentials...)
 	return nil
 }
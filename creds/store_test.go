@@ -0,0 +1,69 @@
+package creds
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJSONFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.json")
+	store := JSONFileStore(path)
+
+	if credentials, err := store.Read(); credentials != nil || err != nil {
+		t.Fatalf("Read() = %v, %v, want nil, nil on a missing file", credentials, err)
+	}
+
+	want := []Credentials{
+		{ID: "001788FFFE000001", Name: "Upstairs", Hostname: "192.168.0.2", Username: "user1"},
+		{Hostname: "192.168.0.3", Username: "user2"},
+	}
+	if err := store.Write(want); err != nil {
+		t.Fatalf("Write() err = %v", err)
+	}
+	got, err := store.Read()
+	if err != nil {
+		t.Fatalf("Read() err = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %v, want %v", got, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("Write() created file with mode %o, want 0600", mode)
+	}
+
+	if err := store.Write(nil); err != nil {
+		t.Fatalf("Write(nil) err = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Write(nil) did not delete the file")
+	}
+}
+
+func TestJSONFileStore_Read_single(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.json")
+	if err := os.WriteFile(path, []byte(`{"hostname":"192.168.0.2","username":"user1"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := JSONFileStore(path).Read()
+	if err != nil {
+		t.Fatalf("Read() err = %v", err)
+	}
+	if want := []Credentials{{Hostname: "192.168.0.2", Username: "user1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %v, want %v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`"not credentials"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := JSONFileStore(path).Read(); err == nil {
+		t.Error("Read() err = nil, want error for invalid data")
+	}
+}
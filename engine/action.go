@@ -1,43 +1,68 @@
 package engine
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/amimof/huego"
 	"github.com/lucasb-eyer/go-colorful"
 	"github.com/mazznoer/csscolorparser"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 )
 
 // Action represents  single action
 type Action struct {
+	// Bridge is the name of the bridge this action is performed on.
+	// When empty, the action is performed on the first bridge of the engine.
+	Bridge string `json:"bridge,omitempty"`
+
 	Group *HueGroup `json:"group,omitempty"`
 	Light *HueLight `json:"light,omitempty"`
 
+	// Sensor is a sensor to show the reading of.
+	// Actions with a sensor are informational only, and can not be performed.
+	Sensor *HueSensor `json:"sensor,omitempty"`
+
+	// Status is the current status of the group or light.
+	// Actions with a status are informational only, and can not be performed.
+	Status *Status `json:"status,omitempty"`
+
 	Scene *HueScene `json:"scene,omitempty"`
 	OnOff BoolOnOff `json:"onoff,omitempty"`
 	Color string    `json:"color,omitempty"`
 
+	Brightness  Brightness  `json:"brightness,omitempty"`
+	Temperature Temperature `json:"ct,omitempty"`
+	Effect      Effect      `json:"effect,omitempty"`
+
+	Transition Transition `json:"transition,omitempty"`
+	Schedule   *Schedule  `json:"schedule,omitempty"`
+
+	// Macro is a user-defined macro to perform.
+	// When set, the remaining fields except the modifiers are ignored.
+	Macro *HueMacro `json:"macro,omitempty"`
+
+	// Actions are the parts of a composite action.
+	// When set, the remaining fields are ignored.
+	Actions []Action `json:"actions,omitempty"`
+
 	Special *HueSpecial `json:"special,omitempty"`
 }
 
-func (act Action) ColorXY() (xy []float32) {
+// ColorXY returns the color of this action as a point within the given gamut, along with the brightness of the color.
+// When this action does not have a valid color, returns xy = nil.
+func (act Action) ColorXY(gamut Gamut) (xy []float32, bri Brightness) {
 	pc, err := csscolorparser.Parse(act.Color)
 	if err != nil {
 		return
 	}
 
-	color, err := colorful.Hex(pc.HexString())
-	if err != nil {
-		return
-	}
-
-	X, Y, Z := color.Xyz()
-	xy = []float32{
-		float32(X / (X + Y + Z)),
-		float32(Y / (X + Y + Z)),
-	}
-
+	point, bri := ColorToXY(colorful.Color{R: pc.R, G: pc.G, B: pc.B}, gamut)
+	xy = []float32{float32(point[0]), float32(point[1])}
 	return
 }
 
@@ -45,64 +70,303 @@ func (act Action) ColorXY() (xy []float32) {
 type BoolOnOff string
 
 const (
-	BoolAny BoolOnOff = ""
-	BoolOn  BoolOnOff = "on"
-	BoolOff BoolOnOff = "off"
+	BoolAny    BoolOnOff = ""
+	BoolOn     BoolOnOff = "on"
+	BoolOff    BoolOnOff = "off"
+	BoolToggle BoolOnOff = "toggle"
 )
 
+// Resolve resolves a toggle into either BoolOn or BoolOff, depending on if the target is currently on.
+// Other values are returned unchanged.
+func (onoff BoolOnOff) Resolve(isOn bool) BoolOnOff {
+	if onoff != BoolToggle {
+		return onoff
+	}
+	if isOn {
+		return BoolOff
+	}
+	return BoolOn
+}
+
 // HueSpecial represents a special action that can be returned by the webserver
 type HueSpecial struct {
 	ID   string `json:"id"`
 	Data struct {
 		Message string `json:"message"`
+		Job     string `json:"job,omitempty"` // id of the job to cancel, if any
 	} `json:"data"`
 }
 
 var ErrInvalidAction = errors.New("action.Do: Invalid action")
+var ErrReadOnlyAction = errors.New("action.Do: Action is read-only")
+
+// ReadOnly checks if this action is informational only
+func (action Action) ReadOnly() bool {
+	return action.Sensor != nil || action.Status != nil
+}
 
-func (action Action) Do(bridge *huego.Bridge) error {
+func (action Action) Do(bridge Bridge) error {
 	switch {
+	case action.ReadOnly():
+		return ErrReadOnlyAction
+	case action.Macro != nil:
+		return action.doMacro(bridge)
+	case len(action.Actions) > 0:
+		return action.doComposite(bridge)
 	case action.Group != nil:
 		if err := action.Group.Refresh(bridge); err != nil {
 			return errors.Wrap(err, "Unable to find group")
 		}
 		group := action.Group.Data
-		xy := action.ColorXY()
-		switch {
-		case action.Scene != nil:
-			return group.Scene(action.Scene.ID)
-		case action.OnOff == "on":
-			return group.SetState(huego.State{On: true})
-		case action.OnOff == "off":
-			return group.SetState(huego.State{On: false})
-		case xy != nil:
-			return group.SetState(huego.State{On: true, Xy: xy})
-		}
-	case action.Light != nil:
+
+		if action.Scene != nil {
+			return bridge.RecallScene(context.Background(), action.Scene.ID, group.ID, action.Transition)
+		}
+
+		if action.Color != "" {
+			return action.doGroupColor(bridge, group)
+		}
+
+		state, ok := action.state(group.GroupState != nil && group.GroupState.AnyOn, GamutDefault)
+		if !ok {
+			return ErrInvalidAction
+		}
+		return bridge.SetGroupState(context.Background(), group.ID, state)
+	case action.Light != nil && action.Scene == nil:
 		if err := action.Light.Refresh(bridge); err != nil {
 			return errors.Wrap(err, "Unable to find light")
 		}
 		light := action.Light.Data
 
-		xy := action.ColorXY()
-		switch {
-		case xy != nil:
-			return light.SetState(huego.State{On: true, Xy: xy})
-		case action.OnOff == "on":
-			return light.SetState(huego.State{On: true})
-		case action.OnOff == "off":
-			return light.SetState(huego.State{On: false})
+		state, ok := action.state(light.State != nil && light.State.On, GamutForModel(light.ModelID))
+		if !ok {
+			return ErrInvalidAction
 		}
+		return bridge.SetLightState(context.Background(), light.ID, state)
 	}
 	return ErrInvalidAction
 }
 
+// CompositeError is returned when some parts of a composite action failed
+type CompositeError []TargetError
+
+// TargetError represents an error that occured for a specific part of a composite action
+type TargetError struct {
+	Action Action
+	Err    error
+}
+
+func (te TargetError) Error() string {
+	return fmt.Sprintf("%s: %s", te.Action, te.Err)
+}
+
+func (te TargetError) Unwrap() error {
+	return te.Err
+}
+
+func (ce CompositeError) Error() string {
+	messages := make([]string, len(ce))
+	for i, err := range ce {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// doComposite performs all parts of a composite action concurrently.
+// If any parts fail, returns a CompositeError holding an error for each failed part.
+func (action Action) doComposite(bridge Bridge) error {
+	errs := make([]error, len(action.Actions))
+
+	var wg sync.WaitGroup
+	for i, part := range action.Actions {
+		wg.Add(1)
+		go func(i int, part Action) {
+			defer wg.Done()
+			errs[i] = part.Do(bridge)
+		}(i, part)
+	}
+	wg.Wait()
+
+	var ce CompositeError
+	for i, err := range errs {
+		if err != nil {
+			ce = append(ce, TargetError{Action: action.Actions[i], Err: err})
+		}
+	}
+	if len(ce) > 0 {
+		return ce
+	}
+	return nil
+}
+
+// doGroupColor sets the color of a group.
+//
+// When all lights in the group share the same gamut, a single request is sent to the group.
+// Otherwise every light is set individually, using the closest color within its gamut.
+func (action Action) doGroupColor(bridge Bridge, group huego.Group) error {
+	lights, err := groupLights(bridge, group)
+	if err != nil {
+		return errors.Wrap(err, "Unable to find lights")
+	}
+
+	gamut := GamutDefault
+	uniform := true
+	for i, light := range lights {
+		lGamut := GamutForModel(light.ModelID)
+		if i == 0 {
+			gamut = lGamut
+		}
+		if lGamut != gamut {
+			uniform = false
+			break
+		}
+	}
+
+	if uniform {
+		state, ok := action.state(true, gamut)
+		if !ok {
+			return ErrInvalidAction
+		}
+		return bridge.SetGroupState(context.Background(), group.ID, state)
+	}
+
+	var eg errgroup.Group
+	for _, light := range lights {
+		light := light
+		eg.Go(func() error {
+			state, ok := action.state(true, GamutForModel(light.ModelID))
+			if !ok {
+				return ErrInvalidAction
+			}
+			return bridge.SetLightState(context.Background(), light.ID, state)
+		})
+	}
+	return eg.Wait()
+}
+
+// groupLights returns the lights that are part of the given group
+func groupLights(bridge Bridge, group huego.Group) ([]huego.Light, error) {
+	all, err := bridge.GetLights(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if group.ID == AllLightsID {
+		return all, nil
+	}
+
+	ids := make(map[string]struct{}, len(group.Lights))
+	for _, id := range group.Lights {
+		ids[id] = struct{}{}
+	}
+
+	lights := make([]huego.Light, 0, len(group.Lights))
+	for _, light := range all {
+		if _, ok := ids[strconv.Itoa(light.ID)]; ok {
+			lights = append(lights, light)
+		}
+	}
+	return lights, nil
+}
+
+// state returns the state to be sent to the bridge when performing this action.
+// isOn indicates if the target of this action is currently on, gamut is the gamut used for colors.
+//
+// If the action does not represent a valid change in state, returns ok = false.
+func (action Action) state(isOn bool, gamut Gamut) (state huego.State, ok bool) {
+	state.TransitionTime = uint16(action.Transition)
+
+	xy, bri := action.ColorXY(gamut)
+	switch onoff := action.OnOff.Resolve(isOn); {
+	case onoff == BoolOn:
+		state.On = true
+	case onoff == BoolOff:
+		state.On = false
+	case xy != nil:
+		state.On = true
+		state.Xy = xy
+		state.Bri = uint8(bri)
+	case action.Temperature.Valid():
+		state.On = true
+		state.Ct = uint16(action.Temperature)
+	case action.Brightness.Valid():
+		state.On = true
+		state.Bri = uint8(action.Brightness)
+	case action.Effect == EffectStop:
+		state.On = isOn
+		state.Effect, state.Alert = action.Effect.apply()
+	case action.Effect.Valid():
+		state.On = true
+		state.Effect, state.Alert = action.Effect.apply()
+	default:
+		return state, false
+	}
+	return state, true
+}
+
+// clone returns a copy of this action that does not share any groups, lights or scenes with the original.
+// This allows refreshing the copy without modifying the original.
+func (action Action) clone() Action {
+	if action.Group != nil {
+		group := *action.Group
+		action.Group = &group
+	}
+	if action.Light != nil {
+		light := *action.Light
+		action.Light = &light
+	}
+	if action.Scene != nil {
+		scene := *action.Scene
+		action.Scene = &scene
+	}
+	if action.Actions != nil {
+		parts := make([]Action, len(action.Actions))
+		for i, part := range action.Actions {
+			parts[i] = part.clone()
+		}
+		action.Actions = parts
+	}
+	return action
+}
+
 // String stringifies the ex
 func (res Action) String() string {
+	if res.Sensor != nil {
+		return fmt.Sprintf("Sensor %q: %s", res.Sensor.Device, res.Sensor.Reading)
+	}
+
+	if res.Status != nil {
+		switch {
+		case res.Group != nil:
+			return fmt.Sprintf("%s: %s", res.Group.title(), res.Status)
+		case res.Light != nil:
+			return fmt.Sprintf("Light %q: %s", res.Light.Data.Name, res.Status)
+		}
+	}
+
+	if res.Macro != nil {
+		name := fmt.Sprintf("Macro %q", res.Macro.ID)
+		if res.Schedule != nil {
+			name += " " + res.Schedule.String()
+		}
+		return name
+	}
+
+	if len(res.Actions) > 0 {
+		parts := make([]string, len(res.Actions))
+		for i, part := range res.Actions {
+			parts[i] = part.String()
+		}
+		if res.Schedule != nil {
+			return fmt.Sprintf("%s (%s)", strings.Join(parts, "; "), res.Schedule)
+		}
+		return strings.Join(parts, "; ")
+	}
+
 	var name string
 	switch {
 	case res.Group != nil:
-		name = fmt.Sprintf("Room %q", res.Group.Data.Name)
+		name = res.Group.title()
 	case res.Light != nil:
 		name = fmt.Sprintf("Light %q", res.Light.Data.Name)
 	default:
@@ -115,11 +379,28 @@ func (res Action) String() string {
 		action = "turn on"
 	case res.OnOff == "off":
 		action = "turn off"
+	case res.OnOff == "toggle":
+		action = "toggle"
 	case res.Color != "":
 		action = "turn " + res.Color
+	case res.Temperature != TemperatureAny:
+		action = "set color temperature to " + res.Temperature.String()
+	case res.Brightness != BrightnessAny:
+		action = "set brightness to " + res.Brightness.String()
+	case res.Effect == EffectStop:
+		action = "stop effects"
+	case res.Effect != EffectAny:
+		action = "start " + string(res.Effect)
 	case res.Scene != nil:
 		action = fmt.Sprintf("activate %q", res.Scene.Data.Name)
 	}
 
+	if res.Transition != TransitionDefault {
+		action += " over " + res.Transition.String()
+	}
+	if res.Schedule != nil {
+		action += " " + res.Schedule.String()
+	}
+
 	return fmt.Sprintf("%s: %s", name, action)
 }
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Aliases holds additional names for groups, lights and scenes.
+// Each map goes from the id of an object to its aliases.
+type Aliases struct {
+	Groups map[string][]string `json:"groups,omitempty"`
+	Lights map[string][]string `json:"lights,omitempty"`
+	Scenes map[string][]string `json:"scenes,omitempty"`
+}
+
+// AliasKind is the kind of object an alias refers to
+type AliasKind string
+
+const (
+	AliasGroup AliasKind = "group"
+	AliasLight AliasKind = "light"
+	AliasScene AliasKind = "scene"
+)
+
+var ErrAliasInvalidKind = errors.New("Aliases: invalid kind")
+
+// Group returns the aliases of the group with the given id
+func (aliases Aliases) Group(id int) []string {
+	return aliases.Groups[strconv.Itoa(id)]
+}
+
+// Light returns the aliases of the light with the given id
+func (aliases Aliases) Light(id int) []string {
+	return aliases.Lights[strconv.Itoa(id)]
+}
+
+// Scene returns the aliases of the scene with the given id
+func (aliases Aliases) Scene(id string) []string {
+	return aliases.Scenes[id]
+}
+
+// With returns a copy of aliases where the object of the given kind and id has the given names.
+// When names is empty, the aliases of the object are removed.
+func (aliases Aliases) With(kind AliasKind, id string, names []string) (Aliases, error) {
+	var m *map[string][]string
+	switch kind {
+	case AliasGroup:
+		m = &aliases.Groups
+	case AliasLight:
+		m = &aliases.Lights
+	case AliasScene:
+		m = &aliases.Scenes
+	default:
+		return aliases, ErrAliasInvalidKind
+	}
+
+	// copy the map, to not modify the original
+	updated := make(map[string][]string, len(*m)+1)
+	for k, v := range *m {
+		updated[k] = v
+	}
+
+	cleaned := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			cleaned = append(cleaned, name)
+		}
+	}
+
+	if len(cleaned) == 0 {
+		delete(updated, id)
+	} else {
+		updated[id] = cleaned
+	}
+
+	*m = updated
+	return aliases, nil
+}
+
+// LoadAliases loads aliases from the JSON file at path
+func LoadAliases(path string) (aliases Aliases, err error) {
+	h, err := os.Open(path)
+	if err != nil {
+		return aliases, err
+	}
+	defer h.Close()
+
+	err = json.NewDecoder(h).Decode(&aliases)
+	return aliases, err
+}
+
+// SaveAliases saves aliases to the JSON file at path.
+//
+// When creating a new file, uses chmod 0600 to prevent other users from accessing the file.
+func SaveAliases(path string, aliases Aliases) error {
+	bytes, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bytes, 0600)
+}
+
+// WatchAliases loads aliases from the JSON file at path and calls update with them.
+// It then checks the file for changes every interval, and reloads aliases when it is modified.
+//
+// WatchAliases blocks until ctx is closed.
+func WatchAliases(ctx context.Context, path string, interval time.Duration, update func(aliases Aliases)) {
+	watchLogger := zerolog.Ctx(ctx).With().Str("component", "engine.WatchAliases").Str("path", path).Logger()
+
+	watchFile(ctx, path, interval, watchLogger, func() error {
+		aliases, err := LoadAliases(path)
+		if err != nil {
+			return err
+		}
+
+		watchLogger.Info().Int("groups", len(aliases.Groups)).Int("lights", len(aliases.Lights)).Int("scenes", len(aliases.Scenes)).Msg("loaded aliases")
+		update(aliases)
+		return nil
+	})
+}
+
+// scoreNames scores source against a canonical name and a set of aliases.
+// It returns the best score, along with the alias that matched best.
+// When the canonical name matches at least as well as any alias, alias is empty.
+func scoreNames(source string, canonical string, aliases []string) (alias string, score float64) {
+	score = scoreText(source, canonical)
+	for _, a := range aliases {
+		if aScore := scoreText(source, a); aScore >= 0 && (score < 0 || aScore < score) {
+			alias, score = a, aScore
+		}
+	}
+	return
+}
+
+// matchedAlias returns the alias matched by the best matching query.
+// match scores a single query, and returns the alias it matched.
+func matchedAlias(queries []Query, match func(q Query) (string, float64)) (alias string) {
+	best := -1.0
+	for _, q := range queries {
+		qAlias, score := match(q)
+		if score >= 0 && (best < 0 || score < best) {
+			alias, best = qAlias, score
+		}
+	}
+	return
+}
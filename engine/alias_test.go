@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestEngine_UpdateAliases(t *testing.T) {
+	engine := NewEngine(newTestBridge(), context.Background())
+
+	// concurrent edits of different objects must not get lost
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := engine.UpdateAliases(func(aliases Aliases) (Aliases, error) {
+				return aliases.With(AliasLight, strconv.Itoa(i), []string{"light " + strconv.Itoa(i)})
+			})
+			if err != nil {
+				t.Errorf("UpdateAliases() err = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(engine.Aliases().Lights); got != n {
+		t.Errorf("UpdateAliases() kept %d aliases, want %d", got, n)
+	}
+
+	// a failed edit leaves the aliases unchanged
+	before := engine.Aliases()
+	if _, err := engine.UpdateAliases(func(aliases Aliases) (Aliases, error) {
+		return aliases.With("invalid", "1", []string{"invalid"})
+	}); err != ErrAliasInvalidKind {
+		t.Errorf("UpdateAliases() err = %v, want %v", err, ErrAliasInvalidKind)
+	}
+	if after := engine.Aliases(); !reflect.DeepEqual(before, after) {
+		t.Errorf("UpdateAliases() changed aliases on error")
+	}
+}
+
+func TestSaveAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+
+	aliases := Aliases{Groups: map[string][]string{"1": {"cooking"}}}
+	if err := SaveAliases(path, aliases); err != nil {
+		t.Fatalf("SaveAliases() err = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("SaveAliases() created file with mode %o, want 600", mode)
+	}
+
+	got, err := LoadAliases(path)
+	if err != nil {
+		t.Fatalf("LoadAliases() err = %v", err)
+	}
+	if !reflect.DeepEqual(got, aliases) {
+		t.Errorf("LoadAliases() = %v, want %v", got, aliases)
+	}
+}
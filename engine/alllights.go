@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/amimof/huego"
+)
+
+// AllLightsID is the id of the special group that contains all lights known to the bridge
+const AllLightsID = 0
+
+// AllLightsName is the name used for the group with AllLightsID
+const AllLightsName = "All lights"
+
+// allLightsAliases are additional names that match the group with AllLightsID
+var allLightsAliases = []string{"all", "everything", "house"}
+
+// normalizeAllLights gives the group with AllLightsID a human-readable name.
+// Other groups are left unchanged.
+func normalizeAllLights(group *huego.Group) {
+	if group.ID == AllLightsID {
+		group.Name = AllLightsName
+	}
+}
+
+// matchAllLights scores name against the aliases of the group with AllLightsID
+func matchAllLights(name string) float64 {
+	score := -1.0
+	for _, alias := range allLightsAliases {
+		if aScore := scoreText(name, alias); aScore >= 0 && (score < 0 || aScore < score) {
+			score = aScore
+		}
+	}
+	return score
+}
+
+// sceneGroupID returns the id of the group the given scene can be activated in.
+// Scenes that do not belong to a specific group are activated using the group with AllLightsID.
+func sceneGroupID(scene huego.Scene) string {
+	if strings.TrimSpace(scene.Group) == "" {
+		return "0"
+	}
+	return scene.Group
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/amimof/huego"
+)
+
+// Bridge is a hue bridge that an engine can index and perform actions on.
+//
+// Groups, lights and scenes returned from a bridge are plain data.
+// Changes must be made using the methods of the bridge, not the methods of the returned objects.
+type Bridge interface {
+	// Host returns the host of this bridge.
+	// It is used to tell apart the data of different bridges.
+	Host() string
+
+	GetGroups(ctx context.Context) ([]huego.Group, error)
+	GetGroup(ctx context.Context, id int) (*huego.Group, error)
+	GetLights(ctx context.Context) ([]huego.Light, error)
+	GetLight(ctx context.Context, id int) (*huego.Light, error)
+	GetScenes(ctx context.Context) ([]huego.Scene, error)
+	GetScene(ctx context.Context, id string) (*huego.Scene, error)
+	GetSensors(ctx context.Context) ([]huego.Sensor, error)
+
+	// SetGroupState sets the state of all lights in the group with the given id.
+	SetGroupState(ctx context.Context, id int, state huego.State) error
+
+	// SetLightState sets the state of the light with the given id.
+	SetLightState(ctx context.Context, id int, state huego.State) error
+
+	// RecallScene activates the scene with the given id in the group with the given id.
+	RecallScene(ctx context.Context, id string, group int, transition Transition) error
+}
+
+// WatchingBridge is a Bridge that notices changes on its own, for instance using an event stream.
+// Engines update the index of such a bridge whenever it changes, in addition to regular refreshes.
+type WatchingBridge interface {
+	Bridge
+
+	// Watch calls changed whenever the data of the bridge has changed.
+	// It blocks until ctx is closed.
+	Watch(ctx context.Context, changed func())
+}
+
+// NewHuegoBridge returns a Bridge that talks to the given huego bridge.
+func NewHuegoBridge(bridge *huego.Bridge) Bridge {
+	return huegoBridge{bridge: bridge}
+}
+
+// huegoBridge implements Bridge using huego
+type huegoBridge struct {
+	bridge *huego.Bridge
+}
+
+func (hb huegoBridge) Host() string {
+	return hb.bridge.Host
+}
+
+func (hb huegoBridge) GetGroups(ctx context.Context) ([]huego.Group, error) {
+	return hb.bridge.GetGroupsContext(ctx)
+}
+
+func (hb huegoBridge) GetGroup(ctx context.Context, id int) (*huego.Group, error) {
+	return hb.bridge.GetGroupContext(ctx, id)
+}
+
+func (hb huegoBridge) GetLights(ctx context.Context) ([]huego.Light, error) {
+	return hb.bridge.GetLightsContext(ctx)
+}
+
+func (hb huegoBridge) GetLight(ctx context.Context, id int) (*huego.Light, error) {
+	return hb.bridge.GetLightContext(ctx, id)
+}
+
+func (hb huegoBridge) GetScenes(ctx context.Context) ([]huego.Scene, error) {
+	return hb.bridge.GetScenesContext(ctx)
+}
+
+func (hb huegoBridge) GetScene(ctx context.Context, id string) (*huego.Scene, error) {
+	return hb.bridge.GetSceneContext(ctx, id)
+}
+
+func (hb huegoBridge) GetSensors(ctx context.Context) ([]huego.Sensor, error) {
+	return hb.bridge.GetSensorsContext(ctx)
+}
+
+func (hb huegoBridge) SetGroupState(ctx context.Context, id int, state huego.State) error {
+	_, err := hb.bridge.SetGroupStateContext(ctx, id, state)
+	return err
+}
+
+func (hb huegoBridge) SetLightState(ctx context.Context, id int, state huego.State) error {
+	_, err := hb.bridge.SetLightStateContext(ctx, id, state)
+	return err
+}
+
+func (hb huegoBridge) RecallScene(ctx context.Context, id string, group int, transition Transition) error {
+	// recalling via the group action allows a transition time, unlike the dedicated recall call.
+	_, err := hb.bridge.SetGroupStateContext(ctx, group, huego.State{On: true, Scene: id, TransitionTime: uint16(transition)})
+	return err
+}
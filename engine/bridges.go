@@ -0,0 +1,416 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NamedBridge is a bridge along with a human-readable name.
+// The name tells apart the results and actions of different bridges.
+type NamedBridge struct {
+	Name   string
+	Bridge Bridge
+}
+
+// engineBridge is a bridge connected to an engine, along with its index.
+// It is protected by the lock of the engine.
+type engineBridge struct {
+	NamedBridge
+
+	index    *Index
+	indexErr error
+
+	stale   bool      // index was loaded from the cache and has not been refreshed yet
+	updated time.Time // time the index was fetched from the bridge
+
+	state *IndexState // state last published for this bridge, nil if none was published
+
+	cancel context.CancelFunc // stops refreshing and watching the bridge
+}
+
+var ErrEngineUnknownBridge = errors.New("Engine: unknown bridge")
+
+// SetBridge replaces all bridges of this engine with the given bridge.
+func (engine *Engine) SetBridge(bridge Bridge) {
+	if bridge == nil {
+		panic("SetBridge: bridge is nil")
+	}
+
+	atomic.StoreUint32(&engine.readOnly, 1)
+
+	engine.l.Lock()
+	defer engine.l.Unlock()
+
+	for _, eb := range engine.bridges {
+		eb.stop()
+	}
+	engine.bridges = nil
+	engine.addBridge(NamedBridge{Bridge: bridge})
+}
+
+// AddBridge adds a bridge with the given name to this engine, and starts refreshing its index.
+// If the engine already has a bridge with the same name, it is replaced.
+func (engine *Engine) AddBridge(name string, bridge Bridge) {
+	if bridge == nil {
+		panic("AddBridge: bridge is nil")
+	}
+
+	atomic.StoreUint32(&engine.readOnly, 1)
+
+	engine.l.Lock()
+	defer engine.l.Unlock()
+
+	engine.addBridge(NamedBridge{Name: name, Bridge: bridge})
+}
+
+// addBridge adds a bridge to this engine, replacing any bridge of the same name, and loads its cached index.
+// It then starts refreshing the index of the bridge, see refreshLoop.
+// engine.l must be held.
+func (engine *Engine) addBridge(bridge NamedBridge) *engineBridge {
+	eb := &engineBridge{NamedBridge: bridge}
+
+	replaced := false
+	for i, other := range engine.bridges {
+		if other.Name == bridge.Name {
+			other.stop()
+			engine.bridges[i] = eb
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		engine.bridges = append(engine.bridges, eb)
+		engine.tagIndexes()
+	}
+
+	engine.loadCachedIndex(eb)
+
+	ctx, cancel := context.WithCancel(engine.Ctx)
+	eb.cancel = cancel
+
+	go engine.refreshLoop(ctx, eb)
+	if wb, ok := bridge.Bridge.(WatchingBridge); ok {
+		go engine.watchBridge(ctx, eb, wb)
+	}
+
+	return eb
+}
+
+// stop stops refreshing and watching this bridge
+func (eb *engineBridge) stop() {
+	if eb.cancel != nil {
+		eb.cancel()
+	}
+}
+
+// refreshLoop refreshes the index of the given bridge right away, and then every engine.RefreshInterval.
+// Each bridge is refreshed on its own schedule, so a slow bridge does not delay the others.
+//
+// refreshLoop blocks until ctx is closed.
+func (engine *Engine) refreshLoop(ctx context.Context, eb *engineBridge) {
+	engine.refreshBridge(eb)
+
+	if engine.RefreshInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(engine.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			engine.refreshBridge(eb)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchBridge watches the given bridge, and reindexes it whenever it changes.
+// Changes that occur while the bridge is being reindexed are coalesced.
+//
+// watchBridge blocks until ctx is closed.
+func (engine *Engine) watchBridge(ctx context.Context, eb *engineBridge, bridge WatchingBridge) {
+	changes := make(chan struct{}, 1)
+	go bridge.Watch(ctx, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+
+	for {
+		select {
+		case <-changes:
+			engine.reindexBridge(ctx, eb)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reindexBridge updates the index of a watched bridge after it has changed.
+// Unlike refreshBridge, it does not update the index cache.
+func (engine *Engine) reindexBridge(ctx context.Context, eb *engineBridge) {
+	engineLogger := engine.logger().With().Str("bridge", eb.Name).Logger()
+
+	index, err := NewIndex(eb.Bridge, engine.Ctx)
+	if err != nil {
+		engineLogger.Debug().Err(err).Msg("unable to update index")
+		return
+	}
+
+	engine.l.Lock()
+	defer engine.l.Unlock()
+
+	// bridge was removed in the meantime
+	if ctx.Err() != nil {
+		return
+	}
+
+	engine.setIndex(eb, index)
+	eb.indexErr = nil
+	eb.stale = false
+	eb.updated = time.Now()
+
+	engineLogger.Debug().Msg("index updated")
+	engine.publishState(eb)
+}
+
+// indexBridge returns the name of the given bridge to use in its index.
+// Results are only tagged with their bridge when the engine has several bridges.
+// engine.l must be held.
+func (engine *Engine) indexBridge(eb *engineBridge) string {
+	if len(engine.bridges) > 1 {
+		return eb.Name
+	}
+	return ""
+}
+
+// tagIndexes updates the bridge names of all existing indexes.
+// engine.l must be held.
+func (engine *Engine) tagIndexes() {
+	for _, eb := range engine.bridges {
+		if eb.index != nil {
+			index := *eb.index
+			index.Bridge = engine.indexBridge(eb)
+			eb.index = &index
+		}
+	}
+}
+
+// Bridges returns the names of the bridges of this engine, in the order they were added.
+func (engine *Engine) Bridges() []string {
+	engine.l.RLock()
+	defer engine.l.RUnlock()
+
+	names := make([]string, len(engine.bridges))
+	for i, eb := range engine.bridges {
+		names[i] = eb.Name
+	}
+	return names
+}
+
+// route returns the bridge with the given name.
+// The empty name refers to the first bridge.
+// engine.l must be held.
+func (engine *Engine) route(name string) (*engineBridge, error) {
+	if len(engine.bridges) == 0 {
+		return nil, ErrEngineMissingBridge
+	}
+	if name == "" {
+		return engine.bridges[0], nil
+	}
+	for _, eb := range engine.bridges {
+		if eb.Name == name {
+			return eb, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrEngineUnknownBridge, "%q", name)
+}
+
+// RefreshIndex refreshes the index of every bridge of this engine.
+// Bridges are refreshed concurrently, and a bridge that fails to refresh does not affect the others.
+//
+// Returns the first error that occured.
+func (engine *Engine) RefreshIndex() error {
+	_, errs, err := engine.refreshAll()
+	if err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshAll refreshes the index of every bridge of this engine.
+// It returns the refreshed bridges along with the error that occured for each of them.
+func (engine *Engine) refreshAll() ([]*engineBridge, []error, error) {
+	if cerr := engine.Ctx.Err(); cerr != nil {
+		return nil, nil, cerr
+	}
+
+	bridges := func() []*engineBridge {
+		engine.l.RLock()
+		defer engine.l.RUnlock()
+
+		return append([]*engineBridge(nil), engine.bridges...)
+	}()
+	if len(bridges) == 0 {
+		return nil, nil, ErrEngineMissingBridge
+	}
+
+	errs := make([]error, len(bridges))
+
+	var wg sync.WaitGroup
+	for i, eb := range bridges {
+		wg.Add(1)
+		go func(i int, eb *engineBridge) {
+			defer wg.Done()
+			errs[i] = engine.refreshBridge(eb)
+		}(i, eb)
+	}
+	wg.Wait()
+
+	return bridges, errs, nil
+}
+
+// refreshBridge refreshes the index of the given bridge
+func (engine *Engine) refreshBridge(eb *engineBridge) (err error) {
+	if cerr := engine.Ctx.Err(); cerr != nil {
+		return cerr
+	}
+
+	engineLogger := engine.logger().With().Str("bridge", eb.Name).Logger()
+
+	engineLogger.Info().Msg("refreshing index")
+	defer func() {
+		if err != nil {
+			engineLogger.Error().Err(err).Msg("index refresh failed")
+		} else {
+			engineLogger.Info().Msg("index refreshed")
+		}
+	}()
+
+	index, indexErr := NewIndex(eb.Bridge, engine.Ctx)
+
+	cache, err := engine.storeIndex(eb, index, indexErr)
+	if cache != nil {
+		if err := engine.writeCachedIndex(*cache); err != nil {
+			engineLogger.Warn().Err(err).Msg("unable to write index cache")
+		}
+	}
+	return err
+}
+
+// storeIndex stores a freshly fetched index of the given bridge and publishes it.
+// indexErr is the error that occured while fetching it.
+//
+// When the index should be cached, returns the index to cache.
+func (engine *Engine) storeIndex(eb *engineBridge, index Index, indexErr error) (cache *CachedIndex, err error) {
+	engine.l.Lock()
+	defer engine.l.Unlock()
+
+	defer func() {
+		engine.publish(Event{Kind: EventIndex, Bridge: engine.indexBridge(eb), Error: errorString(err)})
+	}()
+
+	// keep using a cached index until the bridge answers
+	if indexErr != nil && eb.stale && eb.index != nil {
+		return nil, indexErr
+	}
+
+	engine.setIndex(eb, index)
+	eb.indexErr = indexErr
+	eb.stale = false
+	eb.updated = time.Now()
+
+	if indexErr != nil {
+		return nil, indexErr
+	}
+
+	engine.publishState(eb)
+
+	if engine.IndexStore != nil {
+		cache = &CachedIndex{Host: eb.Bridge.Host(), Updated: eb.updated, Index: index}
+	}
+	return cache, nil
+}
+
+// writeCachedIndex writes the given index to the IndexStore of this engine.
+// engine.l should not be held, to not block queries while writing.
+func (engine *Engine) writeCachedIndex(cache CachedIndex) error {
+	engine.cl.Lock()
+	defer engine.cl.Unlock()
+
+	return engine.IndexStore.Write(cache)
+}
+
+// setIndex sets the index of the given bridge, including any user-defined data.
+// Macros are only added to the index of the bridge they are performed on.
+// engine.l must be held.
+func (engine *Engine) setIndex(eb *engineBridge, index Index) {
+	index.Macros = nil
+	for _, macro := range engine.macros {
+		if mb, err := engine.route(macro.Bridge); err == nil && mb == eb {
+			index.Macros = append(index.Macros, macro)
+		}
+	}
+	index.Bridge = engine.indexBridge(eb)
+	index.Aliases = engine.aliases
+	index.Usage = engine.Usage
+	index.GroupTypes = engine.GroupTypes
+	eb.index = &index
+}
+
+// loadCachedIndex loads the cached index of the given bridge, if any.
+// engine.l must be held.
+func (engine *Engine) loadCachedIndex(eb *engineBridge) {
+	if engine.IndexStore == nil {
+		return
+	}
+
+	engineLogger := engine.logger().With().Str("bridge", eb.Name).Logger()
+
+	cache, err := func() (*CachedIndex, error) {
+		engine.cl.Lock()
+		defer engine.cl.Unlock()
+
+		return engine.IndexStore.Read(eb.Bridge.Host())
+	}()
+	switch {
+	case err != nil:
+		engineLogger.Warn().Err(err).Msg("unable to read index cache")
+		return
+	case cache == nil:
+		return
+	}
+
+	engine.setIndex(eb, cache.Index)
+	eb.stale = true
+	eb.updated = cache.Updated
+
+	engineLogger.Info().Time("updated", cache.Updated).Msg("loaded index from cache")
+}
+
+// IndexStatus returns if any index was loaded from the cache and has not been refreshed yet, and the time the oldest index was fetched from its bridge.
+func (engine *Engine) IndexStatus() (stale bool, updated time.Time) {
+	engine.l.RLock()
+	defer engine.l.RUnlock()
+
+	for _, eb := range engine.bridges {
+		stale = stale || eb.stale
+		if !eb.updated.IsZero() && (updated.IsZero() || eb.updated.Before(updated)) {
+			updated = eb.updated
+		}
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+// slowBridge is a bridge that does not answer until its context is closed
+type slowBridge struct {
+	*MemoryBridge
+}
+
+func (slowBridge) GetGroups(ctx context.Context) ([]huego.Group, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// countingBridge is a bridge that counts how often its groups were fetched
+type countingBridge struct {
+	*MemoryBridge
+	count int32
+}
+
+func (cb *countingBridge) GetGroups(ctx context.Context) ([]huego.Group, error) {
+	atomic.AddInt32(&cb.count, 1)
+	return cb.MemoryBridge.GetGroups(ctx)
+}
+
+func TestEngine_RefreshInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	engine := &Engine{Ctx: ctx, RefreshInterval: 10 * time.Millisecond}
+
+	// a bridge that does not answer does not delay refreshing the others
+	fast := &countingBridge{MemoryBridge: NewMemoryBridge("fast", nil, nil, nil, nil)}
+	engine.AddBridge("slow", slowBridge{NewMemoryBridge("slow", nil, nil, nil, nil)})
+	engine.AddBridge("fast", fast)
+
+	deadline := time.After(5 * time.Second)
+	for atomic.LoadInt32(&fast.count) < 3 {
+		select {
+		case <-deadline:
+			t.Fatalf("bridge was refreshed %d time(s), want at least 3", atomic.LoadInt32(&fast.count))
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// lockCheckingStore is an IndexStore that reports if the lock of its engine is held while writing
+type lockCheckingStore struct {
+	engine *Engine
+	locked chan bool
+}
+
+func (lockCheckingStore) Read(host string) (*CachedIndex, error) { return nil, nil }
+
+func (store lockCheckingStore) Write(cache CachedIndex) error {
+	free := store.engine.l.TryLock()
+	if free {
+		store.engine.l.Unlock()
+	}
+	store.locked <- !free
+	return nil
+}
+
+func TestEngine_IndexStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	engine := &Engine{Ctx: ctx}
+	store := lockCheckingStore{engine: engine, locked: make(chan bool, 1)}
+	engine.IndexStore = store
+
+	engine.AddBridge("memory", newTestBridge())
+
+	select {
+	case locked := <-store.locked:
+		if locked {
+			t.Error("IndexStore.Write() called while the engine is locked")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("IndexStore.Write() was not called")
+	}
+}
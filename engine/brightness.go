@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Brightness represents the brightness of a light or group as understood by the hue api.
+// Valid brightness values are between [MinBrightness] and [MaxBrightness]; the zero value indicates no brightness.
+type Brightness uint8
+
+const (
+	BrightnessAny Brightness = 0
+	MinBrightness Brightness = 1
+	MaxBrightness Brightness = 254
+)
+
+// BrightnessFromPercent returns the brightness corresponding to the given percentage.
+// Percentages outside of (0, 100] are clamped to the range of valid brightness values.
+func BrightnessFromPercent(percent float64) Brightness {
+	bri := math.Round(percent * float64(MaxBrightness) / 100)
+	switch {
+	case bri < float64(MinBrightness):
+		return MinBrightness
+	case bri > float64(MaxBrightness):
+		return MaxBrightness
+	}
+	return Brightness(bri)
+}
+
+// Percent returns the percentage corresponding to this brightness.
+func (bri Brightness) Percent() int {
+	return int(math.Round(float64(bri) * 100 / float64(MaxBrightness)))
+}
+
+// Valid checks if this brightness can be sent to a hue bridge
+func (bri Brightness) Valid() bool {
+	return bri >= MinBrightness && bri <= MaxBrightness
+}
+
+func (bri Brightness) String() string {
+	return fmt.Sprintf("%d%%", bri.Percent())
+}
+
+// brightnessWords are words that represent specific brightness values
+var brightnessWords = []keyword[Brightness]{
+	{"min", MinBrightness},
+	{"dim", BrightnessFromPercent(20)},
+	{"low", BrightnessFromPercent(20)},
+	{"half", BrightnessFromPercent(50)},
+	{"medium", BrightnessFromPercent(50)},
+	{"bright", MaxBrightness},
+	{"full", MaxBrightness},
+	{"max", MaxBrightness},
+}
+
+// brightnessPrefixes are words that indicate an absolute brightness value
+var brightnessPrefixes = []string{"bri", "brightness"}
+
+// brightnessSuffixes are words that indicate a percentage
+var brightnessSuffixes = []string{"percent"}
+
+// ParseBrightness parses a brightness from the provided value.
+// It does not take brightness words into account.
+//
+// Supported formats are "40%" and "40 percent" for percentages,
+// and "bri 200" and "brightness 200" for absolute values.
+// Plain numbers are not brightness values, as they commonly occur in names.
+func ParseBrightness(value string) (Brightness, bool) {
+	fields := strings.Fields(strings.ToLower(value))
+	switch {
+	case len(fields) == 1 && strings.HasSuffix(fields[0], "%"):
+		return parsePercent(strings.TrimSuffix(fields[0], "%"))
+	case len(fields) == 2 && hasWord(brightnessSuffixes, fields[1]):
+		return parsePercent(fields[0])
+	case len(fields) == 2 && hasWord(brightnessPrefixes, fields[0]):
+		bri, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil || !Brightness(bri).Valid() {
+			return BrightnessAny, false
+		}
+		return Brightness(bri), true
+	}
+	return BrightnessAny, false
+}
+
+// parsePercent parses a percentage into a brightness
+func parsePercent(value string) (Brightness, bool) {
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return BrightnessAny, false
+	}
+	return BrightnessFromPercent(percent), true
+}
+
+// hasWord checks if words contains word
+func hasWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package engine
+
+import "testing"
+
+func TestParseBrightness(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   Brightness
+		wantOK bool
+	}{
+		{"40%", BrightnessFromPercent(40), true},
+		{"100%", MaxBrightness, true},
+		{"0.1%", MinBrightness, true},
+		{"40 percent", BrightnessFromPercent(40), true},
+		{"40 Percent", BrightnessFromPercent(40), true},
+		{"bri 200", 200, true},
+		{"Brightness 1", MinBrightness, true},
+
+		// plain numbers commonly occur in names
+		{"40", BrightnessAny, false},
+		{"7", BrightnessAny, false},
+
+		// out of range
+		{"0%", BrightnessAny, false},
+		{"101%", BrightnessAny, false},
+		{"bri 0", BrightnessAny, false},
+		{"bri 255", BrightnessAny, false},
+		{"bri 40%", BrightnessAny, false},
+
+		// not a brightness
+		{"", BrightnessAny, false},
+		{"%", BrightnessAny, false},
+		{"percent", BrightnessAny, false},
+		{"kitchen 40%", BrightnessAny, false},
+		{"40 kitchen", BrightnessAny, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := ParseBrightness(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ParseBrightness() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+// CachedIndex is an index along with information about when and where it was fetched.
+// It is used to provide results immediatly after startup, before the bridge has been queried.
+type CachedIndex struct {
+	Host    string    // the host of the bridge the index was fetched from
+	Updated time.Time // the time the index was fetched at
+
+	Index Index // macros, aliases, usage and group types are not cached
+}
+
+// cachedIndexJSON is the JSON representation of a CachedIndex.
+// Objects are stored by id, as the hue types do not marshal their ids.
+type cachedIndexJSON struct {
+	Host    string    `json:"host"`
+	Updated time.Time `json:"updated"`
+
+	Groups  map[string]huego.Group  `json:"groups"`
+	Lights  map[string]huego.Light  `json:"lights"`
+	Scenes  map[string]huego.Scene  `json:"scenes"`
+	Sensors map[string]huego.Sensor `json:"sensors"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (cache CachedIndex) MarshalJSON() ([]byte, error) {
+	data := cachedIndexJSON{
+		Host:    cache.Host,
+		Updated: cache.Updated,
+
+		Groups:  make(map[string]huego.Group, len(cache.Index.Groups)),
+		Lights:  make(map[string]huego.Light, len(cache.Index.Lights)),
+		Scenes:  make(map[string]huego.Scene, len(cache.Index.Scenes)),
+		Sensors: make(map[string]huego.Sensor, len(cache.Index.Sensors)),
+	}
+	for _, g := range cache.Index.Groups {
+		data.Groups[strconv.Itoa(g.ID)] = g
+	}
+	for _, l := range cache.Index.Lights {
+		data.Lights[strconv.Itoa(l.ID)] = l
+	}
+	for _, s := range cache.Index.Scenes {
+		data.Scenes[s.ID] = s
+	}
+	for _, s := range cache.Index.Sensors {
+		data.Sensors[strconv.Itoa(s.ID)] = s
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (cache *CachedIndex) UnmarshalJSON(bytes []byte) error {
+	var data cachedIndexJSON
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		return err
+	}
+
+	cache.Host = data.Host
+	cache.Updated = data.Updated
+	cache.Index = Index{}
+
+	for id, g := range data.Groups {
+		var err error
+		if g.ID, err = strconv.Atoi(id); err != nil {
+			return err
+		}
+		cache.Index.Groups = append(cache.Index.Groups, g)
+	}
+	for id, l := range data.Lights {
+		var err error
+		if l.ID, err = strconv.Atoi(id); err != nil {
+			return err
+		}
+		cache.Index.Lights = append(cache.Index.Lights, l)
+	}
+	for id, s := range data.Scenes {
+		s.ID = id
+		cache.Index.Scenes = append(cache.Index.Scenes, s)
+	}
+	for id, s := range data.Sensors {
+		var err error
+		if s.ID, err = strconv.Atoi(id); err != nil {
+			return err
+		}
+		cache.Index.Sensors = append(cache.Index.Sensors, s)
+	}
+
+	// maps are unordered, so restore the order of the bridge
+	sort.Slice(cache.Index.Groups, func(i, j int) bool { return cache.Index.Groups[i].ID < cache.Index.Groups[j].ID })
+	sort.Slice(cache.Index.Lights, func(i, j int) bool { return cache.Index.Lights[i].ID < cache.Index.Lights[j].ID })
+	sort.Slice(cache.Index.Scenes, func(i, j int) bool { return cache.Index.Scenes[i].ID < cache.Index.Scenes[j].ID })
+	sort.Slice(cache.Index.Sensors, func(i, j int) bool { return cache.Index.Sensors[i].ID < cache.Index.Sensors[j].ID })
+
+	return nil
+}
+
+// IndexStore reads and writes cached indexes, one for each bridge
+type IndexStore interface {
+	// Read reads the cached index of the bridge with the given host from this store.
+	// When no index is cached, returns nil.
+	Read(host string) (*CachedIndex, error)
+
+	// Write writes an index to this store, replacing any existing one of the same host.
+	Write(cache CachedIndex) error
+}
+
+// JSONFileIndexStore stores cached indexes in the provided JSON file on disk.
+// Implements IndexStore.
+type JSONFileIndexStore string
+
+// Read reads the cached index of the given host from the provided filename on disk.
+//
+// When the file does not exist, the store is considered empty.
+func (f JSONFileIndexStore) Read(host string) (*CachedIndex, error) {
+	caches, err := f.readAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, cache := range caches {
+		if cache.Host == host {
+			return &cache, nil
+		}
+	}
+	return nil, nil
+}
+
+// readAll reads all cached indexes from the provided filename on disk.
+// The file holds a JSON array of indexes, one for each host.
+func (f JSONFileIndexStore) readAll() (caches []CachedIndex, err error) {
+	h, err := os.Open(string(f))
+	if err != nil {
+		// file does not exist, meaning the store it empty
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer h.Close()
+
+	err = json.NewDecoder(h).Decode(&caches)
+	return caches, err
+}
+
+// Write writes the cached index to the provided filename on disk, keeping the indexes of other hosts.
+// Unreadable existing files are overwritten.
+//
+// When creating a new file, uses chmod 0600 to prevent other users from accessing the file.
+func (f JSONFileIndexStore) Write(cache CachedIndex) error {
+	caches, _ := f.readAll()
+
+	replaced := false
+	for i, other := range caches {
+		if other.Host == cache.Host {
+			caches[i] = cache
+			replaced = true
+		}
+	}
+	if !replaced {
+		caches = append(caches, cache)
+	}
+
+	h, err := os.OpenFile(string(f), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	return json.NewEncoder(h).Encode(caches)
+}
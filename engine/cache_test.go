@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+func TestJSONFileIndexStore(t *testing.T) {
+	store := JSONFileIndexStore(filepath.Join(t.TempDir(), "index.json"))
+
+	if cache, err := store.Read("bridge1"); cache != nil || err != nil {
+		t.Fatalf("Read() = %v, %v, want nil, nil on a missing file", cache, err)
+	}
+
+	updated := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	first := CachedIndex{Host: "bridge1", Updated: updated, Index: Index{
+		Groups: []huego.Group{{ID: 1, Name: "Kitchen"}, {ID: 2, Name: "Hallway"}},
+		Lights: []huego.Light{{ID: 3, Name: "Hallway Spot"}},
+		Scenes: []huego.Scene{{ID: "relax-scene", Name: "Relax"}},
+	}}
+	second := CachedIndex{Host: "bridge2", Updated: updated, Index: Index{
+		Lights: []huego.Light{{ID: 1, Name: "Desk"}},
+	}}
+
+	for _, cache := range []CachedIndex{first, second, first} {
+		if err := store.Write(cache); err != nil {
+			t.Fatalf("Write() err = %v", err)
+		}
+	}
+
+	for _, want := range []CachedIndex{first, second} {
+		got, err := store.Read(want.Host)
+		if err != nil {
+			t.Fatalf("Read(%q) err = %v", want.Host, err)
+		}
+		if got == nil || !reflect.DeepEqual(*got, want) {
+			t.Errorf("Read(%q) = %v, want %v", want.Host, got, want)
+		}
+	}
+
+	// a file holding a single index, rather than an array of indexes, is not supported
+	if err := os.WriteFile(string(store), []byte(`{"host":"bridge1","groups":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Read("bridge1"); err == nil {
+		t.Error("Read() err = nil, want error for a single index")
+	}
+}
@@ -1,7 +1,9 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"sync"
 
 	"github.com/amimof/huego"
@@ -10,7 +12,11 @@ import (
 // HueGroup represents a hue group
 type HueGroup struct {
 	ID   int         `json:"id"`
+	Type GroupType   `json:"type"`
 	Data huego.Group `json:"data"`
+
+	Aliases []string `json:"-"`               // additional names of this group
+	Alias   string   `json:"alias,omitempty"` // the alias matched by a query, if any
 }
 
 // NewHueGroup creates a new hue group.
@@ -19,7 +25,9 @@ type HueGroup struct {
 func NewHueGroup(group huego.Group) *HueGroup {
 	g := groupPool.Get().(*HueGroup)
 	g.ID = group.ID
+	g.Type = GroupTypeOf(group)
 	g.Data = group
+	g.Aliases, g.Alias = nil, ""
 	return g
 }
 
@@ -42,11 +50,21 @@ func (group *HueGroup) UnmarshalJSON(data []byte) error {
 	return err
 }
 
+// title returns a human-readable title of this group, including its type
+func (group *HueGroup) title() string {
+	if group.Type == GroupAll {
+		return AllLightsName
+	}
+	return fmt.Sprintf("%s %q", group.Type.Title(), group.Data.Name)
+}
+
 // Refresh reloads data about this group from a bridge
-func (group *HueGroup) Refresh(bridge *huego.Bridge) error {
-	data, err := bridge.GetGroup(group.ID)
+func (group *HueGroup) Refresh(bridge Bridge) error {
+	data, err := bridge.GetGroup(context.Background(), group.ID)
 	if data != nil {
+		normalizeAllLights(data)
 		group.Data = *data
+		group.Type = GroupTypeOf(*data)
 	}
 	return err
 }
@@ -55,6 +73,9 @@ func (group *HueGroup) Refresh(bridge *huego.Bridge) error {
 type HueLight struct {
 	ID   int         `json:"id"`
 	Data huego.Light `json:"data"`
+
+	Aliases []string `json:"-"`               // additional names of this light
+	Alias   string   `json:"alias,omitempty"` // the alias matched by a query, if any
 }
 
 // NewHueLight creates a new hue light.
@@ -64,6 +85,7 @@ func NewHueLight(light huego.Light) *HueLight {
 	l := lightPool.Get().(*HueLight)
 	l.ID = light.ID
 	l.Data = light
+	l.Aliases, l.Alias = nil, ""
 	return l
 }
 
@@ -87,8 +109,8 @@ func (light *HueLight) UnmarshalJSON(data []byte) error {
 }
 
 // Refresh reloads data about this light from a bridge
-func (light *HueLight) Refresh(bridge *huego.Bridge) error {
-	data, err := bridge.GetLight(light.ID)
+func (light *HueLight) Refresh(bridge Bridge) error {
+	data, err := bridge.GetLight(context.Background(), light.ID)
 	if data != nil {
 		light.Data = *data
 	}
@@ -99,6 +121,9 @@ func (light *HueLight) Refresh(bridge *huego.Bridge) error {
 type HueScene struct {
 	ID   string      `json:"id"`
 	Data huego.Scene `json:"data"`
+
+	Aliases []string `json:"-"`               // additional names of this scene
+	Alias   string   `json:"alias,omitempty"` // the alias matched by a query, if any
 }
 
 // NewHueScene creates a new hue scene.
@@ -108,6 +133,7 @@ func NewHueScene(scene huego.Scene) *HueScene {
 	s := scenePool.Get().(*HueScene)
 	s.ID = scene.ID
 	s.Data = scene
+	s.Aliases, s.Alias = nil, ""
 	return s
 }
 
@@ -131,8 +157,8 @@ func (scene *HueScene) UnmarshalJSON(data []byte) error {
 }
 
 // Refresh reloads data about this scene from a bridge
-func (scene *HueScene) Refresh(bridge *huego.Bridge) error {
-	data, err := bridge.GetScene(scene.ID)
+func (scene *HueScene) Refresh(bridge Bridge) error {
+	data, err := bridge.GetScene(context.Background(), scene.ID)
 	if data != nil {
 		scene.Data = *data
 	}
@@ -0,0 +1,57 @@
+package engine
+
+// Effect represents a dynamic effect or alert of a light or group
+type Effect string
+
+const (
+	EffectAny       Effect = ""
+	EffectColorloop Effect = "colorloop" // cycle through all colors
+	EffectBreathe   Effect = "breathe"   // breathe for 15 seconds
+	EffectFlash     Effect = "flash"     // breathe once
+	EffectStop      Effect = "stop"      // stop any running effects
+)
+
+// effectWords are words that correspond to specific effects
+var effectWords = []keyword[Effect]{
+	{"colorloop", EffectColorloop},
+	{"color loop", EffectColorloop},
+	{"breathe", EffectBreathe},
+	{"flash", EffectFlash},
+	{"blink", EffectFlash},
+	{"identify", EffectFlash},
+	{"stop effects", EffectStop},
+	{"stop", EffectStop},
+}
+
+// Valid checks if this effect is known
+func (effect Effect) Valid() bool {
+	switch effect {
+	case EffectColorloop, EffectBreathe, EffectFlash, EffectStop:
+		return true
+	}
+	return false
+}
+
+// hue api values for the effect and alert fields
+const (
+	hueEffectNone      = "none"
+	hueEffectColorloop = "colorloop"
+	hueAlertNone       = "none"
+	hueAlertSelect     = "select"
+	hueAlertLSelect    = "lselect"
+)
+
+// apply returns the effect and alert fields to be sent to the hue api
+func (effect Effect) apply() (hueEffect string, hueAlert string) {
+	switch effect {
+	case EffectColorloop:
+		return hueEffectColorloop, ""
+	case EffectBreathe:
+		return "", hueAlertLSelect
+	case EffectFlash:
+		return "", hueAlertSelect
+	case EffectStop:
+		return hueEffectNone, hueAlertNone
+	}
+	return "", ""
+}
@@ -4,10 +4,12 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/amimof/huego"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 )
@@ -18,18 +20,48 @@ type Engine struct {
 
 	Ctx context.Context
 
-	// Connect is a user-defined function to connect to a bridge
-	Connect func() (bridge *huego.Bridge, err error)
+	// Connect is a user-defined function to connect to one or more bridges
+	Connect func() (bridges []NamedBridge, err error)
 
-	bridge *huego.Bridge // bridge is the current bridge
+	// bridges are the current bridges, each with their own index.
+	// Actions without a bridge are performed on the first one.
+	bridges []*engineBridge
 
-	index    *Index
-	indexErr error
+	// RefreshInterval is how often the index of each bridge is refreshed.
+	// Each bridge is refreshed on its own schedule, starting when it is added.
+	// RefreshInterval <= 0 indicates that indexes are only refreshed by RefreshIndex.
+	RefreshInterval time.Duration
+
+	// IndexStore is used to cache the indexes between restarts.
+	// When nil, indexes are not cached.
+	IndexStore IndexStore
+	cl         sync.Mutex // cl serializes access to IndexStore
+
+	macros  []Macro // user-defined macros
+	aliases Aliases // user-defined aliases
+
+	// GroupTypes are the types of groups that can be searched.
+	// When nil, DefaultGroupTypes is used.
+	GroupTypes []GroupType
+
+	// History holds snapshots of lights before actions were performed
+	History History
+
+	// Usage records performed actions, and is used to boost frequently used ones.
+	// When nil, actions are not recorded or boosted.
+	Usage *UsageStats
+
+	// Scheduler holds delayed and timed actions.
+	// When nil, scheduled actions are not supported.
+	Scheduler *Scheduler
+
+	sl          sync.Mutex              // sl protects subscribers
+	subscribers map[chan Event]struct{} // subscribers to events, see Subscribe
 }
 
 // NewEngine creates a new engine with the given context and bridge.
 // If bridge is nil, the bridge is not set.
-func NewEngine(bridge *huego.Bridge, ctx context.Context) *Engine {
+func NewEngine(bridge Bridge, ctx context.Context) *Engine {
 	engine := &Engine{
 		Ctx: ctx,
 	}
@@ -43,88 +75,129 @@ func (engine *Engine) logger() zerolog.Logger {
 	return zerolog.Ctx(engine.Ctx).With().Str("component", "engine.Engine").Logger()
 }
 
-// RefreshIndex refreshes the index on this engine
-func (engine *Engine) RefreshIndex() (err error) {
-	if cerr := engine.Ctx.Err(); cerr != nil {
-		return cerr
-	}
-
-	engineLogger := engine.logger()
-
-	engineLogger.Info().Msg("refreshing index")
-	defer func() {
-		if err != nil {
-			engineLogger.Error().Err(err).Msg("index refresh failed")
-		} else {
-			engineLogger.Info().Msg("index refreshed")
-		}
-	}()
-
-	bridge, err := func() (*huego.Bridge, error) {
-		engine.l.RLock()
-		defer engine.l.RUnlock()
+// SetMacros sets the user-defined macros of this engine.
+// They are immediatly available to queries.
+func (engine *Engine) SetMacros(macros []Macro) {
+	engine.l.Lock()
+	defer engine.l.Unlock()
 
-		if engine.bridge == nil {
-			return nil, ErrEngineMissingBridge
+	engine.macros = macros
+	for _, eb := range engine.bridges {
+		if eb.index != nil {
+			engine.setIndex(eb, *eb.index)
 		}
-
-		return engine.bridge, nil
-	}()
-	if err != nil {
-		return err
 	}
+}
 
-	index, indexErr := NewIndex(bridge, engine.Ctx)
-
+// SetAliases sets the user-defined aliases of this engine.
+// They are immediatly available to queries.
+func (engine *Engine) SetAliases(aliases Aliases) {
 	engine.l.Lock()
 	defer engine.l.Unlock()
 
-	engine.index = &index
-	engine.indexErr = indexErr
-
-	return engine.indexErr
+	engine.setAliases(aliases)
 }
 
-func (engine *Engine) SetBridge(bridge *huego.Bridge) {
-	if bridge == nil {
-		panic("SetBridge: bridge is nil")
-	}
-
-	atomic.StoreUint32(&engine.readOnly, 1)
-
+// UpdateAliases atomically updates the user-defined aliases of this engine.
+//
+// update is called with the current aliases while the engine is locked, and should return the new aliases.
+// When update returns an error, the aliases are left unchanged and the error is returned.
+func (engine *Engine) UpdateAliases(update func(aliases Aliases) (Aliases, error)) (Aliases, error) {
 	engine.l.Lock()
 	defer engine.l.Unlock()
 
-	engine.bridge = bridge
-	engine.index = nil
-	engine.indexErr = nil
+	aliases, err := update(engine.aliases)
+	if err != nil {
+		return engine.aliases, err
+	}
+	engine.setAliases(aliases)
+	return aliases, nil
+}
+
+// setAliases sets the user-defined aliases of this engine.
+// engine.l must be held.
+func (engine *Engine) setAliases(aliases Aliases) {
+	engine.aliases = aliases
+	for _, eb := range engine.bridges {
+		if eb.index != nil {
+			index := *eb.index
+			index.Aliases = aliases
+			eb.index = &index
+		}
+	}
+}
+
+// Aliases returns the user-defined aliases of this engine
+func (engine *Engine) Aliases() Aliases {
+	engine.l.RLock()
+	defer engine.l.RUnlock()
 
-	go engine.RefreshIndex()
+	return engine.aliases
 }
 
 var ErrEngineMissingIndex = errors.New("Engine: missing index")
-var ErrEngineMissingBridge = errors.New("Engine: missing index")
+var ErrEngineMissingBridge = errors.New("Engine: missing bridge")
 
-// Query queries the engine
-func (engine *Engine) Query(input string) ([]Action, []BufferScore, []Score, error) {
+// Query queries the engine.
+// The vocabulary of the given locales is used in addition to English.
+//
+// When the engine has several bridges, results of all bridges are merged and tagged with the name of their bridge.
+// Bridges that have no usable index are skipped, unless no bridge has one.
+func (engine *Engine) Query(input string, locales LocaleSet) ([]Action, []BufferScore, []Score, error) {
 
 	engine.l.RLock()
 	defer engine.l.RUnlock()
 
-	if engine.bridge == nil {
+	if len(engine.bridges) == 0 {
 		actions, matches, scores := engine.linkSpecial(input)
 		return actions, matches, scores, nil
 	}
 
-	if engine.index == nil {
-		return nil, nil, nil, ErrEngineMissingIndex
+	var actions []Action
+	var matches []BufferScore
+	var scores []Score
+
+	var err error
+	var ok bool
+	for _, eb := range engine.bridges {
+		switch {
+		case eb.index == nil:
+			err = ErrEngineMissingIndex
+			continue
+		case eb.indexErr != nil:
+			err = eb.indexErr
+			continue
+		}
+		ok = true
+
+		bActions, bMatches, bScores := eb.index.QueryString(input, locales)
+
+		actions = append(actions, bActions...)
+		matches = append(matches, bMatches...)
+		scores = append(scores, bScores...)
+	}
+	if !ok {
+		return nil, nil, nil, err
+	}
+
+	if len(engine.bridges) > 1 {
+		merged := &Results{actions: actions, actionScores: matches, scores: scores}
+		actions, matches, scores = merged.Results()
 	}
 
-	if engine.indexErr != nil {
-		return nil, nil, nil, engine.indexErr
+	// pending jobs come before regular actions
+	jActions, jMatches, jScores := engine.jobSpecials(input)
+	actions = append(jActions, actions...)
+	matches = append(jMatches, matches...)
+	scores = append(jScores, scores...)
+
+	// the undo action always comes first
+	if action, match, score, ok := engine.undoSpecial(input); ok {
+		actions = append([]Action{action}, actions...)
+		matches = append([]BufferScore{match}, matches...)
+		scores = append([]Score{score}, scores...)
 	}
 
-	actions, matches, scores := engine.index.QueryString(input)
 	return actions, matches, scores, nil
 }
 
@@ -132,6 +205,23 @@ func (engine *Engine) Query(input string) ([]Action, []BufferScore, []Score, err
 func (engine *Engine) Do(action Action) error {
 	engine.logDo(action)
 
+	done, err := engine.do(&action)
+
+	// usage is recorded without holding engine.l, as it may have to wait for the disk
+	if done && err == nil && engine.Usage != nil {
+		if uErr := engine.Usage.Record(action, time.Now()); uErr != nil {
+			engineLogger := engine.logger()
+			engineLogger.Warn().Err(uErr).Msg("unable to record usage")
+		}
+	}
+
+	return err
+}
+
+// do performs the provided action while holding engine.l.
+// It returns if the action was performed on a bridge.
+// Macros are resolved in place.
+func (engine *Engine) do(action *Action) (done bool, err error) {
 	var writelock bool
 	if atomic.LoadUint32(&engine.readOnly) == 0 {
 		writelock = true
@@ -144,10 +234,53 @@ func (engine *Engine) Do(action Action) error {
 	}
 
 	if action.Special != nil {
-		return engine.doSpecial(action.Special, writelock)
+		return false, engine.doSpecial(action.Special, writelock)
+	}
+
+	if action.ReadOnly() {
+		return false, ErrReadOnlyAction
+	}
+
+	if action.Schedule != nil {
+		return false, engine.schedule(*action)
+	}
+
+	// macros are always performed on their own bridge
+	if action.Macro != nil {
+		if err := action.Macro.Resolve(engine.macros); err != nil {
+			return false, err
+		}
+		action.Bridge = action.Macro.Data.Bridge
 	}
 
-	return action.Do(engine.bridge)
+	eb, err := engine.route(action.Bridge)
+	if err != nil {
+		return false, err
+	}
+
+	// take a snapshot to be able to undo the action later
+	snapshot, snapErr := NewSnapshot(eb.Bridge, *action)
+	if snapErr != nil {
+		engineLogger := engine.logger()
+		engineLogger.Warn().Err(snapErr).Msg("unable to take snapshot, action can not be undone")
+	}
+
+	err = action.Do(eb.Bridge)
+	if err == nil && snapErr == nil {
+		engine.History.Push(snapshot)
+	}
+	engine.publish(Event{Kind: EventAction, Bridge: engine.indexBridge(eb), Action: action, Error: errorString(err)})
+	engine.changed(eb)
+
+	var ce CompositeError
+	if errors.As(err, &ce) {
+		engineLogger := engine.logger()
+		for _, te := range ce {
+			engineLogger.Error().Err(te.Err).Stringer("target", te.Action).Msg("action failed for target")
+		}
+	}
+
+	return true, err
 }
 
 func (engine *Engine) logDo(action Action) error {
@@ -161,6 +294,44 @@ func (engine *Engine) logDo(action Action) error {
 	return nil
 }
 
+// State refreshes the indexes and returns the normalized state of every object in them.
+// When the engine has several bridges, objects are tagged with the name of their bridge, and bridges that fail to refresh are skipped.
+func (engine *Engine) State() (IndexState, error) {
+	bridges, errs, err := engine.refreshAll()
+	if err != nil {
+		return IndexState{}, err
+	}
+
+	engine.l.RLock()
+	defer engine.l.RUnlock()
+
+	var state IndexState
+	var ok bool
+	for i, eb := range bridges {
+		if errs[i] != nil {
+			err = errs[i]
+			continue
+		}
+		if eb.index == nil {
+			err = ErrEngineMissingIndex
+			continue
+		}
+		ok = true
+
+		bState := eb.index.State()
+		if len(bridges) > 1 {
+			bState.Tag(eb.Name)
+		}
+		state.Groups = append(state.Groups, bState.Groups...)
+		state.Lights = append(state.Lights, bState.Lights...)
+		state.Sensors = append(state.Sensors, bState.Sensors...)
+	}
+	if !ok {
+		return IndexState{}, err
+	}
+	return state, nil
+}
+
 var ErrEngineInvalidSpecial = errors.New("Engine: invalid special action")
 var ErrEngineNoConnect = errors.New("Engine: No Connect function")
 
@@ -168,10 +339,95 @@ func (engine *Engine) doSpecial(special *HueSpecial, writeLock bool) error {
 	switch special.ID {
 	case linkAction.ID:
 		return engine.linkInternal(true)
+	case undoAction.ID:
+		return engine.undoInternal()
+	case cancelAction.ID:
+		if engine.Scheduler == nil {
+			return ErrEngineNoScheduler
+		}
+		return engine.Scheduler.Cancel(special.Data.Job)
 	}
 	return ErrEngineInvalidSpecial
 }
 
+var ErrEngineNoScheduler = errors.New("Engine: no scheduler")
+
+// schedule schedules the given action using the scheduler
+func (engine *Engine) schedule(action Action) error {
+	if engine.Scheduler == nil {
+		return ErrEngineNoScheduler
+	}
+
+	at, err := action.Schedule.Next(time.Now())
+	if err != nil {
+		return err
+	}
+
+	job, err := engine.Scheduler.Add(action, at)
+	if err != nil {
+		return err
+	}
+
+	engineLogger := engine.logger()
+	engineLogger.Info().Str("job", job.ID).Time("time", job.Time).Msg("scheduled action")
+	return nil
+}
+
+// RunScheduler performs scheduled actions until the context of the engine is closed.
+// If the engine has no scheduler, returns immediately.
+func (engine *Engine) RunScheduler() {
+	if engine.Scheduler == nil {
+		return
+	}
+	engine.Scheduler.Run(engine.Ctx, engine.Do)
+}
+
+var ErrEngineNothingToUndo = errors.New("Engine: nothing to undo")
+
+// Undo restores the lights affected by the most recent action to their previous state.
+func (engine *Engine) Undo() error {
+	engine.l.RLock()
+	defer engine.l.RUnlock()
+
+	return engine.undoInternal()
+}
+
+func (engine *Engine) undoInternal() error {
+	if len(engine.bridges) == 0 {
+		return ErrEngineMissingBridge
+	}
+
+	snapshot, ok := engine.History.Pop()
+	if !ok {
+		return ErrEngineNothingToUndo
+	}
+
+	eb, err := engine.route(snapshot.Action.Bridge)
+	if err != nil {
+		return err
+	}
+
+	engineLogger := engine.logger()
+	engineLogger.Info().Stringer("action", snapshot.Action).Time("time", snapshot.Time).Msg("undoing action")
+
+	if err := snapshot.Restore(eb.Bridge); err != nil {
+		engine.History.Push(snapshot)
+		return err
+	}
+	engine.publish(Event{Kind: EventAction, Bridge: engine.indexBridge(eb), Action: &snapshot.Action, Undo: true})
+	engine.changed(eb)
+	return nil
+}
+
+// changed is called after the engine has changed lights of the given bridge.
+// Bridges that are not watched are refreshed, so that the new state is published.
+func (engine *Engine) changed(eb *engineBridge) {
+	if _, ok := eb.Bridge.(WatchingBridge); ok {
+		return
+	}
+	go engine.refreshBridge(eb)
+}
+
 // Link links the engine
 func (engine *Engine) Link() error {
 	engine.l.Lock()
@@ -187,7 +443,7 @@ func (engine *Engine) linkInternal(writeLock bool) error {
 		return ErrEngineInvalidSpecial
 	}
 
-	if engine.bridge != nil {
+	if len(engine.bridges) > 0 {
 		return nil
 	}
 
@@ -195,15 +451,21 @@ func (engine *Engine) linkInternal(writeLock bool) error {
 		return ErrEngineNoConnect
 	}
 
-	bridge, err := engine.Connect()
+	bridges, err := engine.Connect()
+	if err == nil && len(bridges) == 0 {
+		err = ErrEngineMissingBridge
+	}
+
+	linked := err == nil
+	engine.publish(Event{Kind: EventLink, Linked: &linked, Error: errorString(err)})
 	if err != nil {
 		return err
 	}
 
 	atomic.StoreUint32(&engine.readOnly, 1)
-	engine.bridge = bridge
-
-	go engine.RefreshIndex()
+	for _, bridge := range bridges {
+		engine.addBridge(bridge)
+	}
 
 	return nil
 }
@@ -212,9 +474,70 @@ var linkAction HueSpecial
 var linkScores Score
 var linkMatchScore BufferScore
 
+var undoAction HueSpecial
+var cancelAction HueSpecial
+
 func init() {
 	linkAction.ID = "link"
 	linkAction.Data.Message = "Link Hue Bridge"
+
+	undoAction.ID = "undo"
+	undoAction.Data.Message = "Undo last action"
+
+	cancelAction.ID = "cancel"
+}
+
+// jobKeywords are words that list pending jobs
+var jobKeywords = []string{"cancel", "jobs", "scheduled"}
+
+// jobSpecials returns an action to cancel each pending job if the input matches one of jobKeywords.
+func (engine *Engine) jobSpecials(input string) (actions []Action, matches []BufferScore, scores []Score) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" || engine.Scheduler == nil {
+		return
+	}
+
+	var matched bool
+	for _, keyword := range jobKeywords {
+		if strings.HasPrefix(keyword, input) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return
+	}
+
+	jobs, err := engine.Scheduler.Jobs()
+	if err != nil {
+		return
+	}
+
+	for _, job := range jobs {
+		special := &HueSpecial{ID: cancelAction.ID}
+		special.Data.Message = fmt.Sprintf("Cancel: %s (%s)", job.Description, job.Time.Format(time.Stamp))
+		special.Data.Job = job.ID
+
+		action := Action{Special: special}
+		match := BufferScore{{0}}
+
+		actions = append(actions, action)
+		matches = append(matches, match)
+		scores = append(scores, action.Score(match))
+	}
+	return
+}
+
+// undoSpecial returns the undo action if the input matches it and there is anything to undo.
+func (engine *Engine) undoSpecial(input string) (Action, BufferScore, Score, bool) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" || !strings.HasPrefix(undoAction.ID, input) || engine.History.Len() == 0 {
+		return Action{}, nil, Score{}, false
+	}
+
+	action := Action{Special: &undoAction}
+	matchScore := BufferScore{{scoreText(input, undoAction.ID)}}
+	return action, matchScore, action.Score(matchScore), true
 }
 
 func (engine *Engine) linkSpecial(input string) ([]Action, []BufferScore, []Score) {
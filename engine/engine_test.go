@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+// newTestEngine returns a new engine using the bridge returned by newTestBridge, along with the bridge
+func newTestEngine(t *testing.T) (*Engine, *MemoryBridge) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	bridge := newTestBridge()
+	engine := NewEngine(bridge, ctx)
+	if err := engine.RefreshIndex(); err != nil {
+		t.Fatalf("RefreshIndex() err = %v", err)
+	}
+	return engine, bridge
+}
+
+// doQuery queries the engine and performs the most relevant result accepted by match
+func doQuery(t *testing.T, engine *Engine, input string, match func(action Action) bool) Action {
+	t.Helper()
+
+	actions, _, _, err := engine.Query(input, 0)
+	if err != nil {
+		t.Fatalf("Query(%q) err = %v", input, err)
+	}
+
+	// the most relevant results come first
+	for _, action := range actions {
+		if !match(action) {
+			continue
+		}
+		if err := engine.Do(action); err != nil {
+			t.Fatalf("Do(%s) err = %v", action, err)
+		}
+		return action
+	}
+
+	t.Fatalf("Query(%q) returned no matching action", input)
+	return Action{}
+}
+
+// isLight returns a function matching actions on the light with the given id
+func isLight(id int, match func(action Action) bool) func(action Action) bool {
+	return func(action Action) bool {
+		return action.Light != nil && action.Light.ID == id && match(action)
+	}
+}
+
+// isGroup returns a function matching actions on the group with the given id
+func isGroup(id int, match func(action Action) bool) func(action Action) bool {
+	return func(action Action) bool {
+		return action.Group != nil && action.Group.ID == id && match(action)
+	}
+}
+
+// isOnOff returns a function matching actions turning their target on or off
+func isOnOff(onoff BoolOnOff) func(action Action) bool {
+	return func(action Action) bool {
+		return action.OnOff == onoff
+	}
+}
+
+// lightState returns the current state of the light with the given id
+func lightState(t *testing.T, bridge Bridge, id int) huego.State {
+	t.Helper()
+
+	light, err := bridge.GetLight(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetLight(%d) err = %v", id, err)
+	}
+	return *light.State
+}
+
+func TestEngine_Do(t *testing.T) {
+	t.Run("off", func(t *testing.T) {
+		engine, bridge := newTestEngine(t)
+
+		doQuery(t, engine, "kitchen off", isGroup(1, isOnOff(BoolOff)))
+		for _, id := range []int{1, 2} {
+			if state := lightState(t, bridge, id); state.On {
+				t.Errorf("light %d is on, want off", id)
+			}
+		}
+		if state := lightState(t, bridge, 4); state.On {
+			t.Error("light 4 was turned on")
+		}
+	})
+
+	t.Run("on", func(t *testing.T) {
+		engine, bridge := newTestEngine(t)
+
+		doQuery(t, engine, "hallway spot on", isLight(3, isOnOff(BoolOn)))
+		if state := lightState(t, bridge, 3); !state.On || state.Bri != 100 {
+			t.Errorf("light 3 = %+v, want on with unchanged brightness", state)
+		}
+	})
+
+	t.Run("brightness", func(t *testing.T) {
+		engine, bridge := newTestEngine(t)
+
+		doQuery(t, engine, "tv strip 50%", isLight(5, func(action Action) bool { return action.Brightness.Valid() }))
+		if state := lightState(t, bridge, 5); !state.On || state.Bri != uint8(BrightnessFromPercent(50)) {
+			t.Errorf("light 5 = %+v, want on at 50%%", state)
+		}
+	})
+
+	t.Run("scene", func(t *testing.T) {
+		engine, bridge := newTestEngine(t)
+
+		doQuery(t, engine, "living room relax", isGroup(3, func(action Action) bool {
+			return action.Scene != nil && action.Scene.ID == "relax-scene"
+		}))
+		for _, id := range []int{4, 5} {
+			if state := lightState(t, bridge, id); !state.On || state.Bri != 144 || state.Ct != 447 {
+				t.Errorf("light %d = %+v, want relax scene", id, state)
+			}
+		}
+	})
+
+	t.Run("color", func(t *testing.T) {
+		engine, bridge := newTestEngine(t)
+
+		doQuery(t, engine, "sofa lamp red", isLight(4, func(action Action) bool { return action.Color != "" }))
+		state := lightState(t, bridge, 4)
+		if !state.On || state.ColorMode != "xy" || len(state.Xy) != 2 {
+			t.Fatalf("light 4 = %+v, want on in xy mode", state)
+		}
+		if got := (XY{float64(state.Xy[0]), float64(state.Xy[1])}); !xyEqual(got, GamutC.Red) {
+			t.Errorf("light 4 xy = %v, want red of gamut C %v", got, GamutC.Red)
+		}
+	})
+
+	t.Run("composite", func(t *testing.T) {
+		engine, bridge := newTestEngine(t)
+
+		doQuery(t, engine, "kitchen and living room on", func(action Action) bool {
+			return len(action.Actions) == 2 && isGroup(1, isOnOff(BoolOn))(action.Actions[0]) && isGroup(3, isOnOff(BoolOn))(action.Actions[1])
+		})
+		for _, id := range []int{1, 2, 4, 5} {
+			if state := lightState(t, bridge, id); !state.On {
+				t.Errorf("light %d is off, want on", id)
+			}
+		}
+		if state := lightState(t, bridge, 3); state.On {
+			t.Error("light 3 was turned on")
+		}
+	})
+
+	t.Run("undo", func(t *testing.T) {
+		engine, bridge := newTestEngine(t)
+
+		before := lightState(t, bridge, 1)
+		doQuery(t, engine, "kitchen 10%", isGroup(1, func(action Action) bool { return action.Brightness.Valid() }))
+		if state := lightState(t, bridge, 1); state.Bri == before.Bri {
+			t.Fatalf("light 1 = %+v, want changed brightness", state)
+		}
+
+		if err := engine.Undo(); err != nil {
+			t.Fatalf("Undo() err = %v", err)
+		}
+		if state := lightState(t, bridge, 1); state.On != before.On || state.Bri != before.Bri || state.Ct != before.Ct {
+			t.Errorf("light 1 = %+v, want %+v", state, before)
+		}
+
+		if err := engine.Undo(); err != ErrEngineNothingToUndo {
+			t.Errorf("Undo() err = %v, want %v", err, ErrEngineNothingToUndo)
+		}
+	})
+}
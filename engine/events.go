@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"time"
+)
+
+// EventKind is the kind of an event published by an engine
+type EventKind string
+
+const (
+	EventIndex  EventKind = "index"  // the index of a bridge was refreshed
+	EventAction EventKind = "action" // an action was performed or undone
+	EventLink   EventKind = "link"   // the engine was linked to its bridges, or failed to
+	EventState  EventKind = "state"  // the state of groups, lights or sensors of a bridge changed
+
+	// EventResync indicates that events were missed, and the state of the engine should be fetched again.
+	// It is not published by the engine itself, but by consumers whose subscription was closed, see Subscribe.
+	EventResync EventKind = "resync"
+)
+
+// Event is an event published by an engine.
+// Only the fields applicable to the kind of event are set.
+type Event struct {
+	Kind EventKind `json:"kind"`
+	Time time.Time `json:"time"`
+
+	// Bridge is the name of the bridge the event belongs to.
+	// Like results, it is only set when the engine has several bridges.
+	Bridge string `json:"bridge,omitempty"`
+
+	Action *Action `json:"action,omitempty"` // the action that was performed
+	Undo   bool    `json:"undo,omitempty"`   // if the action was undone
+
+	Linked *bool `json:"linked,omitempty"` // if the engine is linked to its bridges
+
+	State *IndexState `json:"state,omitempty"` // the new state of the bridge
+
+	Error string `json:"error,omitempty"`
+}
+
+// subscriberBuffer is the number of events buffered for each subscriber
+const subscriberBuffer = 16
+
+// Subscribe subscribes to the events of this engine.
+// Events are delivered on the returned channel until cancel is called.
+//
+// When a subscriber does not keep up, its channel is closed instead of silently dropping events.
+// It may subscribe again, but should assume that it missed events.
+func (engine *Engine) Subscribe() (events <-chan Event, cancel func()) {
+	engine.sl.Lock()
+	defer engine.sl.Unlock()
+
+	if engine.subscribers == nil {
+		engine.subscribers = make(map[chan Event]struct{})
+	}
+
+	c := make(chan Event, subscriberBuffer)
+	engine.subscribers[c] = struct{}{}
+
+	return c, func() {
+		engine.sl.Lock()
+		defer engine.sl.Unlock()
+
+		delete(engine.subscribers, c)
+	}
+}
+
+// publish publishes an event to all subscribers
+func (engine *Engine) publish(event Event) {
+	engine.sl.Lock()
+	defer engine.sl.Unlock()
+
+	if len(engine.subscribers) == 0 {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for c := range engine.subscribers {
+		select {
+		case c <- event:
+		default:
+			delete(engine.subscribers, c)
+			close(c)
+
+			engineLogger := engine.logger()
+			engineLogger.Debug().Str("kind", string(event.Kind)).Msg("subscriber too slow, closing subscription")
+		}
+	}
+}
+
+// publishState publishes a state event when the state of the given bridge differs from the state last published for it.
+// engine.l must be held.
+func (engine *Engine) publishState(eb *engineBridge) {
+	if eb.index == nil {
+		return
+	}
+
+	state := eb.index.State()
+	name := engine.indexBridge(eb)
+	if name != "" {
+		state.Tag(name)
+	}
+
+	if eb.state != nil && eb.state.Equal(state) {
+		return
+	}
+	eb.state = &state
+
+	engine.publish(Event{Kind: EventState, Bridge: name, State: &state})
+}
+
+// errorString returns the message of err, or the empty string if err is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
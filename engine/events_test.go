@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+// receivedKinds returns the kinds of all events currently buffered in events
+func receivedKinds(events <-chan Event) (kinds []EventKind) {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			kinds = append(kinds, event.Kind)
+		default:
+			return
+		}
+	}
+}
+
+// countKind counts how often kind occurs in kinds
+func countKind(kinds []EventKind, kind EventKind) (count int) {
+	for _, k := range kinds {
+		if k == kind {
+			count++
+		}
+	}
+	return
+}
+
+func TestEngine_Subscribe(t *testing.T) {
+	t.Run("state changes", func(t *testing.T) {
+		engine, bridge := newTestEngine(t)
+
+		events, cancel := engine.Subscribe()
+		defer cancel()
+
+		// the state of every object is recomputed, but only changes are published
+		if err := engine.RefreshIndex(); err != nil {
+			t.Fatalf("RefreshIndex() err = %v", err)
+		}
+		if got := receivedKinds(events); countKind(got, EventState) != 0 {
+			t.Errorf("RefreshIndex() published %v, want no %v", got, EventState)
+		}
+
+		on := true
+		if err := bridge.UpdateLight(context.Background(), 3, StateUpdate{On: &on}); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.RefreshIndex(); err != nil {
+			t.Fatalf("RefreshIndex() err = %v", err)
+		}
+		if got := receivedKinds(events); countKind(got, EventState) != 1 {
+			t.Errorf("RefreshIndex() published %v, want one %v", got, EventState)
+		}
+	})
+
+	t.Run("slow subscriber", func(t *testing.T) {
+		engine, _ := newTestEngine(t)
+
+		events, cancel := engine.Subscribe()
+		for i := 0; i <= subscriberBuffer; i++ {
+			engine.RefreshIndex()
+		}
+
+		count := 0
+		for range events {
+			count++
+		}
+		if count != subscriberBuffer {
+			t.Errorf("Subscribe() received %d events before being closed, want %d", count, subscriberBuffer)
+		}
+		cancel()
+
+		// subscribing again receives events
+		events, cancel = engine.Subscribe()
+		defer cancel()
+
+		engine.RefreshIndex()
+		if got := receivedKinds(events); countKind(got, EventIndex) == 0 {
+			t.Errorf("Subscribe() received %v after subscribing again, want %v", got, EventIndex)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldReplacements are letters that do not decompose into a base letter and diacritics
+var foldReplacements = map[rune]string{
+	'ß': "ss",
+	'æ': "ae",
+	'œ': "oe",
+	'ø': "o",
+	'ł': "l",
+	'đ': "d",
+}
+
+// foldText folds text for comparison.
+// It converts text to lower case, and removes diacritics, such that "Küche" becomes "kuche".
+func foldText(text string) string {
+	if isASCII(text) {
+		return strings.ToLower(text)
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(text))
+	for _, r := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if replacement, ok := foldReplacements[r]; ok {
+			builder.WriteString(replacement)
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// isASCII checks if text consists of ascii characters only
+func isASCII(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	// TypoLength is the number of characters in a source for each tolerated typo.
+	// Sources shorter than TypoLength must not contain any typos.
+	TypoLength = 4
+
+	// TypoPenalty is the penalty for each typo, in terms of additional characters in the target.
+	TypoPenalty = 2
+)
+
+// scoreTypos scores a folded source against a folded target, tolerating typos.
+// Typos are insertions, deletions, substitutions and transpositions of characters.
+//
+// Returns the number of typos needed for source to occur within target, or -1 if there are too many.
+func scoreTypos(source, target string) int {
+	s, t := []rune(source), []rune(target)
+
+	maxTypos := len(s) / TypoLength
+	if maxTypos == 0 {
+		return -1
+	}
+
+	// compute the optimal string alignment distance of s to any substring of t.
+	// prev2, prev and cur hold three consecutive rows of the distance matrix.
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1) // starting anywhere within t is free
+	cur := make([]int, len(t)+1)
+
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+
+			d := prev[j-1] + cost
+			if v := prev[j] + 1; v < d {
+				d = v
+			}
+			if v := cur[j-1] + 1; v < d {
+				d = v
+			}
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				if v := prev2[j-2] + 1; v < d {
+					d = v
+				}
+			}
+
+			cur[j] = d
+			if d < rowMin {
+				rowMin = d
+			}
+		}
+
+		// no alignment can recover from too many typos
+		if rowMin > maxTypos {
+			return -1
+		}
+
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	// ending anywhere within t is free
+	best := prev[0]
+	for _, d := range prev[1:] {
+		if d < best {
+			best = d
+		}
+	}
+	if best > maxTypos {
+		return -1
+	}
+	return best
+}
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/amimof/huego"
+)
+
+func Test_foldText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"kitchen", "kitchen"},
+		{"Living Room", "living room"},
+		{"Küche", "kuche"},
+		{"KÜCHE", "kuche"},
+		{"Éteindre", "eteindre"},
+		{"mañana", "manana"},
+		{"Çà et là", "ca et la"},
+		{"Straße", "strasse"},
+		{"Ærøskøbing", "aeroskobing"},
+		{"Œuvre", "oeuvre"},
+		{"Łódź", "lodz"},
+		{"Đakovo", "dakovo"},
+		{"Hallway 2", "hallway 2"},
+
+		// decomposed input folds the same as composed input
+		{"Küche", "kuche"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := foldText(tt.text); got != tt.want {
+				t.Errorf("foldText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scoreTypos(t *testing.T) {
+	tests := []struct {
+		source string
+		target string
+		want   int
+	}{
+		// exact substrings have no typos
+		{"kitchen", "kitchen", 0},
+		{"itch", "kitchen", 0},
+
+		// each kind of typo counts once
+		{"kitchan", "kitchen", 1},  // substitution
+		{"kitcen", "kitchen", 1},   // deletion
+		{"kittchen", "kitchen", 1}, // insertion
+		{"kitchne", "kitchen", 1},  // transposition
+		{"iktchen", "kitchen", 1},  // transposition at the start
+
+		// the source may occur anywhere within the target
+		{"rom", "living room", -1},
+		{"liivng", "living room", 1},
+		{"roim", "living room", 1},
+
+		// a transposed pair can not be edited again, as in the optimal string alignment distance
+		{"tchkien", "kitchen", -1},
+
+		// a typo is tolerated for every TypoLength characters
+		{"kic", "kitchen", -1},
+		{"kit", "kitchen", -1}, // sources shorter than TypoLength are rejected, even without typos
+		{"kich", "kitchen", 1},
+		{"kxtchxn", "kitchen", -1},
+		{"kxtchxnn", "kitchenn", 2},
+		{"livng rom", "living room", 2},
+		{"lvng rom", "living room", -1},
+
+		// characters are compared as runes
+		{"kuhce", "kuche", 1},
+		{"küche", "kuche", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source+"/"+tt.target, func(t *testing.T) {
+			if got := scoreTypos(tt.source, tt.target); got != tt.want {
+				t.Errorf("scoreTypos() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scoreText(t *testing.T) {
+	tests := []struct {
+		source string
+		target string
+		want   float64
+	}{
+		{"", "", 0},
+		{"kitchen", "Kitchen", 0},
+		{"kuche", "Küche", 0},
+		{"KÜCHE", "küche", 0},
+		{"kitch", "Kitchen", 2.0 / 7},
+
+		// each typo is penalized like TypoPenalty additional characters.
+		// matches with typos always score worse than matches without.
+		{"kitchan", "Kitchen", 1 + TypoPenalty/7.0},
+		{"kitchenn", "Kitchen", 1 + (-1+TypoPenalty)/7.0},
+		{"kitchan", "Kitchen Ceiling", 1 + (8+TypoPenalty)/15.0},
+		{"livign room", "Living Room", 1 + TypoPenalty/11.0},
+
+		// sources that occur in order are not considered typos
+		{"livng rom", "Living Room", 2.0 / 11},
+
+		// too many typos do not match
+		{"kit", "Hallway", -1},
+		{"kxtchxn", "Kitchen", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source+"/"+tt.target, func(t *testing.T) {
+			if got := scoreText(tt.source, tt.target); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("scoreText() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newBenchmarkIndex returns an index of a home with the given number of rooms.
+// Each room has three lights and two scenes.
+func newBenchmarkIndex(b *testing.B, rooms int) Index {
+	b.Helper()
+
+	var (
+		groups []huego.Group
+		lights []huego.Light
+		scenes []huego.Scene
+	)
+	roomNames := []string{"Kitchen", "Living Room", "Bedroom", "Bathroom", "Hallway", "Office", "Küche", "Salle à manger"}
+	for i := 1; i <= rooms; i++ {
+		group := huego.Group{ID: i, Name: fmt.Sprintf("%s %d", roomNames[i%len(roomNames)], i), Type: "Room"}
+		for j, name := range []string{"Ceiling", "Floor Lamp", "Strip"} {
+			id := 3*(i-1) + j + 1
+			lights = append(lights, huego.Light{
+				ID: id, Name: group.Name + " " + name, ModelID: "LCT015", Type: "Extended color light",
+				State: &huego.State{On: true, Bri: 254, ColorMode: "xy", Xy: []float32{0.3, 0.3}, Effect: "none"},
+			})
+			group.Lights = append(group.Lights, fmt.Sprint(id))
+		}
+		groups = append(groups, group)
+		for _, name := range []string{"Relax", "Concentrate"} {
+			scenes = append(scenes, huego.Scene{
+				ID: fmt.Sprintf("scene-%d-%s", i, name), Name: name, Type: "GroupScene", Group: fmt.Sprint(i), Lights: group.Lights,
+			})
+		}
+	}
+
+	index, err := NewIndex(NewMemoryBridge("memory", groups, lights, scenes, nil), context.Background())
+	if err != nil {
+		b.Fatalf("NewIndex() err = %v", err)
+	}
+	return index
+}
+
+// BenchmarkIndex_QueryString_latency measures the latency of single queries against homes of different sizes.
+// Queries with typos and diacritics take the slower path of scoreText.
+func BenchmarkIndex_QueryString_latency(b *testing.B) {
+	queries := []string{
+		"kitchen 3 off",
+		"kitchn ceiling",
+		"livng rom relax",
+		"kuche 7 40%",
+		"salle a manger strip red",
+		"bedroom and hallway off",
+	}
+	for _, rooms := range []int{5, 25, 100} {
+		index := newBenchmarkIndex(b, rooms)
+		for _, query := range queries {
+			b.Run(fmt.Sprintf("rooms=%d/%s", rooms, query), func(b *testing.B) {
+				var worst time.Duration
+				for i := 0; i < b.N; i++ {
+					start := time.Now()
+					index.QueryString(query, 0)
+					if took := time.Since(start); took > worst {
+						worst = took
+					}
+				}
+				b.ReportMetric(float64(worst.Nanoseconds()), "max-ns/query")
+			})
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// XY represents a point in the CIE 1931 color space
+type XY [2]float64
+
+// Gamut represents the color gamut of a light.
+// It is a triangle within the CIE color space given by the red, green and blue corners.
+type Gamut struct {
+	Red, Green, Blue XY
+}
+
+// Gamuts of hue lights, see https://developers.meethue.com/develop/hue-api/supported-devices/.
+var (
+	GamutA = Gamut{Red: XY{0.704, 0.296}, Green: XY{0.2151, 0.7106}, Blue: XY{0.138, 0.08}}
+	GamutB = Gamut{Red: XY{0.675, 0.322}, Green: XY{0.409, 0.518}, Blue: XY{0.167, 0.04}}
+	GamutC = Gamut{Red: XY{0.692, 0.308}, Green: XY{0.17, 0.7}, Blue: XY{0.153, 0.048}}
+
+	// GamutDefault is used for lights with an unknown gamut.
+	// It does not restrict colors in any way.
+	GamutDefault = Gamut{Red: XY{1, 0}, Green: XY{0, 1}, Blue: XY{0, 0}}
+)
+
+// WhitePoint is the D65 white point, used as the color of black
+var WhitePoint = XY{0.3127, 0.3290}
+
+// modelGamuts maps model ids to their gamut
+var modelGamuts = map[string]Gamut{
+	// Gamut A
+	"LLC001": GamutA, "LLC005": GamutA, "LLC006": GamutA, "LLC007": GamutA,
+	"LLC010": GamutA, "LLC011": GamutA, "LLC012": GamutA, "LLC013": GamutA,
+	"LLC014": GamutA, "LST001": GamutA,
+
+	// Gamut B
+	"LCT001": GamutB, "LCT002": GamutB, "LCT003": GamutB, "LCT007": GamutB,
+	"LLM001": GamutB,
+
+	// Gamut C
+	"LCT010": GamutC, "LCT011": GamutC, "LCT012": GamutC, "LCT014": GamutC,
+	"LCT015": GamutC, "LCT016": GamutC, "LCT024": GamutC, "LLC020": GamutC,
+	"LST002": GamutC, "LST003": GamutC, "LST004": GamutC, "LCA001": GamutC,
+	"LCA002": GamutC, "LCA003": GamutC, "LCB001": GamutC, "LCG002": GamutC,
+	"LCF001": GamutC, "LCF002": GamutC, "LCF003": GamutC, "LCF005": GamutC,
+	"LCC001": GamutC, "LCE001": GamutC, "LCE002": GamutC, "LCS001": GamutC,
+}
+
+// GamutForModel returns the gamut of the light with the given model id.
+// When the model is unknown, returns [GamutDefault].
+func GamutForModel(modelID string) Gamut {
+	if gamut, ok := modelGamuts[modelID]; ok {
+		return gamut
+	}
+	return GamutDefault
+}
+
+// Contains checks if the given point lies within this gamut
+func (gamut Gamut) Contains(p XY) bool {
+	d1 := cross(p, gamut.Red, gamut.Green)
+	d2 := cross(p, gamut.Green, gamut.Blue)
+	d3 := cross(p, gamut.Blue, gamut.Red)
+
+	hasNeg := d1 < 0 || d2 < 0 || d3 < 0
+	hasPos := d1 > 0 || d2 > 0 || d3 > 0
+	return !(hasNeg && hasPos)
+}
+
+// Clamp returns the point closest to p that lies within this gamut.
+func (gamut Gamut) Clamp(p XY) XY {
+	if gamut.Contains(p) {
+		return p
+	}
+
+	best := closestOnSegment(p, gamut.Red, gamut.Green)
+	bestDist := distance(p, best)
+	for _, edge := range [][2]XY{{gamut.Green, gamut.Blue}, {gamut.Blue, gamut.Red}} {
+		candidate := closestOnSegment(p, edge[0], edge[1])
+		if dist := distance(p, candidate); dist < bestDist {
+			best, bestDist = candidate, dist
+		}
+	}
+	return best
+}
+
+// ColorToXY converts a color into a point within the given gamut, and a brightness.
+//
+// The color is gamma corrected and converted using the wide gamut conversion recommended for hue lights.
+// The brightness corresponds to the luminance of the color.
+// Black is mapped to the [WhitePoint] at minimal brightness.
+func ColorToXY(color colorful.Color, gamut Gamut) (XY, Brightness) {
+	r, g, b := color.LinearRgb()
+
+	X := r*0.664511 + g*0.154324 + b*0.162028
+	Y := r*0.283881 + g*0.668433 + b*0.047685
+	Z := r*0.000088 + g*0.072310 + b*0.986039
+
+	sum := X + Y + Z
+	if sum <= 0 {
+		return gamut.Clamp(WhitePoint), MinBrightness
+	}
+
+	xy := gamut.Clamp(XY{X / sum, Y / sum})
+	return xy, BrightnessFromPercent(Y * 100)
+}
+
+// cross returns the cross product of (a - p) and (b - p)
+func cross(p, a, b XY) float64 {
+	return (a[0]-p[0])*(b[1]-p[1]) - (b[0]-p[0])*(a[1]-p[1])
+}
+
+// closestOnSegment returns the point on the segment from a to b that is closest to p
+func closestOnSegment(p, a, b XY) XY {
+	ab := XY{b[0] - a[0], b[1] - a[1]}
+	ap := XY{p[0] - a[0], p[1] - a[1]}
+
+	t := (ap[0]*ab[0] + ap[1]*ab[1]) / (ab[0]*ab[0] + ab[1]*ab[1])
+	t = math.Max(0, math.Min(1, t))
+
+	return XY{a[0] + t*ab[0], a[1] + t*ab[1]}
+}
+
+// distance returns the euclidean distance between a and b
+func distance(a, b XY) float64 {
+	return math.Hypot(a[0]-b[0], a[1]-b[1])
+}
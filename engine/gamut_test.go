@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// xyTolerance is the tolerance used when comparing points in the color space
+const xyTolerance = 1e-4
+
+func xyEqual(a, b XY) bool {
+	return math.Abs(a[0]-b[0]) < xyTolerance && math.Abs(a[1]-b[1]) < xyTolerance
+}
+
+func TestColorToXY(t *testing.T) {
+	var (
+		red    = colorful.Color{R: 1, G: 0, B: 0}
+		green  = colorful.Color{R: 0, G: 1, B: 0}
+		blue   = colorful.Color{R: 0, G: 0, B: 1}
+		white  = colorful.Color{R: 1, G: 1, B: 1}
+		orange = colorful.Color{R: 1, G: 0.5, B: 0}
+		black  = colorful.Color{R: 0, G: 0, B: 0}
+	)
+
+	tests := []struct {
+		name    string
+		color   colorful.Color
+		gamut   Gamut
+		wantXY  XY
+		wantBri Brightness
+	}{
+		// primaries are unrestricted by the default gamut
+		{"red default", red, GamutDefault, XY{0.7006, 0.2993}, 72},
+		{"green default", green, GamutDefault, XY{0.1724, 0.7468}, 170},
+		{"blue default", blue, GamutDefault, XY{0.1355, 0.0399}, 12},
+
+		// primaries outside of a gamut are moved to the closest point within it
+		{"red A", red, GamutA, XY{0.7004, 0.2991}, 72},
+		{"green A", green, GamutA, GamutA.Green, 170},
+		{"blue A", blue, GamutA, GamutA.Blue, 12},
+		{"red B", red, GamutB, GamutB.Red, 72},
+		{"green B", green, GamutB, GamutB.Green, 170},
+		{"blue B", blue, GamutB, GamutB.Blue, 12},
+		{"red C", red, GamutC, GamutC.Red, 72},
+		{"green C", green, GamutC, GamutC.Green, 170},
+		{"blue C", blue, GamutC, GamutC.Blue, 12},
+
+		// colors outside of a gamut that are not closest to a corner end up on an edge
+		{"orange default", orange, GamutDefault, XY{0.6118, 0.3745}, 108},
+		{"orange A", orange, GamutA, XY{0.6117, 0.3743}, 108},
+		{"orange B", orange, GamutB, XY{0.6090, 0.3706}, 108},
+		{"orange C", orange, GamutC, XY{0.6088, 0.3705}, 108},
+
+		// colors inside of a gamut are not changed
+		{"white A", white, GamutA, XY{0.3227, 0.3290}, MaxBrightness},
+		{"white B", white, GamutB, XY{0.3227, 0.3290}, MaxBrightness},
+		{"white C", white, GamutC, XY{0.3227, 0.3290}, MaxBrightness},
+
+		// black has no chromaticity
+		{"black default", black, GamutDefault, WhitePoint, MinBrightness},
+		{"black A", black, GamutA, WhitePoint, MinBrightness},
+		{"black B", black, GamutB, XY{0.3132, 0.3288}, MinBrightness}, // the white point lies just outside of gamut B
+		{"black C", black, GamutC, WhitePoint, MinBrightness},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotXY, gotBri := ColorToXY(tt.color, tt.gamut)
+			if !xyEqual(gotXY, tt.wantXY) {
+				t.Errorf("ColorToXY() xy = %v, want %v", gotXY, tt.wantXY)
+			}
+			if gotBri != tt.wantBri {
+				t.Errorf("ColorToXY() bri = %v, want %v", gotBri, tt.wantBri)
+			}
+			if !tt.gamut.Contains(gotXY) && !xyEqual(tt.gamut.Clamp(gotXY), gotXY) {
+				t.Errorf("ColorToXY() = %v, not within gamut", gotXY)
+			}
+		})
+	}
+}
+
+func TestGamut_Clamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		gamut Gamut
+		p     XY
+		want  XY
+	}{
+		{"inside A", GamutA, XY{0.4, 0.4}, XY{0.4, 0.4}},
+		{"corner A", GamutA, GamutA.Red, GamutA.Red},
+		{"beyond red A", GamutA, XY{0.8, 0.2}, GamutA.Red},
+		{"beyond blue B", GamutB, XY{0.1, 0}, GamutB.Blue},
+		{"beyond green C", GamutC, XY{0.1, 0.9}, GamutC.Green},
+		{"beyond red-green edge B", GamutB, XY{0.6, 0.6}, XY{0.4936, 0.4556}},
+		{"origin default", GamutDefault, XY{0, 0}, XY{0, 0}},
+		{"beyond default", GamutDefault, XY{1, 1}, XY{0.5, 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.gamut.Clamp(tt.p); !xyEqual(got, tt.want) {
+				t.Errorf("Gamut.Clamp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGamutForModel(t *testing.T) {
+	tests := []struct {
+		modelID string
+		want    Gamut
+	}{
+		{"LLC001", GamutA},
+		{"LST001", GamutA},
+		{"LCT001", GamutB},
+		{"LCT015", GamutC},
+		{"LCA001", GamutC},
+		{"LWB010", GamutDefault},
+		{"", GamutDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.modelID, func(t *testing.T) {
+			if got := GamutForModel(tt.modelID); got != tt.want {
+				t.Errorf("GamutForModel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package engine
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mazznoer/csscolorparser"
+)
+
+// TokenKind represents the kind of a token within a query
+type TokenKind int
+
+const (
+	TokenWord        TokenKind = iota // a plain word, part of a name or a scene
+	TokenVerb                         // a word turning a target on or off, such as "off" or "aus"
+	TokenKeyword                      // another word with a fixed meaning, such as "dim" or "red"
+	TokenValue                        // a numeric value, such as "40%" or "2700K"
+	TokenConjunction                  // a word separating multiple targets, such as "and"
+)
+
+// Token represents a single token within a query
+type Token struct {
+	Kind TokenKind
+	Text string
+}
+
+// Tokenize splits input into a sequence of tokens.
+// Only words of the given locales are recognized as verbs or keywords.
+// Conjunctions that are part of a word, as in "kitchen,hallway", become separate tokens.
+func Tokenize(input string, locales LocaleSet) (tokens []Token) {
+	v := locales.vocabulary()
+	for _, field := range strings.Fields(input) {
+		for _, text := range tokenizeConjunctions(field) {
+			tokens = append(tokens, Token{Kind: v.tokenKind(text), Text: text})
+		}
+	}
+	return
+}
+
+// tokenKind determines the kind of the given token text
+func (v *vocabulary) tokenKind(text string) TokenKind {
+	lower := strings.ToLower(text)
+	switch {
+	case isConjunction(lower):
+		return TokenConjunction
+	case unicode.IsDigit([]rune(lower)[0]):
+		return TokenValue
+	case v.isVerb(lower):
+		return TokenVerb
+	case v.isKeyword(lower):
+		return TokenKeyword
+	default:
+		return TokenWord
+	}
+}
+
+// tokenizeConjunctions splits a field into tokens, treating "," and "+" as separate tokens.
+func tokenizeConjunctions(field string) (tokens []string) {
+	for {
+		i := strings.IndexAny(field, ",+")
+		if i < 0 {
+			break
+		}
+		if i > 0 {
+			tokens = append(tokens, field[:i])
+		}
+		tokens = append(tokens, field[i:i+1])
+		field = field[i+1:]
+	}
+	if field != "" {
+		tokens = append(tokens, field)
+	}
+	return
+}
+
+// conjunctions are words that separate multiple targets
+var conjunctions = map[string]struct{}{
+	"and": {},
+	",":   {},
+	"+":   {},
+}
+
+func isConjunction(lower string) bool {
+	_, ok := conjunctions[lower]
+	return ok
+}
+
+// keywordSet returns the set of words with a fixed meaning, other than verbs, in the given vocabulary.
+// Words that do not depend on the locale, such as the names of effects, are always included.
+// Multi-word keywords, such as "warm white", contribute each of their words.
+func keywordSet(v *vocabulary) map[string]struct{} {
+	keywords := make(map[string]struct{})
+	add := func(phrases ...string) {
+		for _, phrase := range phrases {
+			for _, word := range strings.Fields(phrase) {
+				keywords[strings.ToLower(word)] = struct{}{}
+			}
+		}
+	}
+
+	add(brightnessPrefixes...)
+	add(brightnessSuffixes...)
+	add(temperaturePrefixes...)
+	for _, word := range temperatureWords {
+		add(word.Word)
+	}
+	for _, word := range effectWords {
+		add(word.Word)
+	}
+	for _, word := range statusWords {
+		add(word.Word)
+	}
+	for _, words := range sensorWords {
+		add(words...)
+	}
+
+	for _, word := range v.brightness {
+		add(word.Word)
+	}
+	for name := range v.colors {
+		add(name)
+	}
+	return keywords
+}
+
+// verbSet returns the set of words turning a target on or off, or toggling it, in the given vocabulary
+func verbSet(v *vocabulary) map[string]struct{} {
+	verbs := make(map[string]struct{})
+	for _, words := range v.onoff {
+		for _, word := range words {
+			verbs[strings.ToLower(word)] = struct{}{}
+		}
+	}
+	return verbs
+}
+
+// isVerb checks if the given lowercase word is a verb of this vocabulary
+func (v *vocabulary) isVerb(lower string) bool {
+	_, ok := v.verbs[lower]
+	return ok
+}
+
+// isKeyword checks if the given lowercase word is a keyword of this vocabulary.
+// Color names and hex colors are also considered keywords.
+func (v *vocabulary) isKeyword(lower string) bool {
+	if _, ok := v.keywords[lower]; ok {
+		return true
+	}
+	c, err := csscolorparser.Parse(lower)
+	return err == nil && c.A == 1
+}
+
+// Statement is the syntax tree of a query.
+//
+//	statement := target { conjunction target } modifiers [ "?" ]
+//	target    := name [ change ] | change name
+//	change    := verb | value | phrase
+//	verb      := "on" | "off" | "toggle" | ...
+//	value     := ( keyword | number ) { keyword | number }
+//	phrase    := [ value ] word { word }
+//	name      := { word | keyword | number }
+//	modifiers := { transition | schedule }
+//
+// Values are brightness values, color temperatures, colors, effects and sensor readings, such as "40%" or "warm white".
+// Phrases are the names of scenes, or keywords that are still being typed, such as "warm whi".
+// A phrase is only read as the change when the target does not end with a verb or value.
+//
+// The grammar is ambiguous, because names may contain keywords.
+// Each way to derive a target is represented by a [Reading].
+// The last target also holds the change to be made.
+type Statement struct {
+	// Targets are the conjunct targets, excluding the conjunctions.
+	// When the input contains no conjunctions, there is a single target.
+	Targets []Target
+
+	// Tokens are all tokens of the input, excluding modifiers.
+	// They are used for names that contain a conjunction, such as "salt and pepper".
+	Tokens []Token
+
+	Modifiers Modifiers
+}
+
+// ParseStatement parses input into a statement.
+// The vocabulary of the given locales is used to recognize verbs and keywords.
+func ParseStatement(input string, locales LocaleSet) (stmt Statement) {
+	// a trailing question mark asks for the status
+	input = strings.TrimSpace(input)
+	stmt.Modifiers.Status = strings.HasSuffix(input, "?")
+	input = strings.TrimRight(input, "?")
+	stmt.Modifiers.Locales = locales
+
+	tokens := Tokenize(input, locales)
+	if len(tokens) == 0 {
+		return
+	}
+
+	// parse modifiers from the end
+	texts := make([]string, len(tokens))
+	for i, token := range tokens {
+		texts[i] = token.Text
+	}
+	modifiers, rest := parseModifiers(texts)
+	modifiers.Status = stmt.Modifiers.Status
+	modifiers.Locales = locales
+
+	stmt.Modifiers = modifiers
+	stmt.Tokens = tokens[:len(rest)]
+
+	// conjunctions at either end do not separate targets, as in "kitchen," while typing
+	for len(stmt.Tokens) > 0 && stmt.Tokens[0].Kind == TokenConjunction {
+		stmt.Tokens = stmt.Tokens[1:]
+	}
+	for len(stmt.Tokens) > 0 && stmt.Tokens[len(stmt.Tokens)-1].Kind == TokenConjunction {
+		stmt.Tokens = stmt.Tokens[:len(stmt.Tokens)-1]
+	}
+
+	// split into targets
+	var current Target
+	for _, token := range stmt.Tokens {
+		if token.Kind == TokenConjunction {
+			if len(current) > 0 {
+				stmt.Targets = append(stmt.Targets, current)
+			}
+			current = nil
+			continue
+		}
+		current = append(current, token)
+	}
+	if len(current) > 0 {
+		stmt.Targets = append(stmt.Targets, current)
+	}
+
+	return
+}
+
+// Queries returns the plausible interpretations of this statement.
+// There is one interpretation for each reading of the entire input, and, when there are several targets, for each reading of the last target.
+func (stmt Statement) Queries() (queries []Query) {
+	if len(stmt.Tokens) == 0 {
+		return nil
+	}
+
+	seen := make(map[[2]string]struct{})
+	add := func(target Target, targets []string) {
+		for _, reading := range target.Readings() {
+			q := reading.Query()
+			key := [2]string{q.Name, q.Action}
+			if len(targets) == 0 {
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+
+			q.Targets = targets
+			q.Modifiers = stmt.Modifiers
+			queries = append(queries, q)
+		}
+	}
+
+	// interpret the entire input as a single target
+	add(Target(stmt.Tokens), nil)
+
+	// when there are multiple targets, the change is part of the last one.
+	// the remaining ones are used as names only.
+	if len(stmt.Targets) > 1 {
+		last := len(stmt.Targets) - 1
+
+		targets := make([]string, last)
+		for i, target := range stmt.Targets[:last] {
+			targets[i] = joinTokens(target)
+		}
+
+		add(stmt.Targets[last], targets)
+	}
+
+	return
+}
+
+// Target is a single target of a statement, consisting of a name and the change to be made to it.
+type Target []Token
+
+// ChangeKind is the kind of change within a reading
+type ChangeKind int
+
+const (
+	ChangeNone   ChangeKind = iota // no change, such as in "kitchen"
+	ChangeVerb                     // a verb, such as in "kitchen off"
+	ChangeValue                    // a value, such as in "kitchen 40%" or "kitchen warm white"
+	ChangePhrase                   // a phrase, such as in "kitchen relax" or "kitchen warm whi"
+)
+
+// MaxChangeTokens is the maximal number of tokens of a change.
+// It is large enough for the names of scenes.
+const MaxChangeTokens = 8
+
+// Reading is one way to derive a target from the grammar.
+type Reading struct {
+	Name   []Token
+	Change []Token
+	Kind   ChangeKind
+
+	// Leading indicates that the change comes before the name
+	Leading bool
+}
+
+// Query returns the query corresponding to this reading
+func (reading Reading) Query() Query {
+	return Query{Name: joinTokens(reading.Name), Action: joinTokens(reading.Change)}
+}
+
+// Readings returns the plausible readings of this target.
+//
+// The entire target is always read as a name.
+// When the target ends with keywords or values, each of their suffixes is read as a verb or value.
+// Otherwise each suffix of the trailing words is read as a phrase, possibly including the keywords or values right before them.
+// Finally each prefix of leading keywords or values is read as a verb or value preceding the name,
+// or, if the target neither starts nor ends with keywords or values, each prefix of the leading words as a phrase.
+//
+// Neither the name nor the change start or end with a conjunction, and changes consist of at most [MaxChangeTokens] tokens.
+func (target Target) Readings() (readings []Reading) {
+	if len(target) == 0 {
+		return nil
+	}
+
+	add := func(name, change []Token, kind ChangeKind, leading bool) {
+		if dangling(name) || dangling(change) {
+			return
+		}
+		readings = append(readings, Reading{Name: name, Change: change, Kind: kind, Leading: leading})
+	}
+
+	add(target, nil, ChangeNone, false)
+
+	// changes are limited in length, so that the number of readings is linear in the length of the target
+	limit := len(target) - MaxChangeTokens
+	if limit < 0 {
+		limit = 0
+	}
+
+	// a trailing change is a verb or value when the target ends with one, and a phrase otherwise
+	start := target.trailing(true)
+	phrase := start == len(target)
+	if phrase {
+		start = target[:target.trailing(false)].trailing(true)
+	}
+	if start < limit {
+		start = limit
+	}
+	for i := start; i < len(target); i++ {
+		kind := ChangePhrase
+		if !phrase {
+			kind = changeKind(target[i:])
+		}
+		add(target[:i], target[i:], kind, false)
+	}
+
+	// a leading change is a verb or value when the target starts with one.
+	// it is a phrase only when the target does not end with a verb or value.
+	end := target.leading(true)
+	if end == 0 && phrase {
+		end = target.leading(false)
+	}
+	if end > MaxChangeTokens {
+		end = MaxChangeTokens
+	}
+	for i := 1; i <= end && i < len(target); i++ {
+		kind := ChangePhrase
+		if target[0].fixed() {
+			kind = changeKind(target[:i])
+		}
+		add(target[i:], target[:i], kind, true)
+	}
+
+	return
+}
+
+// trailing returns the index of the first token of the longest suffix of target
+// consisting only of tokens with a fixed meaning (if fixed is true) or only of tokens without one (if fixed is false).
+func (target Target) trailing(fixed bool) int {
+	i := len(target)
+	for i > 0 && target[i-1].fixed() == fixed {
+		i--
+	}
+	return i
+}
+
+// leading returns the length of the longest prefix of target
+// consisting only of tokens with a fixed meaning (if fixed is true) or only of tokens without one (if fixed is false).
+func (target Target) leading(fixed bool) int {
+	i := 0
+	for i < len(target) && target[i].fixed() == fixed {
+		i++
+	}
+	return i
+}
+
+// fixed checks if this token has a fixed meaning, that is if it is a verb, keyword or value
+func (token Token) fixed() bool {
+	return token.Kind == TokenVerb || token.Kind == TokenKeyword || token.Kind == TokenValue
+}
+
+// changeKind returns the kind of change consisting of the given verbs, keywords or values
+func changeKind(tokens []Token) ChangeKind {
+	if len(tokens) == 1 && tokens[0].Kind == TokenVerb {
+		return ChangeVerb
+	}
+	return ChangeValue
+}
+
+// dangling checks if tokens start or end with a conjunction
+func dangling(tokens []Token) bool {
+	return len(tokens) > 0 && (tokens[0].Kind == TokenConjunction || tokens[len(tokens)-1].Kind == TokenConjunction)
+}
+
+// joinTokens joins the text of tokens using spaces
+func joinTokens(tokens []Token) string {
+	texts := make([]string, len(tokens))
+	for i, token := range tokens {
+		texts[i] = token.Text
+	}
+	return strings.Join(texts, " ")
+}
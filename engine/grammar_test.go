@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var changeKindNames = map[ChangeKind]string{
+	ChangeNone:   "none",
+	ChangeVerb:   "verb",
+	ChangeValue:  "value",
+	ChangePhrase: "phrase",
+}
+
+func TestTarget_Readings(t *testing.T) {
+	tests := []struct {
+		input   string
+		locales LocaleSet
+		want    []string // name|change|kind, in order
+	}{
+		{"kitchen", 0, []string{
+			"kitchen||none",
+			"|kitchen|phrase",
+		}},
+		{"kitchen off", 0, []string{
+			"kitchen off||none",
+			"kitchen|off|verb",
+		}},
+		{"küche aus", NewLocaleSet(German), []string{
+			"küche aus||none",
+			"küche|aus|verb",
+		}},
+		{"off", 0, []string{
+			"off||none",
+			"|off|verb",
+		}},
+		{"off kitchen", 0, []string{
+			"off kitchen||none",
+			"|off kitchen|phrase",
+			"off|kitchen|phrase",
+			"kitchen|off|verb",
+		}},
+		{"kitchen 40%", 0, []string{
+			"kitchen 40%||none",
+			"kitchen|40%|value",
+		}},
+		{"kitchen warm white", 0, []string{
+			"kitchen warm white||none",
+			"kitchen|warm white|value",
+			"kitchen warm|white|value",
+		}},
+		{"kitchen warm whi", 0, []string{
+			"kitchen warm whi||none",
+			"kitchen|warm whi|phrase",
+			"kitchen warm|whi|phrase",
+			"warm whi|kitchen|phrase",
+		}},
+		{"kitchen light off", 0, []string{
+			"kitchen light off||none",
+			"kitchen|light off|value",
+			"kitchen light|off|verb",
+		}},
+		{"living room relax", 0, []string{
+			"living room relax||none",
+			"|living room relax|phrase",
+			"living|room relax|phrase",
+			"living room|relax|phrase",
+			"room relax|living|phrase",
+			"relax|living room|phrase",
+		}},
+		{"red room bright", 0, []string{
+			"red room bright||none",
+			"red room|bright|value",
+			"room bright|red|value",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got []string
+			for _, r := range Target(Tokenize(tt.input, tt.locales)).Readings() {
+				got = append(got, joinTokens(r.Name)+"|"+joinTokens(r.Change)+"|"+changeKindNames[r.Kind])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Target.Readings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTarget_Readings_limit(t *testing.T) {
+	words := Target(Tokenize(strings.Repeat("word ", 100), 0))
+	if got, want := len(words.Readings()), 1+2*MaxChangeTokens; got != want {
+		t.Errorf("Target.Readings() returned %d readings, want %d", got, want)
+	}
+
+	values := Target(Tokenize(strings.Repeat("off ", 100), 0))
+	if got, want := len(values.Readings()), 1+2*MaxChangeTokens; got != want {
+		t.Errorf("Target.Readings() returned %d readings, want %d", got, want)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string // targets|name|action, in any order
+	}{
+		{"", nil},
+		{"kitchen off over 10s", []string{
+			"|kitchen off|",
+			"|kitchen|off",
+		}},
+		{"kitchen and hallway off", []string{
+			"|kitchen and hallway off|",
+			"|kitchen and hallway|off",
+			"kitchen|hallway off|",
+			"kitchen|hallway|off",
+		}},
+		{"kitchen, hallway off", []string{
+			"|kitchen , hallway off|",
+			"|kitchen , hallway|off",
+			"kitchen|hallway off|",
+			"kitchen|hallway|off",
+		}},
+		{"salt and pepper", []string{
+			"|salt and pepper|",
+			"||salt and pepper",
+			"salt|pepper|",
+			"salt||pepper",
+		}},
+		{", kitchen and", []string{
+			"|kitchen|",
+			"||kitchen",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got []string
+			for _, q := range ParseQuery(tt.input, 0) {
+				got = append(got, strings.Join(q.Targets, ",")+"|"+q.Name+"|"+q.Action)
+			}
+			sort.Strings(got)
+
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseQuery() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestTokenize_locales(t *testing.T) {
+	tests := []struct {
+		input   string
+		locales LocaleSet
+		want    []TokenKind
+	}{
+		{"turn an or", 0, []TokenKind{TokenWord, TokenWord, TokenWord}},
+		{"küche an", NewLocaleSet(German), []TokenKind{TokenWord, TokenVerb}},
+		{"cuisine or", NewLocaleSet(French), []TokenKind{TokenWord, TokenKeyword}},
+		{"cuisine an", NewLocaleSet(French), []TokenKind{TokenWord, TokenWord}},
+		{"kitchen off gold", NewLocaleSet(Spanish), []TokenKind{TokenWord, TokenVerb, TokenKeyword}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got []TokenKind
+			for _, token := range Tokenize(tt.input, tt.locales) {
+				got = append(got, token.Kind)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize() kinds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// passQueries generates queries using every split of the input into a contiguous name and action part.
+// This is the approach used before queries were parsed using a grammar, and serves as a reference.
+func passQueries(input string, locales LocaleSet) []Query {
+	stmt := ParseStatement(input, locales)
+
+	queries := splitQueries(stmt.Tokens)
+	for i := range queries {
+		queries[i].Modifiers = stmt.Modifiers
+	}
+	return queries
+}
+
+// splitQueries returns a query for every split of tokens into a contiguous name and action part
+func splitQueries(tokens []Token) []Query {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	queries := make([]Query, 2*(len(tokens)+1))
+	for i := 0; i <= len(tokens); i++ {
+		first, second := joinTokens(tokens[:i]), joinTokens(tokens[i:])
+		queries[2*i] = Query{Name: first, Action: second}
+		queries[2*i+1] = Query{Name: second, Action: first}
+	}
+	return queries
+}
+
+// grammarInputs are inputs used by fuzz tests and benchmarks
+var grammarInputs = []string{
+	"kitchen",
+	"kitchen off",
+	"off kitchen",
+	"kitchne of",
+	"living room relax",
+	"living room warm white",
+	"tv strip 40% in 20m",
+	"kitchen and hallway off over 10s",
+	"sofa lamp, tv strip and kitchen red slowly",
+	"hallway?",
+	"status sofa lamp",
+	"küche aus",
+	"salt and pepper",
+}
+
+func FuzzParseQuery(f *testing.F) {
+	for _, input := range grammarInputs {
+		f.Add(input, uint8(0))
+		f.Add(input, uint8(NewLocaleSet(allLocales...)))
+	}
+	f.Fuzz(func(t *testing.T, input string, locales uint8) {
+		stmt := ParseStatement(input, LocaleSet(locales))
+
+		// every query must be a split of the entire input, or of the last target
+		texts := []string{joinTokens(stmt.Tokens)}
+		if len(stmt.Targets) > 1 {
+			texts = append(texts, joinTokens(stmt.Targets[len(stmt.Targets)-1]))
+		}
+		isSplit := func(q Query) bool {
+			for _, text := range texts {
+				if joinNonEmpty(q.Name, q.Action) == text || joinNonEmpty(q.Action, q.Name) == text {
+					return true
+				}
+			}
+			return false
+		}
+
+		queries := stmt.Queries()
+		if len(stmt.Tokens) > 0 && len(queries) == 0 {
+			t.Errorf("Queries() = nil, want at least one query")
+		}
+
+		for _, q := range queries {
+			if !isSplit(q) {
+				t.Errorf("Queries() returned %q, which is not a split of the input", q)
+			}
+			if len(q.Targets) > 0 && len(q.Targets) != len(stmt.Targets)-1 {
+				t.Errorf("Queries() returned %q, targets do not match statement", q)
+			}
+			if q.Modifiers != stmt.Modifiers {
+				t.Errorf("Queries() returned %q, modifiers do not match statement", q)
+			}
+			for _, part := range []string{q.Name, q.Action} {
+				if dangling(Tokenize(part, stmt.Modifiers.Locales)) {
+					t.Errorf("Queries() returned %q, which has a dangling conjunction", q)
+				}
+			}
+		}
+	})
+}
+
+// joinNonEmpty joins the non-empty parts using spaces
+func joinNonEmpty(parts ...string) string {
+	nonEmpty := parts[:0:0]
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+func BenchmarkParseQuery(b *testing.B) {
+	b.Run("grammar", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, input := range grammarInputs {
+				ParseQuery(input, 0)
+			}
+		}
+	})
+	b.Run("passes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, input := range grammarInputs {
+				passQueries(input, 0)
+			}
+		}
+	})
+}
+
+func BenchmarkIndex_Query(b *testing.B) {
+	index := newTestIndex(b)
+
+	b.Run("grammar", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, input := range grammarInputs {
+				index.Query(ParseQuery(input, 0))
+			}
+		}
+	})
+	b.Run("passes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, input := range grammarInputs {
+				index.Query(passQueries(input, 0))
+			}
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/amimof/huego"
+	"github.com/pkg/errors"
+)
+
+// GroupType represents the type of a group
+type GroupType string
+
+const (
+	GroupRoom          GroupType = "Room"
+	GroupZone          GroupType = "Zone"
+	GroupEntertainment GroupType = "Entertainment"
+	GroupLightGroup    GroupType = "LightGroup"
+	GroupOther         GroupType = "Other" // Luminaire, LightSource and unknown types
+
+	// GroupAll is the type of the special group containing all lights.
+	// It is always searchable.
+	GroupAll GroupType = "All"
+)
+
+// groupTypes holds all group types, ordered by preference when their scores tie
+var groupTypes = []GroupType{GroupRoom, GroupZone, GroupLightGroup, GroupEntertainment, GroupOther}
+
+// DefaultGroupTypes are the group types that are searchable by default
+var DefaultGroupTypes = []GroupType{GroupRoom, GroupZone}
+
+// GroupTypeOf returns the type of the given group
+func GroupTypeOf(group huego.Group) GroupType {
+	if group.ID == AllLightsID {
+		return GroupAll
+	}
+	for _, t := range groupTypes {
+		if group.Type == string(t) {
+			return t
+		}
+	}
+	return GroupOther
+}
+
+// Title returns a human-readable title for this group type
+func (t GroupType) Title() string {
+	switch t {
+	case GroupRoom:
+		return "Room"
+	case GroupZone:
+		return "Zone"
+	case GroupEntertainment:
+		return "Entertainment area"
+	case GroupLightGroup:
+		return "Light group"
+	case GroupAll:
+		return "All"
+	default:
+		return "Group"
+	}
+}
+
+// rank returns the preference of this group type, lower values being preferred.
+// The group containing all lights is preferred over any other group.
+func (t GroupType) rank() float64 {
+	if t == GroupAll {
+		return -1
+	}
+	for i, gt := range groupTypes {
+		if gt == t {
+			return float64(i)
+		}
+	}
+	return float64(len(groupTypes))
+}
+
+// groupTypeWords are words that filter a query by group type
+var groupTypeWords = map[string]GroupType{
+	"room":          GroupRoom,
+	"zone":          GroupZone,
+	"entertainment": GroupEntertainment,
+	"group":         GroupLightGroup,
+}
+
+var ErrUnknownGroupType = errors.New("ParseGroupTypes: unknown group type")
+
+// ParseGroupTypes parses a comma-separated list of group types, such as "room,zone".
+// Group types are case-insensitive.
+func ParseGroupTypes(value string) (types []GroupType, err error) {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		var found bool
+		for _, t := range groupTypes {
+			if strings.EqualFold(name, string(t)) {
+				types = append(types, t)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Wrapf(ErrUnknownGroupType, "%q", name)
+		}
+	}
+	return types, nil
+}
+
+// FormatGroupTypes formats a list of group types as accepted by ParseGroupTypes
+func FormatGroupTypes(types []GroupType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ",")
+}
+
+// splitGroupType splits a leading group type word from name.
+// When name does not start with a group type word followed by at least one more word, returns ok = false.
+func splitGroupType(name string) (t GroupType, rest string, ok bool) {
+	word, rest, found := strings.Cut(name, " ")
+	if !found {
+		return "", "", false
+	}
+
+	t, ok = groupTypeWords[strings.ToLower(word)]
+	rest = strings.TrimSpace(rest)
+	return t, rest, ok && rest != ""
+}
+
+// searchable checks if groups of the given type are searchable.
+// When types is nil, DefaultGroupTypes is used.
+func (t GroupType) searchable(types []GroupType) bool {
+	if t == GroupAll {
+		return true
+	}
+	if types == nil {
+		types = DefaultGroupTypes
+	}
+	for _, st := range types {
+		if st == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultHistorySize is the default number of snapshots kept by an engine
+const DefaultHistorySize = 20
+
+// Snapshot holds the state of a set of lights before an action was performed.
+type Snapshot struct {
+	Action Action              // the action that was performed
+	Time   time.Time           // the time the snapshot was taken
+	Lights map[int]huego.State // the state of each affected light
+}
+
+// NewSnapshot creates a snapshot of all lights affected by the given action.
+func NewSnapshot(bridge Bridge, action Action) (snapshot Snapshot, err error) {
+	snapshot.Action = action
+	snapshot.Time = time.Now()
+
+	ids, err := action.affectedLights(bridge)
+	if err != nil {
+		return snapshot, err
+	}
+
+	lights, err := bridge.GetLights(context.Background())
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.Lights = make(map[int]huego.State, len(ids))
+	for _, light := range lights {
+		if _, ok := ids[light.ID]; ok && light.State != nil {
+			snapshot.Lights[light.ID] = *light.State
+		}
+	}
+	return snapshot, nil
+}
+
+// Restore restores the state of all lights in this snapshot.
+func (snapshot Snapshot) Restore(bridge Bridge) error {
+	var eg errgroup.Group
+	for id, state := range snapshot.Lights {
+		id, state := id, restoreState(state)
+		eg.Go(func() error {
+			err := bridge.SetLightState(context.Background(), id, state)
+			return errors.Wrapf(err, "Unable to restore light %d", id)
+		})
+	}
+	return eg.Wait()
+}
+
+// restoreState returns the state to send to the bridge to restore a light to the given state.
+// Only attributes reported by the light are restored; unsupported ones are omitted from the returned state.
+func restoreState(old huego.State) huego.State {
+	// lights that are off can not be modified
+	if !old.On {
+		return huego.State{On: false}
+	}
+
+	state := huego.State{On: true, Bri: old.Bri, Effect: old.Effect}
+	switch old.ColorMode {
+	case "xy":
+		state.Xy = old.Xy
+	case "ct":
+		state.Ct = old.Ct
+	case "hs":
+		state.Hue = old.Hue
+		state.Sat = old.Sat
+	}
+	return state
+}
+
+// affectedLights returns the ids of all lights affected by this action
+func (action Action) affectedLights(bridge Bridge) (map[int]struct{}, error) {
+	ids := make(map[int]struct{})
+	add := func(part Action) error {
+		switch {
+		case part.Group != nil:
+			if err := part.Group.Refresh(bridge); err != nil {
+				return errors.Wrap(err, "Unable to find group")
+			}
+			if part.Group.ID == AllLightsID {
+				lights, err := groupLights(bridge, part.Group.Data)
+				if err != nil {
+					return errors.Wrap(err, "Unable to find lights")
+				}
+				for _, light := range lights {
+					ids[light.ID] = struct{}{}
+				}
+				return nil
+			}
+			for _, id := range part.Group.Data.Lights {
+				lID, err := strconv.Atoi(id)
+				if err != nil {
+					return err
+				}
+				ids[lID] = struct{}{}
+			}
+		case part.Light != nil:
+			ids[part.Light.ID] = struct{}{}
+		}
+		return nil
+	}
+
+	parts := action.Actions
+	if action.Macro != nil {
+		parts = action.Macro.Data.Actions
+	}
+
+	if len(parts) == 0 {
+		return ids, add(action)
+	}
+
+	for _, part := range parts {
+		if err := add(part); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// History holds a bounded list of snapshots.
+// It is safe for concurrent use.
+type History struct {
+	l         sync.Mutex
+	snapshots []Snapshot
+
+	// Size is the maximal number of snapshots retained.
+	// Size <= 0 indicates DefaultHistorySize.
+	Size int
+}
+
+// Push adds a new snapshot to this history.
+// If the history is full, the oldest snapshot is discarded.
+func (history *History) Push(snapshot Snapshot) {
+	history.l.Lock()
+	defer history.l.Unlock()
+
+	size := history.Size
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+
+	history.snapshots = append(history.snapshots, snapshot)
+	if extra := len(history.snapshots) - size; extra > 0 {
+		history.snapshots = append(history.snapshots[:0], history.snapshots[extra:]...)
+	}
+}
+
+// Pop removes the most recent snapshot from the history and returns it.
+func (history *History) Pop() (snapshot Snapshot, ok bool) {
+	history.l.Lock()
+	defer history.l.Unlock()
+
+	if len(history.snapshots) == 0 {
+		return snapshot, false
+	}
+
+	last := len(history.snapshots) - 1
+	snapshot = history.snapshots[last]
+	history.snapshots[last] = Snapshot{}
+	history.snapshots = history.snapshots[:last]
+	return snapshot, true
+}
+
+// Len returns the number of snapshots in this history.
+func (history *History) Len() int {
+	history.l.Lock()
+	defer history.l.Unlock()
+
+	return len(history.snapshots)
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+func Test_restoreState(t *testing.T) {
+	tests := []struct {
+		name string
+		old  huego.State
+		want huego.State
+	}{
+		{
+			"off",
+			huego.State{On: false, Bri: 100, Effect: "none", ColorMode: "ct", Ct: 300},
+			huego.State{On: false},
+		},
+		{
+			"on/off plug",
+			huego.State{On: true},
+			huego.State{On: true},
+		},
+		{
+			"dimmable",
+			huego.State{On: true, Bri: 100},
+			huego.State{On: true, Bri: 100},
+		},
+		{
+			"ambiance",
+			huego.State{On: true, Bri: 100, ColorMode: "ct", Ct: 300},
+			huego.State{On: true, Bri: 100, Ct: 300},
+		},
+		{
+			"color xy",
+			huego.State{On: true, Bri: 100, ColorMode: "xy", Xy: []float32{0.3, 0.4}, Ct: 300, Hue: 10, Sat: 20, Effect: "none"},
+			huego.State{On: true, Bri: 100, Xy: []float32{0.3, 0.4}, Effect: "none"},
+		},
+		{
+			"color hs",
+			huego.State{On: true, Bri: 100, ColorMode: "hs", Hue: 10, Sat: 20, Effect: "colorloop"},
+			huego.State{On: true, Bri: 100, Hue: 10, Sat: 20, Effect: "colorloop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restoreState(tt.old); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("restoreState() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
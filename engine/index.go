@@ -2,8 +2,10 @@ package engine
 
 import (
 	"context"
+	"sort"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/amimof/huego"
 	"github.com/pkg/errors"
@@ -12,9 +14,30 @@ import (
 
 // Index holds data indexed from a hue bridge and allows it to be queried.
 type Index struct {
-	Groups []huego.Group
-	Lights []huego.Light
-	Scenes []huego.Scene
+	// Bridge is the name of the bridge this index belongs to.
+	// When set, results are tagged with it.
+	Bridge string
+
+	Groups  []huego.Group
+	Lights  []huego.Light
+	Scenes  []huego.Scene
+	Sensors []huego.Sensor
+
+	// Macros are user-defined macros.
+	// They are not fetched from the bridge, but set by the engine.
+	Macros []Macro
+
+	// GroupTypes are the types of groups that can be searched.
+	// When nil, DefaultGroupTypes is used.
+	GroupTypes []GroupType
+
+	// Aliases are additional names of groups, lights and scenes.
+	// They are not fetched from the bridge, but set by the engine.
+	Aliases Aliases
+
+	// Usage is used to boost frequently used actions.
+	// When nil, no actions are boosted.
+	Usage *UsageStats
 }
 
 // ErrIndexNilBridge is returened from NewIndex when the provided bridge is not nil
@@ -25,7 +48,7 @@ var ErrIndexNilBridge = errors.New("NewIndex: bridge is nil")
 //
 // If bridge is nil, returns [ErrIndexNilBridge].
 // If an error occurs while fetching data from the bridge, returns that bridge.
-func NewIndex(bridge *huego.Bridge, ctx context.Context) (index Index, err error) {
+func NewIndex(bridge Bridge, ctx context.Context) (index Index, err error) {
 	if bridge == nil {
 		return index, ErrIndexNilBridge
 	}
@@ -34,26 +57,44 @@ func NewIndex(bridge *huego.Bridge, ctx context.Context) (index Index, err error
 
 	// fetch all of the things
 	eg.Go(func() (err error) {
-		index.Groups, err = bridge.GetGroupsContext(ctx)
+		index.Groups, err = bridge.GetGroups(ctx)
+		return
+	})
+	var all *huego.Group
+	eg.Go(func() (err error) {
+		all, err = bridge.GetGroup(ctx, AllLightsID)
 		return
 	})
 	eg.Go(func() (err error) {
-		index.Lights, err = bridge.GetLightsContext(ctx)
+		index.Lights, err = bridge.GetLights(ctx)
 		return
 	})
 	eg.Go(func() (err error) {
-		index.Scenes, err = bridge.GetScenesContext(ctx)
+		index.Scenes, err = bridge.GetScenes(ctx)
+		return
+	})
+	eg.Go(func() (err error) {
+		index.Sensors, err = bridge.GetSensors(ctx)
+		sort.Slice(index.Sensors, func(i, j int) bool {
+			return index.Sensors[i].ID < index.Sensors[j].ID
+		})
 		return
 	})
 
 	// wait for the return
 	err = eg.Wait()
+
+	// the group containing all lights goes first
+	if all != nil {
+		normalizeAllLights(all)
+		index.Groups = append([]huego.Group{*all}, index.Groups...)
+	}
 	return
 }
 
-// QueryString passes a set of queries from the index, and passes this to index.Query.
-func (index Index) QueryString(input string) ([]Action, []BufferScore, []Score) {
-	return index.Query(ParseQuery(input))
+// QueryString parses a set of queries from the input using the given locales, and passes this to index.Query.
+func (index Index) QueryString(input string, locales LocaleSet) ([]Action, []BufferScore, []Score) {
+	return index.Query(ParseQuery(input, locales))
 }
 
 var stringBufferPool = &sync.Pool{
@@ -70,22 +111,161 @@ var resultsPool = &sync.Pool{
 
 // Query runs a set of queries against this index.
 func (index Index) Query(queries []Query) (actions []Action, matchScores []BufferScore, scores []Score) {
+	results := resultsPool.Get().(*Results)
+	results.Reset(len(index.Groups) + len(index.Lights) + len(index.Macros)) // todo: do we want to cache this?
+	defer resultsPool.Put(results)
+
+	// split queries into those with a single target, and those with multiple ones
+	single := make([]Query, 0, len(queries))
+	var multi []Query
+	for _, q := range queries {
+		if len(q.Targets) == 0 {
+			single = append(single, q)
+		} else {
+			multi = append(multi, q)
+		}
+	}
+
+	index.query(results, single)
+	if len(multi) > 0 {
+		index.queryMulti(results, multi)
+	}
+
+	// tag results before boosting them, as usage is recorded per bridge
+	if index.Bridge != "" {
+		for i := range results.actions {
+			results.actions[i].Bridge = index.Bridge
+		}
+	}
+
+	// boost frequently used actions
+	if index.Usage != nil {
+		now := time.Now()
+		results.Learn(func(action Action) float64 { return index.Usage.Boost(action, now) })
+	}
+
+	actions, matchScores, scores = results.Results()
+
+	// apply the modifiers, which are identical for every query
+	if len(queries) > 0 {
+		for i := range actions {
+			queries[0].Modifiers.Apply(&actions[i])
+		}
+	}
+
+	return
+}
+
+// queryMulti runs a set of queries with multiple targets against this index, and adds them to results.
+// Each query must have the same set of targets.
+func (index Index) queryMulti(results *Results, queries []Query) {
+	primary := resultsPool.Get().(*Results)
+	primary.Reset(len(index.Groups) + len(index.Lights))
+	defer resultsPool.Put(primary)
+
+	index.query(primary, queries)
+
+	// resolve the additional targets
+	targets := make([]Action, len(queries[0].Targets))
+	for i, name := range queries[0].Targets {
+		var ok bool
+		if targets[i], ok = index.resolveTarget(name); !ok {
+			return
+		}
+	}
+
+	for i, action := range primary.actions {
+		// scenes belong to a specific group, and macros have fixed targets.
+		// neither can be applied to other targets, and neither can informational actions.
+		if action.Scene != nil || action.Macro != nil || action.ReadOnly() {
+			continue
+		}
+
+		// the matched action goes last, so that the parts are in the order of the query
+		composite := Action{
+			Actions: make([]Action, 0, len(targets)+1),
+		}
+		for _, target := range targets {
+			target.OnOff = action.OnOff
+			target.Color = action.Color
+			target.Brightness = action.Brightness
+			target.Temperature = action.Temperature
+			target.Effect = action.Effect
+			composite.Actions = append(composite.Actions, target)
+		}
+		composite.Actions = append(composite.Actions, action)
+
+		results.Add(composite, primary.actionScores[i])
+	}
+}
+
+// resolveTarget finds the group or light that best matches the given name.
+// Groups are preferred over lights when they match equally well.
+func (index Index) resolveTarget(name string) (target Action, ok bool) {
+	best := -1.0
+	for _, g := range index.Groups {
+		if !GroupTypeOf(g).searchable(index.GroupTypes) {
+			continue
+		}
+		if alias, score := scoreNames(name, g.Name, index.Aliases.Group(g.ID)); score >= 0 && (best < 0 || score < best) {
+			best = score
+			target = Action{Group: NewHueGroup(g)}
+			target.Group.Alias = alias
+		}
+	}
+	for _, l := range index.Lights {
+		if alias, score := scoreNames(name, l.Name, index.Aliases.Light(l.ID)); score >= 0 && (best < 0 || score < best) {
+			best = score
+			target = Action{Light: NewHueLight(l)}
+			target.Light.Alias = alias
+		}
+	}
+	return target, best >= 0
+}
+
+// query runs a set of queries against this index, and adds them to results.
+func (index Index) query(results *Results, queries []Query) {
 	scoring := stringBufferPool.Get().(*QueryBuffer[string])
 	defer stringBufferPool.Put(scoring)
 
-	results := resultsPool.Get().(*Results)
-	results.Reset(len(index.Groups) + len(index.Lights)) // todo: do we want to cache this?
-	defer resultsPool.Put(results)
+	// status queries only report the current state
+	status := len(queries) > 0 && queries[0].Status
 
 	for _, g := range index.Groups {
+		if !GroupTypeOf(g).searchable(index.GroupTypes) {
+			continue
+		}
+
 		scoring.Use(queries)
 
 		theGroup := NewHueGroup(g)
+		theGroup.Aliases = index.Aliases.Group(g.ID)
 
 		if !scoring.Score(func(q Query) float64 { return q.MatchGroup(theGroup) }) {
 			groupPool.Put(theGroup)
 			continue
 		}
+		theGroup.Alias = matchedAlias(scoring.Queries, func(q Query) (string, float64) { return q.matchGroup(theGroup) })
+
+		// match a status request
+		if scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchStatus() }); len(scores) > 0 {
+			theStatus := NewGroupStatus(g, index.Scenes)
+			results.Add(Action{
+				Group:  theGroup,
+				Status: &theStatus,
+			}, scores)
+		}
+		if status {
+			continue
+		}
+
+		// match the word "toggle"
+		if scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchOnOff(BoolToggle) }); len(scores) > 0 {
+			results.Add(Action{
+				Group: theGroup,
+				OnOff: BoolToggle,
+			}, scores)
+		}
 
 		// match the word "on"
 		if scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchOnOff(BoolOn) }); len(scores) > 0 {
@@ -111,20 +291,46 @@ func (index Index) Query(queries []Query) (actions []Action, matchScores []Buffe
 			}, scores)
 		}
 
+		// match the color temperature
+		if scores, _, ct := WithAnnot[Temperature](scoring).FinalizeAnnot(func(q Query) (Temperature, float64) { return q.MatchTemperature() }); len(scores) > 0 {
+			results.Add(Action{
+				Group:       theGroup,
+				Temperature: ct,
+			}, scores)
+		}
+
+		// match the brightness
+		if scores, _, bri := WithAnnot[Brightness](scoring).FinalizeAnnot(func(q Query) (Brightness, float64) { return q.MatchBrightness() }); len(scores) > 0 {
+			results.Add(Action{
+				Group:      theGroup,
+				Brightness: bri,
+			}, scores)
+		}
+
+		// match the effects
+		if scores, _, effect := WithAnnot[Effect](scoring).FinalizeAnnot(func(q Query) (Effect, float64) { return q.MatchEffect() }); len(scores) > 0 {
+			results.Add(Action{
+				Group:  theGroup,
+				Effect: effect,
+			}, scores)
+		}
+
 		// iterate over scenes in this group!
 		gID := strconv.Itoa(g.ID)
 		for _, s := range index.Scenes {
-			if s.Group != gID {
+			if sceneGroupID(s) != gID {
 				continue
 			}
 
 			theScene := NewHueScene(s)
+			theScene.Aliases = index.Aliases.Scene(s.ID)
 
-			scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchScene(theScene) })
+			scores, queries := scoring.Finalize(func(q Query) float64 { return q.MatchScene(theScene) })
 			if len(scores) == 0 {
 				scenePool.Put(theScene)
 				continue
 			}
+			theScene.Alias = matchedAlias(queries, func(q Query) (string, float64) { return q.matchScene(theScene) })
 
 			results.Add(Action{
 				Group: theGroup,
@@ -133,15 +339,70 @@ func (index Index) Query(queries []Query) (actions []Action, matchScores []Buffe
 		}
 	}
 
+	devices := sensorDevices(index.Sensors)
+	for _, s := range index.Sensors {
+		theSensor := NewHueSensor(s, devices[s.ID])
+		if theSensor == nil {
+			continue
+		}
+
+		scoring.Use(queries)
+		if !scoring.Score(func(q Query) float64 { return q.MatchSensor(theSensor) }) {
+			continue
+		}
+
+		if scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchSensorKind(theSensor.Reading.Kind) }); len(scores) > 0 {
+			results.Add(Action{
+				Sensor: theSensor,
+			}, scores)
+		}
+	}
+
+	for _, m := range index.Macros {
+		if status {
+			break
+		}
+		scoring.Use(queries)
+
+		theMacro := &HueMacro{ID: m.Name, Data: m}
+		if scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchMacro(theMacro) }); len(scores) > 0 {
+			results.Add(Action{
+				Macro: theMacro,
+			}, scores)
+		}
+	}
+
 	for _, l := range index.Lights {
 		scoring.Use(queries)
 
 		theLight := NewHueLight(l)
+		theLight.Aliases = index.Aliases.Light(l.ID)
 
 		if !scoring.Score(func(q Query) float64 { return q.MatchLight(theLight) }) {
 			lightPool.Put(theLight)
 			continue
 		}
+		theLight.Alias = matchedAlias(scoring.Queries, func(q Query) (string, float64) { return q.matchLight(theLight) })
+
+		// match a status request
+		if scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchStatus() }); len(scores) > 0 {
+			theStatus := NewLightStatus(l)
+			results.Add(Action{
+				Light:  theLight,
+				Status: &theStatus,
+			}, scores)
+		}
+		if status {
+			continue
+		}
+
+		// match the word "toggle"
+		if scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchOnOff(BoolToggle) }); len(scores) > 0 {
+			results.Add(Action{
+				Light: theLight,
+				OnOff: BoolToggle,
+			}, scores)
+		}
 
 		// match the word "on"
 		if scores, _ := scoring.Finalize(func(q Query) float64 { return q.MatchOnOff(BoolOn) }); len(scores) > 0 {
@@ -167,7 +428,30 @@ func (index Index) Query(queries []Query) (actions []Action, matchScores []Buffe
 			}, scores)
 		}
 
+		// match the color temperature
+		if scores, _, ct := WithAnnot[Temperature](scoring).FinalizeAnnot(func(q Query) (Temperature, float64) { return q.MatchTemperature() }); len(scores) > 0 {
+			results.Add(Action{
+				Light:       theLight,
+				Temperature: ct,
+			}, scores)
+		}
+
+		// match the brightness
+		if scores, _, bri := WithAnnot[Brightness](scoring).FinalizeAnnot(func(q Query) (Brightness, float64) { return q.MatchBrightness() }); len(scores) > 0 {
+			results.Add(Action{
+				Light:      theLight,
+				Brightness: bri,
+			}, scores)
+		}
+
+		// match the effects
+		if scores, _, effect := WithAnnot[Effect](scoring).FinalizeAnnot(func(q Query) (Effect, float64) { return q.MatchEffect() }); len(scores) > 0 {
+			results.Add(Action{
+				Light:  theLight,
+				Effect: effect,
+			}, scores)
+		}
+
 	}
 
-	return results.Results()
 }
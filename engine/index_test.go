@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+// newTestBridge returns a new bridge holding a small home used by tests.
+//
+// It consists of a kitchen (lights 1 and 2), a hallway (light 3) and a living room (lights 4 and 5).
+// The living room has a "Relax" and a "Bright" scene.
+func newTestBridge() *MemoryBridge {
+	groups := []huego.Group{
+		{ID: 1, Name: "Kitchen", Type: "Room", Class: "Kitchen", Lights: []string{"1", "2"}},
+		{ID: 2, Name: "Hallway", Type: "Room", Class: "Hallway", Lights: []string{"3"}},
+		{ID: 3, Name: "Living Room", Type: "Room", Class: "Living room", Lights: []string{"4", "5"}},
+	}
+	lights := []huego.Light{
+		{ID: 1, Name: "Kitchen Ceiling", ModelID: "LCT015", Type: "Extended color light", State: &huego.State{On: true, Bri: 254, ColorMode: "ct", Ct: 366, Effect: "none"}},
+		{ID: 2, Name: "Kitchen Counter", ModelID: "LTW001", Type: "Color temperature light", State: &huego.State{On: true, Bri: 254, ColorMode: "ct", Ct: 366}},
+		{ID: 3, Name: "Hallway Spot", ModelID: "LWB010", Type: "Dimmable light", State: &huego.State{On: false, Bri: 100}},
+		{ID: 4, Name: "Sofa Lamp", ModelID: "LCT015", Type: "Extended color light", State: &huego.State{On: false, Bri: 100, ColorMode: "xy", Xy: []float32{0.3, 0.3}, Effect: "none"}},
+		{ID: 5, Name: "TV Strip", ModelID: "LST002", Type: "Extended color light", State: &huego.State{On: false, Bri: 100, ColorMode: "xy", Xy: []float32{0.3, 0.3}, Effect: "none"}},
+	}
+	scenes := []huego.Scene{
+		{
+			ID: "relax-scene", Name: "Relax", Type: "GroupScene", Group: "3", Lights: []string{"4", "5"},
+			LightStates: map[int]huego.State{
+				4: {On: true, Bri: 144, Ct: 447},
+				5: {On: true, Bri: 144, Ct: 447},
+			},
+		},
+		{
+			ID: "bright-scene", Name: "Bright", Type: "GroupScene", Group: "3", Lights: []string{"4", "5"},
+			LightStates: map[int]huego.State{
+				4: {On: true, Bri: 254, Ct: 366},
+				5: {On: false},
+			},
+		},
+	}
+	return NewMemoryBridge("memory", groups, lights, scenes, nil)
+}
+
+// newTestIndex returns a new index of the bridge returned by newTestBridge
+func newTestIndex(t testing.TB) Index {
+	t.Helper()
+
+	index, err := NewIndex(newTestBridge(), context.Background())
+	if err != nil {
+		t.Fatalf("NewIndex() err = %v", err)
+	}
+	return index
+}
+
+func TestIndex_Query_multi(t *testing.T) {
+	index := newTestIndex(t)
+
+	t.Run("change", func(t *testing.T) {
+		actions, _, _ := index.QueryString("kitchen and hallway off", 0)
+		if len(actions) == 0 {
+			t.Fatal("QueryString() returned no actions")
+		}
+
+		// the most relevant result comes first
+		best := actions[0]
+		if len(best.Actions) != 2 {
+			t.Fatalf("QueryString() best action = %s, want composite of two parts", best)
+		}
+		for i, want := range []int{1, 2} {
+			part := best.Actions[i]
+			if part.Group == nil || part.Group.ID != want || part.OnOff != BoolOff {
+				t.Errorf("QueryString() part %d = %s, want group %d off", i, part, want)
+			}
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		actions, _, _ := index.QueryString("kitchen and hallway?", 0)
+		for _, action := range actions {
+			for _, part := range action.Actions {
+				if part.ReadOnly() {
+					t.Errorf("QueryString() returned composite %s with read-only part %s", action, part)
+				}
+			}
+		}
+	})
+}
+
+func TestIndex_QueryString_ranking(t *testing.T) {
+	index := newTestIndex(t)
+
+	// each query expects its most relevant result to be an action on the kitchen.
+	// queries for on or off must not be mistaken for effects or temperatures.
+	tests := []struct {
+		input       string
+		onoff       BoolOnOff
+		temperature Temperature
+		effect      Effect
+	}{
+		{"kitchen off", BoolOff, TemperatureAny, EffectAny},
+		{"kitchen of", BoolOff, TemperatureAny, EffectAny},
+		{"kitchen on", BoolOn, TemperatureAny, EffectAny},
+		{"kitchen warm", BoolAny, TemperatureFromKelvin(2700), EffectAny},
+		{"kitchen soft", BoolAny, TemperatureFromKelvin(2700), EffectAny},
+		{"kitchen stop", BoolAny, TemperatureAny, EffectStop},
+		{"kitchen flash", BoolAny, TemperatureAny, EffectFlash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			actions, _, _ := index.QueryString(tt.input, 0)
+			if len(actions) == 0 {
+				t.Fatal("QueryString() returned no actions")
+			}
+
+			// the most relevant result comes first
+			best := actions[0]
+			if best.Group == nil || best.Group.ID != 1 || best.OnOff != tt.onoff || best.Temperature != tt.temperature || best.Effect != tt.effect {
+				t.Errorf("QueryString() best action = %s", best)
+			}
+
+			if tt.onoff == BoolAny {
+				return
+			}
+			for _, action := range actions {
+				if action.Temperature != TemperatureAny || action.Effect != EffectAny {
+					t.Errorf("QueryString() returned %s", action)
+				}
+			}
+		})
+	}
+}
+
+func TestIndex_QueryString_typos(t *testing.T) {
+	groups := []huego.Group{
+		{ID: 1, Name: "Kitchen", Type: "Room", Class: "Kitchen"},
+		{ID: 2, Name: "Kitchenette", Type: "Room", Class: "Kitchen"},
+	}
+	index, err := NewIndex(NewMemoryBridge("memory", groups, nil, nil, nil), context.Background())
+	if err != nil {
+		t.Fatalf("NewIndex() err = %v", err)
+	}
+
+	// matches with typos come after matches without
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"kitchen off", 1},
+		{"kitchne off", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			actions, _, _ := index.QueryString(tt.input, 0)
+			if len(actions) == 0 {
+				t.Fatal("QueryString() returned no actions")
+			}
+			if best := actions[0]; best.Group == nil || best.Group.ID != tt.want {
+				t.Errorf("QueryString() best action = %s, want group %d", best, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mazznoer/csscolorparser"
+)
+
+// Locale represents a language the vocabulary of queries can be taken from
+type Locale string
+
+const (
+	English Locale = "en"
+	German  Locale = "de"
+	French  Locale = "fr"
+	Spanish Locale = "es"
+)
+
+// allLocales holds all supported locales.
+// The position of each locale determines its bit in a LocaleSet.
+var allLocales = []Locale{English, German, French, Spanish}
+
+// LocaleSet represents a set of locales.
+// English is always part of every set, in particular the zero value only contains English.
+type LocaleSet uint8
+
+// NewLocaleSet returns a new set containing the given locales.
+// Unsupported locales are ignored.
+func NewLocaleSet(locales ...Locale) (set LocaleSet) {
+	for _, locale := range locales {
+		for i, l := range allLocales {
+			if l == locale {
+				set |= 1 << i
+			}
+		}
+	}
+	return
+}
+
+// ParseLocales parses a comma-separated list of language tags, such as "de,fr" or an Accept-Language header like "de-DE,de;q=0.9,en;q=0.8".
+// Quality values and regions are ignored, and unsupported languages are skipped.
+func ParseLocales(value string) LocaleSet {
+	var locales []Locale
+	for _, tag := range strings.Split(value, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		tag, _, _ = strings.Cut(strings.TrimSpace(tag), "-")
+		locales = append(locales, Locale(strings.ToLower(tag)))
+	}
+	return NewLocaleSet(locales...)
+}
+
+// Locales returns the locales in this set, including English
+func (set LocaleSet) Locales() []Locale {
+	set |= 1 // English is always included
+
+	locales := make([]Locale, 0, len(allLocales))
+	for i, l := range allLocales {
+		if set&(1<<i) != 0 {
+			locales = append(locales, l)
+		}
+	}
+	return locales
+}
+
+func (set LocaleSet) String() string {
+	locales := set.Locales()
+	names := make([]string, len(locales))
+	for i, l := range locales {
+		names[i] = string(l)
+	}
+	return strings.Join(names, ",")
+}
+
+// vocabulary holds the words used to interpret queries
+type vocabulary struct {
+	onoff      map[BoolOnOff][]string
+	brightness []keyword[Brightness]
+	colors     map[string]string // from lowercase color name to hex color
+
+	// verbs and keywords are used to tokenize queries.
+	// They are only set for combined vocabularies, see [keywordSet] and [verbSet].
+	verbs    map[string]struct{}
+	keywords map[string]struct{}
+}
+
+// vocabularies holds the vocabulary for each locale.
+// The English vocabulary is extended with the CSS color names by MatchColor.
+var vocabularies = map[Locale]vocabulary{
+	English: {
+		onoff: map[BoolOnOff][]string{
+			BoolOn:     {"on"},
+			BoolOff:    {"off"},
+			BoolToggle: {"toggle"},
+		},
+		brightness: brightnessWords,
+	},
+	German: {
+		onoff: map[BoolOnOff][]string{
+			BoolOn:     {"an", "ein", "einschalten"},
+			BoolOff:    {"aus", "ausschalten"},
+			BoolToggle: {"umschalten"},
+		},
+		brightness: []keyword[Brightness]{
+			{"minimal", MinBrightness},
+			{"gedimmt", BrightnessFromPercent(20)},
+			{"dunkel", BrightnessFromPercent(20)},
+			{"halb", BrightnessFromPercent(50)},
+			{"hell", MaxBrightness},
+			{"voll", MaxBrightness},
+			{"maximal", MaxBrightness},
+		},
+		colors: translateColors(map[string]string{
+			"rot": "red", "grün": "green", "blau": "blue", "gelb": "yellow", "orange": "orange",
+			"lila": "purple", "violett": "violet", "rosa": "pink", "weiß": "white", "türkis": "turquoise",
+			"braun": "brown", "gold": "gold", "pink": "hotpink",
+		}),
+	},
+	French: {
+		onoff: map[BoolOnOff][]string{
+			BoolOn:     {"allumer", "allumé", "marche"},
+			BoolOff:    {"éteindre", "éteint", "arrêt"},
+			BoolToggle: {"basculer"},
+		},
+		brightness: []keyword[Brightness]{
+			{"minimum", MinBrightness},
+			{"tamisé", BrightnessFromPercent(20)},
+			{"sombre", BrightnessFromPercent(20)},
+			{"moitié", BrightnessFromPercent(50)},
+			{"lumineux", MaxBrightness},
+			{"plein", MaxBrightness},
+			{"maximum", MaxBrightness},
+		},
+		colors: translateColors(map[string]string{
+			"rouge": "red", "vert": "green", "bleu": "blue", "jaune": "yellow", "orange": "orange",
+			"violet": "violet", "pourpre": "purple", "rose": "pink", "blanc": "white", "turquoise": "turquoise",
+			"marron": "brown", "or": "gold",
+		}),
+	},
+	Spanish: {
+		onoff: map[BoolOnOff][]string{
+			BoolOn:     {"encender", "encendido", "prender"},
+			BoolOff:    {"apagar", "apagado"},
+			BoolToggle: {"alternar"},
+		},
+		brightness: []keyword[Brightness]{
+			{"mínimo", MinBrightness},
+			{"tenue", BrightnessFromPercent(20)},
+			{"oscuro", BrightnessFromPercent(20)},
+			{"medio", BrightnessFromPercent(50)},
+			{"brillante", MaxBrightness},
+			{"máximo", MaxBrightness},
+		},
+		colors: translateColors(map[string]string{
+			"rojo": "red", "verde": "green", "azul": "blue", "amarillo": "yellow", "naranja": "orange",
+			"morado": "purple", "violeta": "violet", "rosa": "pink", "blanco": "white", "turquesa": "turquoise",
+			"marrón": "brown", "dorado": "gold",
+		}),
+	},
+}
+
+// translateColors turns a map from localized color names to CSS color names into a map from localized names to hex colors
+func translateColors(names map[string]string) map[string]string {
+	colors := make(map[string]string, len(names))
+	for name, css := range names {
+		c, err := csscolorparser.Parse(css)
+		if err != nil {
+			panic("translateColors: invalid color " + strconv.Quote(css))
+		}
+		colors[name] = c.HexString()
+	}
+	return colors
+}
+
+// localeMask masks the bits of a LocaleSet that correspond to supported locales
+const localeMask = 1<<4 - 1
+
+// localeVocabularies holds the combined vocabulary for each possible LocaleSet
+var localeVocabularies [localeMask + 1]vocabulary
+
+func init() {
+	if 1<<len(allLocales) > len(localeVocabularies) {
+		panic("localeVocabularies: too many locales")
+	}
+
+	for i := range localeVocabularies {
+		v := vocabulary{
+			onoff:  make(map[BoolOnOff][]string),
+			colors: make(map[string]string),
+		}
+		for _, l := range LocaleSet(i).Locales() {
+			lv := vocabularies[l]
+			for onoff, words := range lv.onoff {
+				v.onoff[onoff] = append(v.onoff[onoff], words...)
+			}
+			v.brightness = append(v.brightness, lv.brightness...)
+			for name, hex := range lv.colors {
+				v.colors[name] = hex
+			}
+		}
+		v.verbs = verbSet(&v)
+		v.keywords = keywordSet(&v)
+		localeVocabularies[i] = v
+	}
+}
+
+// vocabulary returns the combined vocabulary of all locales in this set
+func (set LocaleSet) vocabulary() *vocabulary {
+	return &localeVocabularies[set&localeMask|1]
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Macro represents a named list of actions defined by the user
+type Macro struct {
+	Name    string   `json:"name"`
+	Actions []Action `json:"actions"`
+
+	// Parallel indicates if actions should be performed in parallel.
+	// By default, they are performed in order.
+	Parallel bool `json:"parallel,omitempty"`
+
+	// Bridge is the name of the bridge the macro is performed on.
+	// When empty, the macro is performed on the first bridge.
+	Bridge string `json:"bridge,omitempty"`
+}
+
+var (
+	ErrMacroNested = errors.New("Macro: macros may not contain other macros")
+	ErrMacroBridge = errors.New("Macro: actions must be performed on the bridge of the macro")
+)
+
+// Validate checks that this macro can be performed.
+//
+// All actions of a macro are performed on the bridge of the macro, hence they may not refer to any other bridge.
+// Macros may not contain other macros.
+func (macro Macro) Validate() error {
+	for _, action := range macro.Actions {
+		if action.Macro != nil {
+			return ErrMacroNested
+		}
+		if action.Bridge != "" && action.Bridge != macro.Bridge {
+			return errors.Wrapf(ErrMacroBridge, "%q", action.Bridge)
+		}
+	}
+	return nil
+}
+
+// HueMacro represents a macro within an action
+type HueMacro struct {
+	ID   string `json:"id"`
+	Data Macro  `json:"data"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// For safety reasons this only unmarshals the ID from the data source.
+// Any call should be followed by a call to Resolve.
+func (macro *HueMacro) UnmarshalJSON(data []byte) error {
+	id := &struct {
+		ID string `json:"id"`
+	}{}
+	err := json.Unmarshal(data, &id)
+	macro.ID = id.ID
+	return err
+}
+
+var ErrMacroNotFound = errors.New("HueMacro: macro not found")
+
+// Resolve reloads the data of this macro from the provided list of macros
+func (macro *HueMacro) Resolve(macros []Macro) error {
+	for _, m := range macros {
+		if m.Name == macro.ID {
+			macro.Data = m
+			return nil
+		}
+	}
+	return ErrMacroNotFound
+}
+
+// parts returns copies of the actions of this macro, with the given transition applied to each of them.
+func (macro *HueMacro) parts(transition Transition) []Action {
+	parts := make([]Action, len(macro.Data.Actions))
+	for i, action := range macro.Data.Actions {
+		parts[i] = action.clone()
+		if transition != TransitionDefault {
+			parts[i].Transition = transition
+		}
+	}
+	return parts
+}
+
+// LoadMacros loads a list of macros from the JSON file at path.
+// When any of the macros is invalid, returns an error.
+func LoadMacros(path string) (macros []Macro, err error) {
+	h, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+
+	if err := json.NewDecoder(h).Decode(&macros); err != nil {
+		return nil, err
+	}
+	for _, macro := range macros {
+		if err := macro.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "Invalid macro %q", macro.Name)
+		}
+	}
+	return macros, nil
+}
+
+// WatchMacros loads macros from the JSON file at path and calls update with them.
+// It then checks the file for changes every interval, and reloads macros when it is modified.
+//
+// WatchMacros blocks until ctx is closed.
+func WatchMacros(ctx context.Context, path string, interval time.Duration, update func(macros []Macro)) {
+	watchLogger := zerolog.Ctx(ctx).With().Str("component", "engine.WatchMacros").Str("path", path).Logger()
+
+	watchFile(ctx, path, interval, watchLogger, func() error {
+		macros, err := LoadMacros(path)
+		if err != nil {
+			return err
+		}
+
+		watchLogger.Info().Int("count", len(macros)).Msg("loaded macros")
+		update(macros)
+		return nil
+	})
+}
+
+// doMacro performs all actions of a macro, either in order or in parallel.
+// If any actions fail, returns a CompositeError holding an error for each failed action.
+func (action Action) doMacro(bridge Bridge) error {
+	parts := action.Macro.parts(action.Transition)
+	if action.Macro.Data.Parallel {
+		return Action{Actions: parts}.doComposite(bridge)
+	}
+
+	var ce CompositeError
+	for _, part := range parts {
+		if err := part.Do(bridge); err != nil {
+			ce = append(ce, TargetError{Action: part, Err: err})
+		}
+	}
+	if len(ce) > 0 {
+		return ce
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMacro_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		macro Macro
+		want  error
+	}{
+		{
+			"empty",
+			Macro{Name: "empty"},
+			nil,
+		},
+		{
+			"simple",
+			Macro{Name: "simple", Actions: []Action{{Group: &HueGroup{ID: 1}}, {Light: &HueLight{ID: 2}}}},
+			nil,
+		},
+		{
+			"same bridge",
+			Macro{Name: "same", Bridge: "upstairs", Actions: []Action{{Bridge: "upstairs", Group: &HueGroup{ID: 1}}, {Light: &HueLight{ID: 2}}}},
+			nil,
+		},
+		{
+			"other bridge",
+			Macro{Name: "other", Bridge: "upstairs", Actions: []Action{{Bridge: "downstairs", Group: &HueGroup{ID: 1}}}},
+			ErrMacroBridge,
+		},
+		{
+			"other bridge than default",
+			Macro{Name: "other", Actions: []Action{{Bridge: "downstairs", Group: &HueGroup{ID: 1}}}},
+			ErrMacroBridge,
+		},
+		{
+			"nested",
+			Macro{Name: "nested", Actions: []Action{{Macro: &HueMacro{ID: "simple"}}}},
+			ErrMacroNested,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.macro.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Macro.Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/amimof/huego"
+	"github.com/pkg/errors"
+)
+
+// MemoryBridge is a Bridge that holds all of its data in memory.
+// It allows using an engine without a physical bridge, for instance in tests.
+//
+// Changing the state of a light or group updates the stored data, and is visible to subsequent calls.
+// MemoryBridge is safe for concurrent use.
+type MemoryBridge struct {
+	host string
+
+	l       sync.RWMutex
+	groups  map[int]huego.Group
+	lights  map[int]huego.Light
+	scenes  map[string]huego.Scene
+	sensors []huego.Sensor
+}
+
+// NewMemoryBridge creates a new MemoryBridge with the given host and data.
+// The data is copied, and may be modified by the caller afterwards.
+//
+// When groups does not contain a group with AllLightsID, it is generated automatically.
+func NewMemoryBridge(host string, groups []huego.Group, lights []huego.Light, scenes []huego.Scene, sensors []huego.Sensor) *MemoryBridge {
+	mb := &MemoryBridge{
+		host:    host,
+		groups:  make(map[int]huego.Group, len(groups)),
+		lights:  make(map[int]huego.Light, len(lights)),
+		scenes:  make(map[string]huego.Scene, len(scenes)),
+		sensors: append([]huego.Sensor(nil), sensors...),
+	}
+	for _, group := range groups {
+		mb.groups[group.ID] = copyGroup(group)
+	}
+	for _, light := range lights {
+		light = copyLight(light)
+		if light.State == nil {
+			light.State = &huego.State{}
+		}
+		mb.lights[light.ID] = light
+	}
+	for _, scene := range scenes {
+		mb.scenes[scene.ID] = copyScene(scene)
+	}
+	return mb
+}
+
+var ErrMemoryBridgeNotFound = errors.New("MemoryBridge: resource not found")
+
+func (mb *MemoryBridge) Host() string {
+	return mb.host
+}
+
+func (mb *MemoryBridge) GetGroups(ctx context.Context) ([]huego.Group, error) {
+	mb.l.RLock()
+	defer mb.l.RUnlock()
+
+	groups := make([]huego.Group, 0, len(mb.groups))
+	for id := range mb.groups {
+		if id == AllLightsID {
+			continue
+		}
+		group, _ := mb.group(id)
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	return groups, nil
+}
+
+func (mb *MemoryBridge) GetGroup(ctx context.Context, id int) (*huego.Group, error) {
+	mb.l.RLock()
+	defer mb.l.RUnlock()
+
+	group, ok := mb.group(id)
+	if !ok {
+		return nil, errors.Wrapf(ErrMemoryBridgeNotFound, "group %d", id)
+	}
+	return &group, nil
+}
+
+// group returns a copy of the group with the given id, including its current state.
+// mb.l must be held.
+func (mb *MemoryBridge) group(id int) (huego.Group, bool) {
+	group, ok := mb.groups[id]
+	switch {
+	case ok:
+		group = copyGroup(group)
+	case id == AllLightsID:
+		group = huego.Group{ID: AllLightsID, Name: fmt.Sprintf("Group %d", AllLightsID), Type: "LightGroup"}
+	default:
+		return group, false
+	}
+
+	ids := mb.groupLights(id)
+	if id == AllLightsID {
+		group.Lights = make([]string, len(ids))
+		for i, lID := range ids {
+			group.Lights[i] = strconv.Itoa(lID)
+		}
+	}
+
+	state := &huego.GroupState{AllOn: len(ids) > 0}
+	for _, lID := range ids {
+		on := mb.lights[lID].State.On
+		state.AnyOn = state.AnyOn || on
+		state.AllOn = state.AllOn && on
+	}
+	group.GroupState = state
+
+	// the last action of a group is approximated by the state of its first light
+	if len(ids) > 0 {
+		action := copyState(*mb.lights[ids[0]].State)
+		group.State = &action
+	}
+	return group, true
+}
+
+// groupLights returns the sorted ids of all known lights in the group with the given id.
+// mb.l must be held.
+func (mb *MemoryBridge) groupLights(id int) []int {
+	var ids []int
+	if id == AllLightsID {
+		for lID := range mb.lights {
+			ids = append(ids, lID)
+		}
+	} else {
+		for _, light := range mb.groups[id].Lights {
+			lID, err := strconv.Atoi(light)
+			if _, ok := mb.lights[lID]; err == nil && ok {
+				ids = append(ids, lID)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (mb *MemoryBridge) GetLights(ctx context.Context) ([]huego.Light, error) {
+	mb.l.RLock()
+	defer mb.l.RUnlock()
+
+	lights := make([]huego.Light, 0, len(mb.lights))
+	for _, light := range mb.lights {
+		lights = append(lights, copyLight(light))
+	}
+	sort.Slice(lights, func(i, j int) bool {
+		return lights[i].ID < lights[j].ID
+	})
+	return lights, nil
+}
+
+func (mb *MemoryBridge) GetLight(ctx context.Context, id int) (*huego.Light, error) {
+	mb.l.RLock()
+	defer mb.l.RUnlock()
+
+	light, ok := mb.lights[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrMemoryBridgeNotFound, "light %d", id)
+	}
+	light = copyLight(light)
+	return &light, nil
+}
+
+func (mb *MemoryBridge) GetScenes(ctx context.Context) ([]huego.Scene, error) {
+	mb.l.RLock()
+	defer mb.l.RUnlock()
+
+	scenes := make([]huego.Scene, 0, len(mb.scenes))
+	for _, scene := range mb.scenes {
+		scenes = append(scenes, copyScene(scene))
+	}
+	sort.Slice(scenes, func(i, j int) bool {
+		return scenes[i].ID < scenes[j].ID
+	})
+	return scenes, nil
+}
+
+func (mb *MemoryBridge) GetScene(ctx context.Context, id string) (*huego.Scene, error) {
+	mb.l.RLock()
+	defer mb.l.RUnlock()
+
+	scene, ok := mb.scenes[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrMemoryBridgeNotFound, "scene %q", id)
+	}
+	scene = copyScene(scene)
+	return &scene, nil
+}
+
+func (mb *MemoryBridge) GetSensors(ctx context.Context) ([]huego.Sensor, error) {
+	mb.l.RLock()
+	defer mb.l.RUnlock()
+
+	return append([]huego.Sensor(nil), mb.sensors...), nil
+}
+
+func (mb *MemoryBridge) SetGroupState(ctx context.Context, id int, state huego.State) error {
+	if state.Scene != "" {
+		return mb.RecallScene(ctx, state.Scene, id, Transition(state.TransitionTime))
+	}
+	return mb.UpdateGroup(ctx, id, NewStateUpdate(state))
+}
+
+func (mb *MemoryBridge) SetLightState(ctx context.Context, id int, state huego.State) error {
+	return mb.UpdateLight(ctx, id, NewStateUpdate(state))
+}
+
+// UpdateGroup applies the given update to all lights in the group with the given id.
+// Only attributes present in the update are changed.
+func (mb *MemoryBridge) UpdateGroup(ctx context.Context, id int, update StateUpdate) error {
+	mb.l.Lock()
+	defer mb.l.Unlock()
+
+	if _, ok := mb.groups[id]; !ok && id != AllLightsID {
+		return errors.Wrapf(ErrMemoryBridgeNotFound, "group %d", id)
+	}
+
+	for _, lID := range mb.groupLights(id) {
+		applyState(mb.lights[lID].State, update)
+	}
+	return nil
+}
+
+// UpdateLight applies the given update to the light with the given id.
+// Only attributes present in the update are changed.
+func (mb *MemoryBridge) UpdateLight(ctx context.Context, id int, update StateUpdate) error {
+	mb.l.Lock()
+	defer mb.l.Unlock()
+
+	light, ok := mb.lights[id]
+	if !ok {
+		return errors.Wrapf(ErrMemoryBridgeNotFound, "light %d", id)
+	}
+	applyState(light.State, update)
+	return nil
+}
+
+func (mb *MemoryBridge) RecallScene(ctx context.Context, id string, group int, transition Transition) error {
+	mb.l.Lock()
+	defer mb.l.Unlock()
+
+	scene, ok := mb.scenes[id]
+	if !ok {
+		return errors.Wrapf(ErrMemoryBridgeNotFound, "scene %q", id)
+	}
+	if _, ok := mb.groups[group]; !ok && group != AllLightsID {
+		return errors.Wrapf(ErrMemoryBridgeNotFound, "group %d", group)
+	}
+
+	for _, light := range scene.Lights {
+		lID, err := strconv.Atoi(light)
+		if err != nil {
+			continue
+		}
+		target, ok := mb.lights[lID]
+		if !ok {
+			continue
+		}
+
+		state, ok := scene.LightStates[lID]
+		if !ok {
+			state = huego.State{On: true}
+		}
+		applyState(target.State, NewStateUpdate(state))
+	}
+	return nil
+}
+
+// StateUpdate is a change to the state of a light, as sent to the v1 api of a bridge.
+// Unlike in huego.State, attributes that are not changed are nil, rather than their zero value.
+type StateUpdate struct {
+	On     *bool     `json:"on,omitempty"`
+	Bri    *uint8    `json:"bri,omitempty"`
+	Hue    *uint16   `json:"hue,omitempty"`
+	Sat    *uint8    `json:"sat,omitempty"`
+	Xy     []float32 `json:"xy,omitempty"`
+	Ct     *uint16   `json:"ct,omitempty"`
+	Effect *string   `json:"effect,omitempty"`
+	Alert  *string   `json:"alert,omitempty"`
+}
+
+// NewStateUpdate returns the update a bridge receives when it is sent state by huego.
+// The on attribute is always present, all other attributes only when they are not zero.
+func NewStateUpdate(state huego.State) (update StateUpdate) {
+	on := state.On
+	update.On = &on
+	if state.Bri != 0 {
+		update.Bri = &state.Bri
+	}
+	if state.Hue != 0 {
+		update.Hue = &state.Hue
+	}
+	if state.Sat != 0 {
+		update.Sat = &state.Sat
+	}
+	if state.Xy != nil {
+		update.Xy = append([]float32(nil), state.Xy...)
+	}
+	if state.Ct != 0 {
+		update.Ct = &state.Ct
+	}
+	if state.Effect != "" {
+		update.Effect = &state.Effect
+	}
+	if state.Alert != "" {
+		update.Alert = &state.Alert
+	}
+	return
+}
+
+// applyState applies the attributes present in update to the light state dst, like a bridge would.
+func applyState(dst *huego.State, update StateUpdate) {
+	if update.On != nil {
+		dst.On = *update.On
+	}
+	if update.Bri != nil {
+		dst.Bri = *update.Bri
+	}
+	switch {
+	case update.Xy != nil:
+		dst.Xy = append([]float32(nil), update.Xy...)
+		dst.ColorMode = "xy"
+	case update.Ct != nil:
+		dst.Ct = *update.Ct
+		dst.ColorMode = "ct"
+	case update.Hue != nil || update.Sat != nil:
+		if update.Hue != nil {
+			dst.Hue = *update.Hue
+		}
+		if update.Sat != nil {
+			dst.Sat = *update.Sat
+		}
+		dst.ColorMode = "hs"
+	}
+	if update.Effect != nil {
+		dst.Effect = *update.Effect
+	}
+	if update.Alert != nil {
+		dst.Alert = *update.Alert
+	}
+}
+
+// copyGroup returns a copy of group that does not share any memory with it
+func copyGroup(group huego.Group) huego.Group {
+	group.Lights = append([]string(nil), group.Lights...)
+	if group.State != nil {
+		state := copyState(*group.State)
+		group.State = &state
+	}
+	if group.GroupState != nil {
+		state := *group.GroupState
+		group.GroupState = &state
+	}
+	return group
+}
+
+// copyLight returns a copy of light that does not share any memory with it
+func copyLight(light huego.Light) huego.Light {
+	if light.State != nil {
+		state := copyState(*light.State)
+		light.State = &state
+	}
+	return light
+}
+
+// copyScene returns a copy of scene that does not share any memory with it
+func copyScene(scene huego.Scene) huego.Scene {
+	scene.Lights = append([]string(nil), scene.Lights...)
+	if scene.LightStates != nil {
+		states := make(map[int]huego.State, len(scene.LightStates))
+		for id, state := range scene.LightStates {
+			states[id] = copyState(state)
+		}
+		scene.LightStates = states
+	}
+	return scene
+}
+
+// copyState returns a copy of state that does not share any memory with it
+func copyState(state huego.State) huego.State {
+	state.Xy = append([]float32(nil), state.Xy...)
+	return state
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/amimof/huego"
+)
+
+func TestMemoryBridge_UpdateLight(t *testing.T) {
+	tests := []struct {
+		name   string
+		update string
+		want   huego.State
+	}{
+		{"brightness only", `{"bri":50}`, huego.State{On: true, Bri: 50, ColorMode: "ct", Ct: 366, Effect: "none"}},
+		{"off", `{"on":false}`, huego.State{On: false, Bri: 254, ColorMode: "ct", Ct: 366, Effect: "none"}},
+		{"color", `{"xy":[0.5,0.4]}`, huego.State{On: true, Bri: 254, ColorMode: "xy", Xy: []float32{0.5, 0.4}, Ct: 366, Effect: "none"}},
+		{"hue only", `{"hue":1000}`, huego.State{On: true, Bri: 254, ColorMode: "hs", Hue: 1000, Ct: 366, Effect: "none"}},
+		{"effect", `{"effect":"colorloop"}`, huego.State{On: true, Bri: 254, ColorMode: "ct", Ct: 366, Effect: "colorloop"}},
+		{"empty", `{}`, huego.State{On: true, Bri: 254, ColorMode: "ct", Ct: 366, Effect: "none"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := newTestBridge()
+
+			var update StateUpdate
+			if err := json.Unmarshal([]byte(tt.update), &update); err != nil {
+				t.Fatal(err)
+			}
+			if err := bridge.UpdateLight(context.Background(), 1, update); err != nil {
+				t.Fatalf("UpdateLight() err = %v", err)
+			}
+
+			got := lightState(t, bridge, 1)
+			if got.On != tt.want.On || got.Bri != tt.want.Bri || got.ColorMode != tt.want.ColorMode || got.Hue != tt.want.Hue || got.Ct != tt.want.Ct || got.Effect != tt.want.Effect || len(got.Xy) != len(tt.want.Xy) {
+				t.Errorf("UpdateLight() state = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryBridge_SetLightState(t *testing.T) {
+	bridge := newTestBridge()
+
+	// huego always sends the on attribute
+	if err := bridge.SetLightState(context.Background(), 1, huego.State{Bri: 50}); err != nil {
+		t.Fatalf("SetLightState() err = %v", err)
+	}
+	if got := lightState(t, bridge, 1); got.On || got.Bri != 50 || got.Ct != 366 {
+		t.Errorf("SetLightState() state = %+v, want off with brightness 50", got)
+	}
+}
@@ -11,41 +11,74 @@ type Query struct {
 	Name string
 	// Action is the name of an action (scene or on/off) to pattern match against
 	Action string
+
+	// Targets are the names of additional targets the action should also apply to.
+	// They are set when the input contains several conjunct targets, such as "kitchen and hallway off".
+	Targets []string
+
+	// Modifiers are applied to every action resulting from this query
+	Modifiers
 }
 
 func (q Query) String() string {
-	return fmt.Sprintf("name={%s} change={%s}", q.Name, q.Action)
+	return fmt.Sprintf("name={%s} change={%s} targets={%s} transition={%s} schedule={%v} status={%t}", q.Name, q.Action, strings.Join(q.Targets, ", "), q.Transition, q.Schedule, q.Status)
 }
 
-// ParseQuery generates a set of queries from an input string
-func ParseQuery(value string) (passes []Query) {
-	// split into whitespace-delimited fields
-	fields := strings.Fields(value)
-	if len(fields) == 0 {
-		return nil
-	}
+// Modifiers represent modifiers of a query.
+// They apply to the entire query, independent of how it is split into a name and action part.
+type Modifiers struct {
+	Transition Transition
+	Schedule   *Schedule
 
-	// generate a set of "passes" of the fields.
-	//
-	// each reading pass consists of a contigous query.Name and query.Action part.
-	// the action or the name may come first, but both must be used.
-	// furthermore, each part may be empty.
-	//
-	// this means that there are 2*(len(fields) + 1) passes.
+	// Status indicates that the query ends in a question mark.
+	// Such queries only report the current state instead of changing it.
+	Status bool
 
-	passes = make([]Query, 2*(len(fields)+1))
+	// Locales are the locales whose vocabulary is used to interpret the query
+	Locales LocaleSet
+}
 
-	var first, second string
-	for i := 0; i <= len(fields); i++ {
-		first = strings.Join(fields[:i], " ")
-		second = strings.Join(fields[i:], " ")
+// Apply applies these modifiers to the provided action.
+//
+// Composite actions are scheduled as a whole, so only the transition is applied to their parts.
+func (m Modifiers) Apply(action *Action) {
+	action.Schedule = m.Schedule
+	for i := range action.Actions {
+		m.applyTransition(&action.Actions[i])
+	}
+	m.applyTransition(action)
+}
 
-		passes[2*i].Name = first
-		passes[2*i].Action = second
+func (m Modifiers) applyTransition(action *Action) {
+	action.Transition = m.Transition
+	for i := range action.Actions {
+		m.applyTransition(&action.Actions[i])
+	}
+}
 
-		passes[2*i+1].Name = second
-		passes[2*i+1].Action = first
+// parseModifiers parses modifiers from the end of fields.
+// Returns the remaining fields.
+//
+// Modifiers are only parsed as long as at least one non-modifier field remains.
+func parseModifiers(fields []string) (m Modifiers, rest []string) {
+	rest = fields
+	for {
+		if tt, r, ok := parseTransition(rest); ok && len(r) > 0 {
+			m.Transition, rest = tt, r
+			continue
+		}
+		if schedule, r, ok := parseSchedule(rest); ok && len(r) > 0 {
+			m.Schedule, rest = schedule, r
+			continue
+		}
+		return
 	}
+}
 
-	return
+// ParseQuery generates the plausible interpretations of an input string.
+// The vocabulary of the given locales is used to interpret words like "on" or "red".
+//
+// See [Statement] for the grammar being used.
+func ParseQuery(value string, locales LocaleSet) []Query {
+	return ParseStatement(value, locales).Queries()
 }
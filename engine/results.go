@@ -1,8 +1,10 @@
 package engine
 
 import (
+	"math"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/lithammer/fuzzysearch/fuzzy"
 	"github.com/mazznoer/csscolorparser"
@@ -35,50 +37,250 @@ func (r *Results) Add(action Action, actionScore BufferScore) {
 //
 
 // MatchGroup scores the object stored in this room against a group.
+// Both the name of the group and its aliases are taken into account.
+//
+// When the name starts with a group type, as in "zone upstairs", the remainder is also matched against groups of that type.
+// The group containing all lights also matches aliases such as "everything".
 func (query Query) MatchGroup(room *HueGroup) float64 {
-	return scoreText(query.Name, room.Data.Name)
+	_, score := query.matchGroup(room)
+	return score
+}
+
+// matchGroup is like MatchGroup, but additionally returns the alias that matched best
+func (query Query) matchGroup(room *HueGroup) (alias string, score float64) {
+	alias, score = scoreNames(query.Name, room.Data.Name, room.Aliases)
+	if t, rest, ok := splitGroupType(query.Name); ok && t == room.Type {
+		if tAlias, tScore := scoreNames(rest, room.Data.Name, room.Aliases); tScore >= 0 && (score < 0 || tScore < score) {
+			alias, score = tAlias, tScore
+		}
+	}
+	if room.Type == GroupAll {
+		if aScore := matchAllLights(query.Name); aScore >= 0 && (score < 0 || aScore < score) {
+			alias, score = "", aScore
+		}
+	}
+	return
 }
 
 // MatchLight scores the object stored in this room against a light.
+// Both the name of the light and its aliases are taken into account.
 func (query Query) MatchLight(light *HueLight) float64 {
-	return scoreText(query.Name, light.Data.Name)
+	_, score := query.matchLight(light)
+	return score
+}
+
+// matchLight is like MatchLight, but additionally returns the alias that matched best
+func (query Query) matchLight(light *HueLight) (alias string, score float64) {
+	return scoreNames(query.Name, light.Data.Name, light.Aliases)
 }
 
 // MatchLights scores the object stored in this room against a scene action.
+// Both the name of the scene and its aliases are taken into account.
 func (query Query) MatchScene(scene *HueScene) float64 {
-	return scoreText(query.Action, scene.Data.Name)
+	_, score := query.matchScene(scene)
+	return score
+}
+
+// matchScene is like MatchScene, but additionally returns the alias that matched best
+func (query Query) matchScene(scene *HueScene) (alias string, score float64) {
+	return scoreNames(query.Action, scene.Data.Name, scene.Aliases)
+}
+
+// MatchSensor scores the object stored in this query against a sensor.
+// Both the name of the sensor and the name of its device are taken into account.
+func (query Query) MatchSensor(sensor *HueSensor) float64 {
+	score := scoreText(query.Name, sensor.Data.Name)
+	if dScore := scoreText(query.Name, sensor.Device); dScore >= 0 && (score < 0 || dScore < score) {
+		score = dScore
+	}
+	return score
+}
+
+// MatchSensorKind scores the action stored in this query against the kind of a sensor.
+func (query Query) MatchSensorKind(kind SensorKind) float64 {
+	score := -1.0
+	for _, word := range sensorWords[kind] {
+		if wScore := scoreText(query.Action, word); wScore >= 0 && (score < 0 || wScore < score) {
+			score = wScore
+		}
+	}
+	return score
+}
+
+// MatchMacro scores the object stored in this query against a macro.
+// Macros take no action, so only queries without an action can match.
+func (query Query) MatchMacro(macro *HueMacro) float64 {
+	if query.Action != "" {
+		return -1
+	}
+	return scoreText(query.Name, macro.Data.Name)
+}
+
+// MatchStatus scores the action in this query against a status request.
+//
+// Queries ending in a question mark match only with an empty action.
+// Otherwise the action must be a prefix of a word such as "status".
+// This prevents words like "aus" from being mistaken for a status request.
+func (query Query) MatchStatus() float64 {
+	if query.Status {
+		if query.Action != "" {
+			return -1
+		}
+		return 0
+	}
+
+	action := strings.ToLower(query.Action)
+	if action == "" {
+		return -1
+	}
+
+	score := -1.0
+	for _, word := range statusWords {
+		if !strings.HasPrefix(word.Word, action) {
+			continue
+		}
+		if wScore := scoreText(action, word.Word); score < 0 || wScore < score {
+			score = wScore
+		}
+	}
+	return score
 }
 
 // MatchOnOff scores the action stored in this scene against an on/off action.
+// The words of all locales of the query are taken into account.
+//
+// A toggle action only matches an empty action or a prefix of a word for "toggle".
+// This prevents single letters like "o" from preferring a toggle over on and off.
 func (query Query) MatchOnOff(onoff BoolOnOff) float64 {
-	return scoreText(query.Action, string(onoff))
+	action := strings.ToLower(query.Action)
+
+	score := -1.0
+	for _, word := range query.Locales.vocabulary().onoff[onoff] {
+		if onoff == BoolToggle && !strings.HasPrefix(word, action) {
+			continue
+		}
+		if wScore := scoreText(query.Action, word); wScore >= 0 && (score < 0 || wScore < score) {
+			score = wScore
+		}
+	}
+	return score
 }
 
 // MatchColor scores the action in this scene against a color action.
+// Besides CSS colors, the color names of all locales of the query are taken into account.
 func (query Query) MatchColor() (color string, score float64) {
+	if hex, ok := query.Locales.vocabulary().colors[strings.ToLower(query.Action)]; ok {
+		return hex, 0
+	}
+
 	c, err := csscolorparser.Parse(query.Action)
 	if err != nil || c.A != 1 {
 		return "", -1.0
 	}
-	return c.HexString(), 1.0
+	return c.HexString(), 0
+}
+
+// MatchBrightness scores the action in this query against a brightness action.
+//
+// Numeric brightness values always match exactly, with a score of 0.
+// Otherwise the action is matched against a fixed set of brightness words, such as "dim" or "bright", in all locales of the query.
+func (query Query) MatchBrightness() (bri Brightness, score float64) {
+	if value, ok := ParseBrightness(query.Action); ok {
+		return value, 0
+	}
+
+	return scoreKeywords(query.Action, query.Locales.vocabulary().brightness)
+}
+
+// MatchTemperature scores the action in this query against a color temperature action.
+//
+// Numeric temperatures (in Kelvin or mired) always match exactly, with a score of 0.
+// Otherwise the action must be a prefix of a named white, such as "warm white" or "daylight".
+// This prevents words like "of" from being mistaken for "soft white".
+func (query Query) MatchTemperature() (ct Temperature, score float64) {
+	if value, ok := ParseTemperature(query.Action); ok {
+		return value, 0
+	}
+	return scorePrefixKeywords(query.Action, temperatureWords)
+}
+
+// MatchEffect scores the action in this query against an effect action.
+// The action must be a prefix of a word for the effect, such as "flash" or "stop effects".
+// This prevents words like "off" from being mistaken for "stop effects".
+func (query Query) MatchEffect() (effect Effect, score float64) {
+	return scorePrefixKeywords(query.Action, effectWords)
+}
+
+// keyword represents a word that corresponds to a specific value
+type keyword[T any] struct {
+	Word  string
+	Value T
+}
+
+// scoreKeywords scores source against a set of keywords.
+// It returns the value of the closest matching keyword, along with its score.
+//
+// An empty source never matches any keyword.
+func scoreKeywords[T any](source string, keywords []keyword[T]) (value T, score float64) {
+	score = -1.0
+	if source == "" {
+		return
+	}
+
+	for _, word := range keywords {
+		wScore := scoreText(source, word.Word)
+		if wScore < 0 || (score >= 0 && wScore >= score) {
+			continue
+		}
+		value, score = word.Value, wScore
+	}
+	return
+}
+
+// scorePrefixKeywords is like scoreKeywords, but only takes keywords into account that source is a prefix of.
+func scorePrefixKeywords[T any](source string, keywords []keyword[T]) (value T, score float64) {
+	lower := strings.ToLower(source)
+
+	prefixed := make([]keyword[T], 0, len(keywords))
+	for _, word := range keywords {
+		if strings.HasPrefix(word.Word, lower) {
+			prefixed = append(prefixed, word)
+		}
+	}
+	return scoreKeywords(source, prefixed)
 }
 
 // scoreText is the main scoring function.
 // It scores a source text against a target match.
+// Both texts are compared case-insensitively and without diacritics.
 //
-// If a match exists, the value will be between 0 and 1.
+// If the source occurs within the target, the value will be between 0 and 1.
 // The lower the score, the closer the match.
 //
+// When the source does not occur within the target, a limited amount of typos is tolerated.
+// Each typo is penalized using TypoPenalty, and the value will be between 1 and 2.
+// Matches with typos thus always score worse than matches without.
+//
 // If the source does not overlap with the target, the value returned will be -1.
 func scoreText(source, target string) float64 {
 	if len(target) == 0 {
 		return 0
 	}
-	// RankMatchNormalizedFold computes the edit distance between source and target.
+
+	source, target = foldText(source), foldText(target)
+
+	// RankMatch computes the edit distance between source and target.
 	// it will be -1 if there is no match.
-	score := float64(fuzzy.RankMatchNormalizedFold(source, target))
+	score := float64(fuzzy.RankMatch(source, target))
 	if score == -1 {
-		return -1
+		typos := scoreTypos(source, target)
+		if typos < 0 {
+			return -1
+		}
+
+		score = float64(len(target)-len(source)) + float64(TypoPenalty*typos)
+		score = math.Max(0, math.Min(score, float64(len(target))))
+		return 1 + score/float64(len(target))
 	}
 	return score / float64(len(target))
 }
@@ -89,9 +291,9 @@ func scoreText(source, target string) float64 {
 
 // Score represents the final score of a single action
 //
-// The score consists of four components; see the [Score] method of an action details.
-// Scores are ordered lexiographically from index 0 to index 3; see the Less method for details.
-type Score [4]float64
+// The score consists of six components; see the [Score] method of an action details.
+// Scores are ordered lexiographically from index 0 to index 5; see the Less method for details.
+type Score [6]float64
 
 // Less compares this score to another score using lexiographic ordering.
 // An ction
@@ -109,17 +311,34 @@ func (s Score) Less(other Score) bool {
 	return false
 }
 
+// Learn applies a learned boost to this score.
+// Higher boosts move the score towards the front.
+func (s *Score) Learn(boost float64) {
+	s[0] -= boost + s[1] // undo any previous boost
+	s[1] = -boost
+}
+
 // Score returns the score of this action with respect to the given buffer score.
-// It returns the four components of a score, which are:
+// It returns the six components of a score, which are:
 //
-// 0. the final buffer score
-// 1. a score based on the kind of action this is
-// 2. a score based on the original sort of this item
-// 3. a score based on the parameters of the action
+// 0. the final buffer score, including the learned usage score
+// 1. a learned score based on how often the action has been used, see [Score.Learn]
+// 2. a score based on the kind of action this is
+// 3. a score based on the type of group, preferring rooms over zones
+// 4. a score based on the original sort of this item
+// 5. a score based on the parameters of the action
+//
+// Composite actions are scored like their last part.
+// The learned score is initially 0.
 func (action Action) Score(buffer BufferScore) Score {
-	return [4]float64{
+	if len(action.Actions) > 0 {
+		return action.Actions[len(action.Actions)-1].Score(buffer)
+	}
+	return [6]float64{
 		buffer.Final(),
+		0,
 		action.kindScore(),
+		action.groupTypeScore(),
 		action.itemIndexScore(),
 		action.actionIndexScore(),
 	}
@@ -138,10 +357,10 @@ type BufferScore [][]float64
 
 // Final turns this BufferScore into a single float64 score.
 //
-// The final score is the sum of each maximal score.
-// To allow for easier sorting, the total is negated before being returned.
+// Each sub score is a distance, meaning lower scores are better matches.
+// The final score is the sum of the minimal score of each sub score.
 //
-// If this BufferScore is invalid, it is negated.
+// If this BufferScore is invalid, it returns 0.
 func (b BufferScore) Final() (total float64) {
 	// no queries => nothing to be scored
 	if len(b) == 0 {
@@ -156,18 +375,18 @@ func (b BufferScore) Final() (total float64) {
 	}
 
 	for i := 0; i < scores; i++ {
-		max := b[0][i] // the max for the current element
+		min := b[0][i] // the min for the current element
 		for _, q := range b[1:] {
 			// quick bounds check; on the first iteration only
 			// if the bounds are incorrect, return 0
 			if i == 0 && len(q) != scores {
 				return 0
 			}
-			if q[i] > max {
-				max = q[i]
+			if q[i] < min {
+				min = q[i]
 			}
 		}
-		total -= max // add to the total
+		total += min // add to the total
 	}
 
 	return
@@ -176,11 +395,21 @@ func (b BufferScore) Final() (total float64) {
 // kind scores for the given action
 // they are sorted increasing in the frontend
 const (
-	GroupOnOffScore float64 = iota
+	MacroScore float64 = iota
+	GroupOnOffScore
 	GroupColorScore
+	GroupTemperatureScore
+	GroupBrightnessScore
 	GroupSceneScore
+	GroupEffectScore
+	GroupStatusScore
 	LightOnOffScore
 	LightColorScore
+	LightTemperatureScore
+	LightBrightnessScore
+	LightEffectScore
+	LightStatusScore
+	SensorScore
 	SpecialScore
 )
 
@@ -192,23 +421,56 @@ func (action Action) kindScore() float64 {
 	isScene := action.Scene != nil
 	isColor := action.Color != ""
 	isOnOff := action.OnOff != BoolAny
+	isTemperature := action.Temperature != TemperatureAny
+	isBrightness := action.Brightness != BrightnessAny
+	isEffect := action.Effect != EffectAny
+	isStatus := action.Status != nil
 
 	switch {
+	case action.Macro != nil:
+		return MacroScore
+	case action.Sensor != nil:
+		return SensorScore
+	case isGroup && isStatus:
+		return GroupStatusScore
+	case isLight && isStatus:
+		return LightStatusScore
 	case isGroup && isOnOff:
 		return GroupOnOffScore
 	case isGroup && isColor:
 		return GroupColorScore
+	case isGroup && isTemperature:
+		return GroupTemperatureScore
+	case isGroup && isBrightness:
+		return GroupBrightnessScore
 	case isGroup && isScene:
 		return GroupSceneScore
+	case isGroup && isEffect:
+		return GroupEffectScore
 	case isLight && isOnOff:
 		return LightOnOffScore
 	case isLight && isColor:
 		return LightColorScore
+	case isLight && isTemperature:
+		return LightTemperatureScore
+	case isLight && isBrightness:
+		return LightBrightnessScore
+	case isLight && isEffect:
+		return LightEffectScore
 	default:
 		return SpecialScore
 	}
 }
 
+// groupTypeScore returns a score based on the type of group this action applies to.
+// Actions that do not apply to a group all have the same score.
+func (action Action) groupTypeScore() float64 {
+	if action.Group == nil {
+		return 0
+	}
+	return action.Group.Type.rank()
+}
+
 // itemIndexScore returns the index of this score within the index of all possible actions in the hulio api.
 func (action Action) itemIndexScore() float64 {
 	if action.Group != nil {
@@ -217,6 +479,9 @@ func (action Action) itemIndexScore() float64 {
 	if action.Light != nil {
 		return -float64(action.Light.ID)
 	}
+	if action.Sensor != nil {
+		return -float64(action.Sensor.ID)
+	}
 	return 0
 }
 
@@ -227,11 +492,19 @@ func (action Action) actionIndexScore() float64 {
 		return float64(i)
 	}
 	switch action.OnOff {
+	case BoolToggle:
+		return 0 // toggle should come before on and off
 	case BoolOn:
 		return 1
 	case BoolOff:
 		return 2
 	}
+	if action.Temperature != TemperatureAny {
+		return float64(action.Temperature)
+	}
+	if action.Brightness != BrightnessAny {
+		return -float64(action.Brightness)
+	}
 
 	return 0
 }
@@ -240,6 +513,13 @@ func (action Action) actionIndexScore() float64 {
 // FOR SORTING
 //
 
+// Learn applies the learned boost of each action to its score
+func (r *Results) Learn(boost func(action Action) float64) {
+	for i, action := range r.actions {
+		r.scores[i].Learn(boost(action))
+	}
+}
+
 // Results returns a li t
 func (r *Results) Results() ([]Action, []BufferScore, []Score) {
 	sort.Sort(r)
@@ -268,6 +548,12 @@ type QueryBuffer[Annot any] struct {
 	Scores  BufferScore
 }
 
+// WithAnnot returns a QueryBuffer that shares queries and scores with qb, but uses a different type of annotations.
+// Any changes to the returned QueryBuffer are reflected in qb and vice versa.
+func WithAnnot[To, From any](qb *QueryBuffer[From]) *QueryBuffer[To] {
+	return (*QueryBuffer[To])(qb)
+}
+
 // Use resets this QueryBuffer to use the given set of queries.
 // The scores are reset to be empty.
 func (sq *QueryBuffer[A]) Use(Queries []Query) {
@@ -0,0 +1,56 @@
+package engine
+
+import "testing"
+
+func TestQuery_MatchTemperature(t *testing.T) {
+	tests := []struct {
+		action    string
+		want      Temperature
+		wantMatch bool
+	}{
+		{"2700K", TemperatureFromKelvin(2700), true},
+		{"warm", TemperatureFromKelvin(2700), true},
+		{"soft", TemperatureFromKelvin(2700), true},
+		{"day", TemperatureFromKelvin(6500), true},
+
+		// words that only occur within a named white
+		{"of", TemperatureAny, false},
+		{"o", TemperatureAny, false},
+		{"white", TemperatureAny, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			got, score := Query{Action: tt.action}.MatchTemperature()
+			if match := score >= 0; match != tt.wantMatch || (match && got != tt.want) {
+				t.Errorf("MatchTemperature() = %v, %v, want %v, %v", got, score, tt.want, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestQuery_MatchEffect(t *testing.T) {
+	tests := []struct {
+		action    string
+		want      Effect
+		wantMatch bool
+	}{
+		{"flash", EffectFlash, true},
+		{"fla", EffectFlash, true},
+		{"stop", EffectStop, true},
+		{"stop eff", EffectStop, true},
+		{"color", EffectColorloop, true},
+
+		// words that only occur within an effect
+		{"off", EffectAny, false},
+		{"on", EffectAny, false},
+		{"loop", EffectAny, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			got, score := Query{Action: tt.action}.MatchEffect()
+			if match := score >= 0; match != tt.wantMatch || (match && got != tt.want) {
+				t.Errorf("MatchEffect() = %v, %v, want %v, %v", got, score, tt.want, tt.wantMatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule describes when a delayed or timed action should be performed.
+type Schedule struct {
+	Delay time.Duration `json:"delay,omitempty"` // perform the action after this delay
+	At    string        `json:"at,omitempty"`    // perform the action at the next occurence of this time of day (in 15:04 format)
+}
+
+// ClockLayout is the layout of the At field of a Schedule
+const ClockLayout = "15:04"
+
+// clockLayouts are layouts that are accepted as time of day
+var clockLayouts = []string{ClockLayout, "3:04pm", "3pm"}
+
+// Next returns the time at which an action with this schedule should be performed when it is scheduled at now.
+func (s Schedule) Next(now time.Time) (time.Time, error) {
+	if s.At == "" {
+		return now.Add(s.Delay), nil
+	}
+
+	clock, err := time.Parse(ClockLayout, s.At)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next.Add(s.Delay), nil
+}
+
+func (s Schedule) String() string {
+	switch {
+	case s.At != "" && s.Delay != 0:
+		return fmt.Sprintf("at %s + %s", s.At, s.Delay)
+	case s.At != "":
+		return "at " + s.At
+	default:
+		return "in " + s.Delay.String()
+	}
+}
+
+// parseSchedule attempts to parse a schedule from the end of fields.
+// Returns the remaining fields.
+func parseSchedule(fields []string) (*Schedule, []string, bool) {
+	if len(fields) < 2 {
+		return nil, fields, false
+	}
+
+	value := strings.ToLower(fields[len(fields)-1])
+	rest := fields[:len(fields)-2]
+
+	switch strings.ToLower(fields[len(fields)-2]) {
+	case "in":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fields, false
+		}
+		return &Schedule{Delay: d}, rest, true
+	case "at":
+		for _, layout := range clockLayouts {
+			clock, err := time.Parse(layout, value)
+			if err != nil {
+				continue
+			}
+			return &Schedule{At: clock.Format(ClockLayout)}, rest, true
+		}
+	}
+	return nil, fields, false
+}
@@ -0,0 +1,349 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Job represents an action that is scheduled to be performed at a specific time.
+type Job struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+
+	// Description is a human-readable description of the action.
+	// It is stored separately, because only ids of groups and lights are restored from a store.
+	Description string `json:"description"`
+}
+
+// SchedulerRetryDelay is the delay after which a job is retried when the engine is not yet connected to a bridge.
+const SchedulerRetryDelay = 30 * time.Second
+
+// DefaultSchedulerGrace is the default grace period of a scheduler
+const DefaultSchedulerGrace = 15 * time.Minute
+
+// Scheduler holds and performs scheduled jobs.
+// Jobs are persisted to a store, so that they survive restarts.
+//
+// A scheduler is safe for concurrent use.
+type Scheduler struct {
+	l sync.Mutex
+
+	// Store is used to persist jobs.
+	// When nil, jobs are only kept in memory.
+	Store JobStore
+
+	// Grace is the maximal delay after its time with which a job is still performed.
+	// Jobs that are overdue by more, for instance because they were missed while huelio was not running, are dropped.
+	// Grace <= 0 indicates DefaultSchedulerGrace.
+	Grace time.Duration
+
+	loaded bool
+	jobs   []Job // ordered by time
+	wake   chan struct{}
+}
+
+var ErrSchedulerUnknownJob = errors.New("Scheduler: unknown job")
+
+// Jobs returns a list of pending jobs, ordered by time.
+func (scheduler *Scheduler) Jobs() ([]Job, error) {
+	scheduler.l.Lock()
+	defer scheduler.l.Unlock()
+
+	if err := scheduler.load(); err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, len(scheduler.jobs))
+	copy(jobs, scheduler.jobs)
+	return jobs, nil
+}
+
+// Add schedules action to be performed at the given time.
+// Any schedule of the action itself is removed.
+func (scheduler *Scheduler) Add(action Action, at time.Time) (job Job, err error) {
+	job.ID, err = newJobID()
+	if err != nil {
+		return job, err
+	}
+
+	action.Schedule = nil
+	job.Action = action
+	job.Time = at
+	job.Description = action.String()
+
+	scheduler.l.Lock()
+	defer scheduler.l.Unlock()
+
+	if err := scheduler.load(); err != nil {
+		return job, err
+	}
+
+	scheduler.insert(job)
+	return job, scheduler.save()
+}
+
+// Cancel cancels the job with the given id.
+func (scheduler *Scheduler) Cancel(id string) error {
+	scheduler.l.Lock()
+	defer scheduler.l.Unlock()
+
+	if err := scheduler.load(); err != nil {
+		return err
+	}
+
+	for i, job := range scheduler.jobs {
+		if job.ID != id {
+			continue
+		}
+		scheduler.jobs = append(scheduler.jobs[:i], scheduler.jobs[i+1:]...)
+		scheduler.notify()
+		return scheduler.save()
+	}
+	return ErrSchedulerUnknownJob
+}
+
+// Run performs scheduled jobs once they are due, until ctx is closed.
+// Jobs that are overdue by more than the grace period are dropped instead.
+// Jobs that fail with [ErrEngineMissingBridge] are retried after [SchedulerRetryDelay].
+//
+// Run blocks, and should be called at most once.
+func (scheduler *Scheduler) Run(ctx context.Context, perform func(action Action) error) {
+	schedulerLogger := zerolog.Ctx(ctx).With().Str("component", "engine.Scheduler").Logger()
+
+	for {
+		next, ok, err := scheduler.next()
+		if err != nil {
+			schedulerLogger.Error().Err(err).Msg("unable to load jobs")
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if ok {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-scheduler.wakeChan():
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-due:
+			jobs, missed, err := scheduler.due(time.Now())
+			if err != nil {
+				schedulerLogger.Error().Err(err).Msg("unable to update jobs")
+			}
+			for _, job := range missed {
+				schedulerLogger.Warn().Str("job", job.ID).Str("action", job.Description).Time("time", job.Time).Msg("dropping missed job")
+			}
+			for _, job := range jobs {
+				schedulerLogger.Info().Str("job", job.ID).Str("action", job.Description).Msg("performing scheduled job")
+
+				err := perform(job.Action)
+				switch {
+				case errors.Is(err, ErrEngineMissingBridge):
+					schedulerLogger.Warn().Str("job", job.ID).Msg("bridge not connected, retrying job later")
+					if err := scheduler.retry(job, time.Now().Add(SchedulerRetryDelay)); err != nil {
+						schedulerLogger.Error().Err(err).Str("job", job.ID).Msg("unable to reschedule job")
+					}
+				case err != nil:
+					schedulerLogger.Error().Err(err).Str("job", job.ID).Msg("scheduled job failed")
+				}
+			}
+		}
+	}
+}
+
+// next returns the time of the next job
+func (scheduler *Scheduler) next() (time.Time, bool, error) {
+	scheduler.l.Lock()
+	defer scheduler.l.Unlock()
+
+	if err := scheduler.load(); err != nil {
+		return time.Time{}, false, err
+	}
+
+	if len(scheduler.jobs) == 0 {
+		return time.Time{}, false, nil
+	}
+	return scheduler.jobs[0].Time, true, nil
+}
+
+// due removes and returns all jobs that are due at now.
+// Jobs that are overdue by more than the grace period are returned as missed, and should not be performed.
+func (scheduler *Scheduler) due(now time.Time) (jobs, missed []Job, err error) {
+	scheduler.l.Lock()
+	defer scheduler.l.Unlock()
+
+	if err := scheduler.load(); err != nil {
+		return nil, nil, err
+	}
+
+	grace := scheduler.Grace
+	if grace <= 0 {
+		grace = DefaultSchedulerGrace
+	}
+	deadline := now.Add(-grace)
+
+	i := sort.Search(len(scheduler.jobs), func(i int) bool {
+		return scheduler.jobs[i].Time.After(now)
+	})
+	for _, job := range scheduler.jobs[:i] {
+		if job.Time.Before(deadline) {
+			missed = append(missed, job)
+		} else {
+			jobs = append(jobs, job)
+		}
+	}
+	scheduler.jobs = append(scheduler.jobs[:0], scheduler.jobs[i:]...)
+
+	return jobs, missed, scheduler.save()
+}
+
+// retry re-inserts job to be performed at the given time
+func (scheduler *Scheduler) retry(job Job, at time.Time) error {
+	scheduler.l.Lock()
+	defer scheduler.l.Unlock()
+
+	job.Time = at
+	scheduler.insert(job)
+	return scheduler.save()
+}
+
+// insert inserts a job into the list of jobs, and wakes up the scheduler.
+// scheduler.l must be held.
+func (scheduler *Scheduler) insert(job Job) {
+	i := sort.Search(len(scheduler.jobs), func(i int) bool {
+		return scheduler.jobs[i].Time.After(job.Time)
+	})
+
+	scheduler.jobs = append(scheduler.jobs, Job{})
+	copy(scheduler.jobs[i+1:], scheduler.jobs[i:])
+	scheduler.jobs[i] = job
+
+	scheduler.notify()
+}
+
+// wakeChan returns a channel that receives when the list of jobs changes
+func (scheduler *Scheduler) wakeChan() <-chan struct{} {
+	scheduler.l.Lock()
+	defer scheduler.l.Unlock()
+
+	if scheduler.wake == nil {
+		scheduler.wake = make(chan struct{}, 1)
+	}
+	return scheduler.wake
+}
+
+// notify wakes up the run loop.
+// scheduler.l must be held.
+func (scheduler *Scheduler) notify() {
+	if scheduler.wake == nil {
+		scheduler.wake = make(chan struct{}, 1)
+	}
+	select {
+	case scheduler.wake <- struct{}{}:
+	default:
+	}
+}
+
+// load loads jobs from the store, unless they have already been loaded.
+// scheduler.l must be held.
+func (scheduler *Scheduler) load() error {
+	if scheduler.loaded || scheduler.Store == nil {
+		return nil
+	}
+
+	jobs, err := scheduler.Store.Read()
+	if err != nil {
+		return errors.Wrap(err, "unable to read jobs")
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Time.Before(jobs[j].Time)
+	})
+
+	scheduler.jobs = jobs
+	scheduler.loaded = true
+	return nil
+}
+
+// save writes all jobs to the store.
+// scheduler.l must be held.
+func (scheduler *Scheduler) save() error {
+	if scheduler.Store == nil {
+		return nil
+	}
+	return errors.Wrap(scheduler.Store.Write(scheduler.jobs), "unable to write jobs")
+}
+
+// newJobID generates a new random job id
+func newJobID() (string, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+// JobStore reads and writes scheduled jobs
+type JobStore interface {
+	// Read reads jobs from this store.
+	// When no jobs exist, returns nil.
+	Read() ([]Job, error)
+
+	// Write writes jobs to this store, replacing any existing jobs.
+	Write(jobs []Job) error
+}
+
+// JSONFileJobStore stores jobs in the provided JSON file on disk.
+// Implements JobStore.
+type JSONFileJobStore string
+
+// Read reads jobs from the provided filename on disk.
+//
+// When the file does not exist, the store is considered empty.
+func (f JSONFileJobStore) Read() (jobs []Job, err error) {
+	h, err := os.Open(string(f))
+	if err != nil {
+		// file does not exist, meaning the store it empty
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer h.Close()
+
+	err = json.NewDecoder(h).Decode(&jobs)
+	return jobs, err
+}
+
+// Write writes jobs to the provided filename on disk.
+//
+// When creating a new file, uses chmod 0600 to prevent other users from accessing the file.
+func (f JSONFileJobStore) Write(jobs []Job) error {
+	h, err := os.OpenFile(string(f), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	if jobs == nil {
+		jobs = []Job{}
+	}
+	return json.NewEncoder(h).Encode(jobs)
+}
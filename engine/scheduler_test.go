@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// memoryJobStore is a JobStore that holds jobs in memory
+type memoryJobStore struct {
+	jobs []Job
+	err  error // returned by write
+}
+
+func (store *memoryJobStore) Read() ([]Job, error) {
+	return store.jobs, nil
+}
+
+func (store *memoryJobStore) Write(jobs []Job) error {
+	if store.err != nil {
+		return store.err
+	}
+	store.jobs = append([]Job(nil), jobs...)
+	return nil
+}
+
+func TestScheduler_due(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store := &memoryJobStore{jobs: []Job{
+		{ID: "future", Time: now.Add(time.Minute)},
+		{ID: "missed", Time: now.Add(-time.Hour)},
+		{ID: "due", Time: now.Add(-time.Minute)},
+		{ID: "now", Time: now},
+	}}
+	scheduler := &Scheduler{Store: store, Grace: 10 * time.Minute}
+
+	jobs, missed, err := scheduler.due(now)
+	if err != nil {
+		t.Fatalf("due() err = %v", err)
+	}
+	if got := jobIDs(jobs); got != "due,now" {
+		t.Errorf("due() jobs = %s, want due,now", got)
+	}
+	if got := jobIDs(missed); got != "missed" {
+		t.Errorf("due() missed = %s, want missed", got)
+	}
+	if got := jobIDs(store.jobs); got != "future" {
+		t.Errorf("due() stored = %s, want future", got)
+	}
+}
+
+func TestScheduler_due_saveError(t *testing.T) {
+	now := time.Now()
+
+	errWrite := errors.New("write failed")
+	store := &memoryJobStore{jobs: []Job{{ID: "due", Time: now}}, err: errWrite}
+	scheduler := &Scheduler{Store: store}
+
+	jobs, _, err := scheduler.due(now)
+	if !errors.Is(err, errWrite) {
+		t.Errorf("due() err = %v, want %v", err, errWrite)
+	}
+	if got := jobIDs(jobs); got != "due" {
+		t.Errorf("due() jobs = %s, want due", got)
+	}
+}
+
+func jobIDs(jobs []Job) (ids string) {
+	for i, job := range jobs {
+		if i > 0 {
+			ids += ","
+		}
+		ids += job.ID
+	}
+	return
+}
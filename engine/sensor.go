@@ -0,0 +1,231 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/amimof/huego"
+)
+
+// SensorKind represents the kind of a sensor
+type SensorKind string
+
+const (
+	SensorTemperature SensorKind = "temperature"
+	SensorPresence    SensorKind = "presence"
+	SensorLightLevel  SensorKind = "lightlevel"
+	SensorDaylight    SensorKind = "daylight"
+	SensorSwitch      SensorKind = "switch"
+)
+
+// sensorKinds maps hue sensor types to their kind.
+// Sensors of other types are not indexed.
+var sensorKinds = map[string]SensorKind{
+	"ZLLTemperature":  SensorTemperature,
+	"CLIPTemperature": SensorTemperature,
+	"ZLLPresence":     SensorPresence,
+	"CLIPPresence":    SensorPresence,
+	"ZLLLightLevel":   SensorLightLevel,
+	"CLIPLightLevel":  SensorLightLevel,
+	"Daylight":        SensorDaylight,
+	"ZLLSwitch":       SensorSwitch,
+	"ZGPSwitch":       SensorSwitch,
+}
+
+// sensorWords are words that match a specific kind of sensor
+var sensorWords = map[SensorKind][]string{
+	SensorTemperature: {"temperature", "temp"},
+	SensorPresence:    {"motion", "presence"},
+	SensorLightLevel:  {"light level", "lux"},
+	SensorDaylight:    {"daylight", "sun"},
+	SensorSwitch:      {"switch", "button"},
+}
+
+// HueSensor represents a hue sensor
+type HueSensor struct {
+	ID   int          `json:"id"`
+	Data huego.Sensor `json:"data"`
+
+	// Device is the name of the device this sensor belongs to.
+	// Hue motion sensors consist of several sensors, only one of which carries the name given by the user.
+	Device string `json:"device"`
+
+	Reading SensorReading `json:"reading"`
+}
+
+// SensorReading represents the current reading of a sensor.
+// Only the fields applicable to the kind of sensor are set.
+type SensorReading struct {
+	Kind SensorKind `json:"kind"`
+
+	Temperature *float64 `json:"temperature,omitempty"` // in degrees celsius
+	Presence    *bool    `json:"presence,omitempty"`
+	LightLevel  *float64 `json:"lightlevel,omitempty"` // in lux
+	Dark        *bool    `json:"dark,omitempty"`
+	Daylight    *bool    `json:"daylight,omitempty"`
+	ButtonEvent *int     `json:"buttonevent,omitempty"`
+
+	LastUpdated string `json:"lastupdated,omitempty"`
+
+	Battery   *int  `json:"battery,omitempty"` // in percent
+	Reachable *bool `json:"reachable,omitempty"`
+}
+
+// Equal checks if reading and other are the same
+func (reading SensorReading) Equal(other SensorReading) bool {
+	return reading.Kind == other.Kind &&
+		equalPtr(reading.Temperature, other.Temperature) &&
+		equalPtr(reading.Presence, other.Presence) &&
+		equalPtr(reading.LightLevel, other.LightLevel) &&
+		equalPtr(reading.Dark, other.Dark) &&
+		equalPtr(reading.Daylight, other.Daylight) &&
+		equalPtr(reading.ButtonEvent, other.ButtonEvent) &&
+		reading.LastUpdated == other.LastUpdated &&
+		equalPtr(reading.Battery, other.Battery) &&
+		equalPtr(reading.Reachable, other.Reachable)
+}
+
+// NewHueSensor creates a new hue sensor belonging to the given device.
+// When the sensor is not of a supported kind, returns nil.
+func NewHueSensor(sensor huego.Sensor, device string) *HueSensor {
+	kind, ok := sensorKinds[sensor.Type]
+	if !ok {
+		return nil
+	}
+	if device == "" {
+		device = sensor.Name
+	}
+	return &HueSensor{
+		ID:      sensor.ID,
+		Data:    sensor,
+		Device:  device,
+		Reading: newSensorReading(kind, sensor),
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// For safety reasons this only unmarshals the ID from the data source.
+func (sensor *HueSensor) UnmarshalJSON(data []byte) error {
+	id := &struct {
+		ID int `json:"id"`
+	}{}
+	err := json.Unmarshal(data, &id)
+	sensor.ID = id.ID
+	return err
+}
+
+// newSensorReading reads the state and config of a sensor
+func newSensorReading(kind SensorKind, sensor huego.Sensor) (reading SensorReading) {
+	reading.Kind = kind
+
+	if v, ok := sensor.State["lastupdated"].(string); ok && v != "none" {
+		reading.LastUpdated = v
+	}
+	if v, ok := sensor.Config["battery"].(float64); ok {
+		battery := int(v)
+		reading.Battery = &battery
+	}
+	if v, ok := sensor.Config["reachable"].(bool); ok {
+		reading.Reachable = &v
+	}
+
+	switch kind {
+	case SensorTemperature:
+		if v, ok := sensor.State["temperature"].(float64); ok {
+			celsius := v / 100
+			reading.Temperature = &celsius
+		}
+	case SensorPresence:
+		if v, ok := sensor.State["presence"].(bool); ok {
+			reading.Presence = &v
+		}
+	case SensorLightLevel:
+		if v, ok := sensor.State["lightlevel"].(float64); ok {
+			lux := luxFromLightLevel(v)
+			reading.LightLevel = &lux
+		}
+		if v, ok := sensor.State["dark"].(bool); ok {
+			reading.Dark = &v
+		}
+		if v, ok := sensor.State["daylight"].(bool); ok {
+			reading.Daylight = &v
+		}
+	case SensorDaylight:
+		if v, ok := sensor.State["daylight"].(bool); ok {
+			reading.Daylight = &v
+		}
+	case SensorSwitch:
+		if v, ok := sensor.State["buttonevent"].(float64); ok {
+			event := int(v)
+			reading.ButtonEvent = &event
+		}
+	}
+	return
+}
+
+// luxFromLightLevel converts a hue light level into lux, rounded to one decimal place
+func luxFromLightLevel(level float64) float64 {
+	return math.Round(math.Pow(10, (level-1)/10000)*10) / 10
+}
+
+// sensorDevices returns a map from sensor id to the name of the device the sensor belongs to.
+//
+// Sensors belong to the same device when their unique ids share the same MAC address.
+// The name of a device is the name of its presence or switch sensor.
+func sensorDevices(sensors []huego.Sensor) map[int]string {
+	names := make(map[string]string)
+	for _, sensor := range sensors {
+		kind := sensorKinds[sensor.Type]
+		if kind != SensorPresence && kind != SensorSwitch {
+			continue
+		}
+		if mac := sensorMAC(sensor); mac != "" {
+			names[mac] = sensor.Name
+		}
+	}
+
+	devices := make(map[int]string, len(sensors))
+	for _, sensor := range sensors {
+		if name, ok := names[sensorMAC(sensor)]; ok {
+			devices[sensor.ID] = name
+		}
+	}
+	return devices
+}
+
+// sensorMAC returns the MAC address part of the unique id of a sensor
+func sensorMAC(sensor huego.Sensor) string {
+	mac, _, _ := strings.Cut(sensor.UniqueID, "-")
+	return mac
+}
+
+// String returns a human-readable description of this reading
+func (reading SensorReading) String() string {
+	var parts []string
+	switch {
+	case reading.Temperature != nil:
+		parts = append(parts, fmt.Sprintf("%.1f°C", *reading.Temperature))
+	case reading.Presence != nil && *reading.Presence:
+		parts = append(parts, "motion")
+	case reading.Presence != nil:
+		parts = append(parts, "no motion")
+	case reading.LightLevel != nil:
+		parts = append(parts, fmt.Sprintf("%.1f lx", *reading.LightLevel))
+	case reading.Daylight != nil && *reading.Daylight:
+		parts = append(parts, "daylight")
+	case reading.Daylight != nil:
+		parts = append(parts, "no daylight")
+	case reading.ButtonEvent != nil:
+		parts = append(parts, fmt.Sprintf("button event %d", *reading.ButtonEvent))
+	}
+	if reading.Battery != nil {
+		parts = append(parts, fmt.Sprintf("battery %d%%", *reading.Battery))
+	}
+	if reading.Reachable != nil && !*reading.Reachable {
+		parts = append(parts, "unreachable")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,263 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/amimof/huego"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Status represents the normalized state of a group or light
+type Status struct {
+	On    bool `json:"on"`
+	AllOn bool `json:"allOn"` // for groups, if all lights are on
+
+	Brightness  Brightness  `json:"brightness,omitempty"`
+	ColorMode   string      `json:"colormode,omitempty"` // one of "xy", "ct" or "hs"
+	Color       string      `json:"color,omitempty"`     // approximate color as a hex string
+	Temperature Temperature `json:"ct,omitempty"`
+	Effect      string      `json:"effect,omitempty"`
+
+	Scene string `json:"scene,omitempty"` // name of the active scene, if known
+
+	Reachable *bool `json:"reachable,omitempty"` // for lights, if the light is reachable
+}
+
+// String returns a human-readable description of this status
+func (status Status) String() string {
+	if !status.On {
+		if status.Reachable != nil && !*status.Reachable {
+			return "off (unreachable)"
+		}
+		return "off"
+	}
+
+	parts := []string{"on"}
+	if !status.AllOn {
+		parts[0] = "partially on"
+	}
+	if status.Brightness != BrightnessAny {
+		parts = append(parts, status.Brightness.String())
+	}
+	switch {
+	case status.Color != "":
+		parts = append(parts, status.Color)
+	case status.Temperature != TemperatureAny:
+		parts = append(parts, status.Temperature.String())
+	}
+	if status.Effect != "" {
+		parts = append(parts, status.Effect)
+	}
+	if status.Scene != "" {
+		parts = append(parts, fmt.Sprintf("scene %q", status.Scene))
+	}
+	if status.Reachable != nil && !*status.Reachable {
+		parts = append(parts, "unreachable")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Equal checks if status and other are the same
+func (status Status) Equal(other Status) bool {
+	return status.On == other.On &&
+		status.AllOn == other.AllOn &&
+		status.Brightness == other.Brightness &&
+		status.ColorMode == other.ColorMode &&
+		status.Color == other.Color &&
+		status.Temperature == other.Temperature &&
+		status.Effect == other.Effect &&
+		status.Scene == other.Scene &&
+		equalPtr(status.Reachable, other.Reachable)
+}
+
+// equalPtr checks if a and b are both nil, or point to equal values
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// NewGroupStatus returns the status of a group.
+// scenes is used to find the name of the active scene.
+func NewGroupStatus(group huego.Group, scenes []huego.Scene) (status Status) {
+	if group.GroupState != nil {
+		status.On = group.GroupState.AnyOn
+		status.AllOn = group.GroupState.AllOn
+	}
+	if group.State != nil {
+		status.setState(*group.State)
+
+		if group.State.Scene != "" {
+			for _, scene := range scenes {
+				if scene.ID == group.State.Scene {
+					status.Scene = scene.Name
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+// NewLightStatus returns the status of a light.
+func NewLightStatus(light huego.Light) (status Status) {
+	if light.State == nil {
+		return
+	}
+	status.On = light.State.On
+	status.AllOn = light.State.On
+	status.setState(*light.State)
+
+	reachable := light.State.Reachable
+	status.Reachable = &reachable
+	return
+}
+
+// setState sets brightness, color and effect from a state
+func (status *Status) setState(state huego.State) {
+	status.Brightness = Brightness(state.Bri)
+	status.ColorMode = state.ColorMode
+	if state.Effect != "" && state.Effect != hueEffectNone {
+		status.Effect = state.Effect
+	}
+
+	switch state.ColorMode {
+	case "xy":
+		if len(state.Xy) == 2 {
+			status.Color = XYToColor(XY{float64(state.Xy[0]), float64(state.Xy[1])}).Hex()
+		}
+	case "hs":
+		status.Color = colorful.Hsv(float64(state.Hue)/65535*360, float64(state.Sat)/254, 1).Clamped().Hex()
+	case "ct":
+		status.Temperature = Temperature(state.Ct)
+	}
+}
+
+// XYToColor converts a point in the CIE color space into an approximate color at full brightness.
+// It is the inverse of ColorToXY, ignoring brightness.
+func XYToColor(xy XY) colorful.Color {
+	if xy[1] <= 0 {
+		return colorful.Color{R: 1, G: 1, B: 1}
+	}
+
+	Y := 1.0
+	X := (Y / xy[1]) * xy[0]
+	Z := (Y / xy[1]) * (1 - xy[0] - xy[1])
+
+	r := X*1.656492 - Y*0.354851 - Z*0.255038
+	g := -X*0.707196 + Y*1.655397 + Z*0.036152
+	b := X*0.051713 - Y*0.121364 + Z*1.011530
+
+	// scale the brightest component to 1
+	if max := math.Max(r, math.Max(g, b)); max > 0 {
+		r, g, b = r/max, g/max, b/max
+	}
+
+	return colorful.LinearRgb(math.Max(r, 0), math.Max(g, 0), math.Max(b, 0)).Clamped()
+}
+
+// statusWords are words that request the status of an object
+var statusWords = []keyword[bool]{
+	{"status", true},
+	{"state", true},
+}
+
+// IndexState represents the normalized state of all objects in an index
+type IndexState struct {
+	Groups  []GroupState  `json:"groups"`
+	Lights  []LightState  `json:"lights"`
+	Sensors []SensorState `json:"sensors"`
+}
+
+// GroupState represents the state of a single group
+type GroupState struct {
+	Bridge string    `json:"bridge,omitempty"`
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	Type   GroupType `json:"type"`
+	Status Status    `json:"status"`
+}
+
+// LightState represents the state of a single light
+type LightState struct {
+	Bridge string `json:"bridge,omitempty"`
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+}
+
+// SensorState represents the state of a single sensor
+type SensorState struct {
+	Bridge  string        `json:"bridge,omitempty"`
+	ID      int           `json:"id"`
+	Name    string        `json:"name"`
+	Device  string        `json:"device"`
+	Reading SensorReading `json:"reading"`
+}
+
+// Equal checks if state and other hold the same objects, with equal names and statuses
+func (state IndexState) Equal(other IndexState) bool {
+	if len(state.Groups) != len(other.Groups) || len(state.Lights) != len(other.Lights) || len(state.Sensors) != len(other.Sensors) {
+		return false
+	}
+	for i, g := range state.Groups {
+		o := other.Groups[i]
+		if g.Bridge != o.Bridge || g.ID != o.ID || g.Name != o.Name || g.Type != o.Type || !g.Status.Equal(o.Status) {
+			return false
+		}
+	}
+	for i, l := range state.Lights {
+		o := other.Lights[i]
+		if l.Bridge != o.Bridge || l.ID != o.ID || l.Name != o.Name || !l.Status.Equal(o.Status) {
+			return false
+		}
+	}
+	for i, s := range state.Sensors {
+		o := other.Sensors[i]
+		if s.Bridge != o.Bridge || s.ID != o.ID || s.Name != o.Name || s.Device != o.Device || !s.Reading.Equal(o.Reading) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tag sets the name of the bridge of every object in this state
+func (state IndexState) Tag(bridge string) {
+	for i := range state.Groups {
+		state.Groups[i].Bridge = bridge
+	}
+	for i := range state.Lights {
+		state.Lights[i].Bridge = bridge
+	}
+	for i := range state.Sensors {
+		state.Sensors[i].Bridge = bridge
+	}
+}
+
+// State returns the normalized state of every object in this index
+func (index Index) State() (state IndexState) {
+	state.Groups = make([]GroupState, len(index.Groups))
+	for i, group := range index.Groups {
+		state.Groups[i] = GroupState{ID: group.ID, Name: group.Name, Type: GroupTypeOf(group), Status: NewGroupStatus(group, index.Scenes)}
+	}
+
+	state.Lights = make([]LightState, len(index.Lights))
+	for i, light := range index.Lights {
+		state.Lights[i] = LightState{ID: light.ID, Name: light.Name, Status: NewLightStatus(light)}
+	}
+
+	devices := sensorDevices(index.Sensors)
+	state.Sensors = make([]SensorState, 0, len(index.Sensors))
+	for _, s := range index.Sensors {
+		sensor := NewHueSensor(s, devices[s.ID])
+		if sensor == nil {
+			continue
+		}
+		state.Sensors = append(state.Sensors, SensorState{ID: sensor.ID, Name: sensor.Data.Name, Device: sensor.Device, Reading: sensor.Reading})
+	}
+
+	return
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Temperature represents the color temperature of a light or group in mired, as understood by the hue api.
+// Valid temperatures are between [MinTemperature] and [MaxTemperature]; the zero value indicates no temperature.
+type Temperature uint16
+
+const (
+	TemperatureAny Temperature = 0
+	MinTemperature Temperature = 153 // 6500K
+	MaxTemperature Temperature = 500 // 2000K
+)
+
+// TemperatureFromKelvin returns the temperature corresponding to the given value in Kelvin.
+// Values outside of the supported range are clamped to the range of valid temperatures.
+func TemperatureFromKelvin(kelvin float64) Temperature {
+	if kelvin <= 0 {
+		return MaxTemperature
+	}
+	return TemperatureFromMired(1_000_000 / kelvin)
+}
+
+// TemperatureFromMired returns the temperature corresponding to the given value in mired.
+// Values outside of the supported range are clamped to the range of valid temperatures.
+func TemperatureFromMired(mired float64) Temperature {
+	ct := math.Round(mired)
+	switch {
+	case ct < float64(MinTemperature):
+		return MinTemperature
+	case ct > float64(MaxTemperature):
+		return MaxTemperature
+	}
+	return Temperature(ct)
+}
+
+// Kelvin returns this temperature in Kelvin, rounded to the closest multiple of 100.
+func (ct Temperature) Kelvin() int {
+	if ct == 0 {
+		return 0
+	}
+	return int(math.Round(10_000/float64(ct)) * 100)
+}
+
+// Valid checks if this temperature can be sent to a hue bridge
+func (ct Temperature) Valid() bool {
+	return ct >= MinTemperature && ct <= MaxTemperature
+}
+
+func (ct Temperature) String() string {
+	return fmt.Sprintf("%dK", ct.Kelvin())
+}
+
+// temperatureWords are names of whites that correspond to specific temperatures
+var temperatureWords = []keyword[Temperature]{
+	{"candle", TemperatureFromKelvin(2000)},
+	{"warm white", TemperatureFromKelvin(2700)},
+	{"soft white", TemperatureFromKelvin(2700)},
+	{"warm", TemperatureFromKelvin(2700)},
+	{"neutral white", TemperatureFromKelvin(4000)},
+	{"neutral", TemperatureFromKelvin(4000)},
+	{"cool white", TemperatureFromKelvin(5000)},
+	{"cool", TemperatureFromKelvin(5000)},
+	{"daylight", TemperatureFromKelvin(6500)},
+	{"cold white", TemperatureFromKelvin(6500)},
+	{"cold", TemperatureFromKelvin(6500)},
+}
+
+// temperaturePrefixes are words that indicate a temperature in mired
+var temperaturePrefixes = []string{"ct", "mired"}
+
+// ParseTemperature parses a color temperature from the provided value.
+// It does not take named whites into account.
+//
+// Supported formats are "2700K" and "2700 K" for Kelvin,
+// and "370 mired", "ct 370" and "mired 370" for mired values.
+// Values outside of the supported range are not accepted.
+func ParseTemperature(value string) (Temperature, bool) {
+	fields := strings.Fields(strings.ToLower(value))
+	var number, unit string
+	switch len(fields) {
+	case 1:
+		number = strings.TrimRight(fields[0], "kmired")
+		unit = fields[0][len(number):]
+	case 2:
+		number, unit = fields[0], fields[1]
+		for _, prefix := range temperaturePrefixes {
+			if fields[0] == prefix {
+				number, unit = fields[1], "mired"
+				break
+			}
+		}
+	default:
+		return TemperatureAny, false
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return TemperatureAny, false
+	}
+
+	var mired float64
+	switch unit {
+	case "k":
+		mired = 1_000_000 / n
+	case "mired":
+		mired = n
+	default:
+		return TemperatureAny, false
+	}
+
+	ct := Temperature(math.Round(mired))
+	if math.Round(mired) > float64(MaxTemperature) || !ct.Valid() {
+		return TemperatureAny, false
+	}
+	return ct, true
+}
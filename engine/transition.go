@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// Transition represents the duration of a transition between two states, as understood by the hue api.
+// It is a multiple of 100ms; the zero value indicates the default transition of the bridge.
+type Transition uint16
+
+const (
+	TransitionDefault Transition = 0
+	TransitionSlow    Transition = 100 // 10s
+)
+
+// TransitionFromDuration returns the transition corresponding to the provided duration.
+// Durations are rounded to the closest multiple of 100ms, and clamped to the supported range.
+func TransitionFromDuration(d time.Duration) Transition {
+	tt := math.Round(float64(d) / float64(100*time.Millisecond))
+	switch {
+	case tt < 1:
+		return TransitionDefault
+	case tt > math.MaxUint16:
+		return math.MaxUint16
+	}
+	return Transition(tt)
+}
+
+// Duration returns the duration of this transition
+func (tt Transition) Duration() time.Duration {
+	return time.Duration(tt) * 100 * time.Millisecond
+}
+
+func (tt Transition) String() string {
+	return tt.Duration().String()
+}
+
+// transitionWords are words that stand for a specific transition
+var transitionWords = map[string]Transition{
+	"slowly": TransitionSlow,
+	"slow":   TransitionSlow,
+}
+
+// transitionPrefixes are sequences of words that introduce a transition duration.
+//
+// A plain "in" introduces a schedule (see [parseSchedule]), hence a transition using "in" has to be spelled "fade in".
+var transitionPrefixes = [][]string{
+	{"over"},
+	{"fade", "in"},
+	{"fade", "over"},
+}
+
+// parseTransition attempts to parse a transition from the end of fields.
+// Words are matched case-insensitively.
+// Returns the remaining fields.
+func parseTransition(fields []string) (Transition, []string, bool) {
+	if len(fields) == 0 {
+		return TransitionDefault, fields, false
+	}
+
+	last := strings.ToLower(fields[len(fields)-1])
+	if tt, ok := transitionWords[last]; ok {
+		return tt, fields[:len(fields)-1], true
+	}
+
+	d, err := time.ParseDuration(last)
+	if err != nil || d <= 0 {
+		return TransitionDefault, fields, false
+	}
+
+	// use the longest matching prefix, so that "fade over" does not leave "fade" behind
+	length := 0
+	for _, prefix := range transitionPrefixes {
+		if len(prefix) > length && hasWordsSuffix(fields[:len(fields)-1], prefix) {
+			length = len(prefix)
+		}
+	}
+	if length == 0 {
+		return TransitionDefault, fields, false
+	}
+	return TransitionFromDuration(d), fields[:len(fields)-1-length], true
+}
+
+// hasWordsSuffix checks if fields ends with the given lower-case words, ignoring case
+func hasWordsSuffix(fields []string, words []string) bool {
+	if len(fields) < len(words) {
+		return false
+	}
+	fields = fields[len(fields)-len(words):]
+	for i, word := range words {
+		if strings.ToLower(fields[i]) != word {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseModifiers_transition(t *testing.T) {
+	tests := []struct {
+		input          string
+		wantRest       []string
+		wantTransition Transition
+		wantSchedule   *Schedule
+	}{
+		{"office off", []string{"office", "off"}, TransitionDefault, nil},
+		{"office off slowly", []string{"office", "off"}, TransitionSlow, nil},
+		{"office off SLOWLY", []string{"office", "off"}, TransitionSlow, nil},
+		{"office off over 30s", []string{"office", "off"}, 300, nil},
+		{"office off Over 30S", []string{"office", "off"}, 300, nil},
+		{"office off fade in 2m", []string{"office", "off"}, 1200, nil},
+		{"office off FADE IN 2m", []string{"office", "off"}, 1200, nil},
+		{"office off fade over 2m", []string{"office", "off"}, 1200, nil},
+
+		// a plain "in" is a schedule
+		{"office off in 2m", []string{"office", "off"}, TransitionDefault, &Schedule{Delay: 2 * time.Minute}},
+		{"office off In 2M", []string{"office", "off"}, TransitionDefault, &Schedule{Delay: 2 * time.Minute}},
+		{"office off fade in 10s in 20m", []string{"office", "off"}, 100, &Schedule{Delay: 20 * time.Minute}},
+		{"office off in 20m fade in 10s", []string{"office", "off"}, 100, &Schedule{Delay: 20 * time.Minute}},
+
+		// modifiers need something to apply to
+		{"over 30s", []string{"over", "30s"}, TransitionDefault, nil},
+		{"fade in 30s", []string{"fade"}, TransitionDefault, &Schedule{Delay: 30 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			m, rest := parseModifiers(strings.Fields(tt.input))
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("parseModifiers() rest = %v, want %v", rest, tt.wantRest)
+			}
+			if m.Transition != tt.wantTransition {
+				t.Errorf("parseModifiers() transition = %v, want %v", m.Transition, tt.wantTransition)
+			}
+			if !reflect.DeepEqual(m.Schedule, tt.wantSchedule) {
+				t.Errorf("parseModifiers() schedule = %v, want %v", m.Schedule, tt.wantSchedule)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// UsageWeight is the maximal boost an action receives from being used
+	UsageWeight = 1.0
+
+	// UsageSaturation is the number of uses after which an action receives the full frequency boost
+	UsageSaturation = 20
+
+	// UsageHalfLife is the time after which the recency boost of an action is halved
+	UsageHalfLife = 7 * 24 * time.Hour
+
+	// UsageHourWindow is the number of hours before and after the current hour that count as the same time of day
+	UsageHourWindow = 1
+)
+
+// Usage holds usage statistics of a single action
+type Usage struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+	Hours [24]int   `json:"hours"` // number of uses in each hour of the day, in local time
+}
+
+// boost computes the boost of an action with this usage at the given time.
+// It is between 0 and UsageWeight, and combines frequency, recency and time of day.
+func (usage Usage) boost(now time.Time) float64 {
+	if usage.Count <= 0 {
+		return 0
+	}
+
+	frequency := math.Min(1, math.Log1p(float64(usage.Count))/math.Log1p(UsageSaturation))
+	recency := math.Exp2(-float64(now.Sub(usage.Last)) / float64(UsageHalfLife))
+
+	var inWindow int
+	hour := now.Hour()
+	for d := -UsageHourWindow; d <= UsageHourWindow; d++ {
+		inWindow += usage.Hours[(hour+d+24)%24]
+	}
+	timeOfDay := float64(inWindow) / float64(usage.Count)
+
+	return UsageWeight * frequency * (0.25 + 0.25*recency + 0.5*timeOfDay)
+}
+
+// DefaultUsageSaveDelay is the default time recorded usage is kept in memory before being saved
+const DefaultUsageSaveDelay = 10 * time.Second
+
+// UsageStats records how often and when actions are performed.
+// It is used to boost the score of frequently used actions.
+// It is safe for concurrent use.
+type UsageStats struct {
+	l sync.Mutex
+
+	// Store is used to persist usage statistics.
+	// When nil, statistics are only kept in memory.
+	Store UsageStore
+
+	// SaveDelay is the time to wait after recording usage before saving it to the store.
+	// Usage recorded in the meantime is saved along with it.
+	// SaveDelay <= 0 indicates DefaultUsageSaveDelay.
+	SaveDelay time.Duration
+
+	loaded bool
+	usage  map[string]Usage // by usage key
+
+	saveL   sync.Mutex  // held while writing to the store, acquired before l
+	pending *time.Timer // pending save, nil when all usage has been saved
+	saveErr error       // error of the last delayed save
+}
+
+// Record records that action was performed at the given time.
+// Informational and special actions are not recorded.
+//
+// Usage is saved to the store after SaveDelay.
+// When a previous save has failed, its error is returned.
+func (stats *UsageStats) Record(action Action, now time.Time) error {
+	key := action.usageKey()
+	if key == "" {
+		return nil
+	}
+
+	stats.l.Lock()
+	defer stats.l.Unlock()
+
+	if err := stats.load(); err != nil {
+		return err
+	}
+
+	usage := stats.usage[key]
+	usage.Count++
+	usage.Last = now
+	usage.Hours[now.Hour()]++
+	stats.usage[key] = usage
+
+	if stats.Store != nil && stats.pending == nil {
+		delay := stats.SaveDelay
+		if delay <= 0 {
+			delay = DefaultUsageSaveDelay
+		}
+		stats.pending = time.AfterFunc(delay, func() { stats.flush() })
+	}
+
+	err := stats.saveErr
+	stats.saveErr = nil
+	return err
+}
+
+// Boost returns the boost of the given action at the given time.
+// If usage statistics can not be loaded, returns 0.
+func (stats *UsageStats) Boost(action Action, now time.Time) float64 {
+	key := action.usageKey()
+	if key == "" {
+		return 0
+	}
+
+	stats.l.Lock()
+	defer stats.l.Unlock()
+
+	if stats.load() != nil {
+		return 0
+	}
+	return stats.usage[key].boost(now)
+}
+
+// Usage returns the usage statistics of all actions, by usage key.
+func (stats *UsageStats) Usage() (map[string]Usage, error) {
+	stats.l.Lock()
+	defer stats.l.Unlock()
+
+	if err := stats.load(); err != nil {
+		return nil, err
+	}
+	return stats.copyUsage(), nil
+}
+
+// Reset removes all usage statistics, and immediately saves the change.
+func (stats *UsageStats) Reset() error {
+	stats.saveL.Lock()
+	defer stats.saveL.Unlock()
+
+	usage := func() map[string]Usage {
+		stats.l.Lock()
+		defer stats.l.Unlock()
+
+		stats.stopPending()
+		stats.usage = make(map[string]Usage)
+		stats.loaded = true
+		return stats.copyUsage()
+	}()
+
+	return stats.write(usage)
+}
+
+// Flush immediately saves any usage that has been recorded but not yet saved.
+func (stats *UsageStats) Flush() error {
+	err := stats.flush()
+
+	stats.l.Lock()
+	defer stats.l.Unlock()
+
+	stats.saveErr = nil
+	return err
+}
+
+// flush saves any usage that has not yet been saved.
+// The store is written without holding stats.l, so that recording usage is never blocked by the disk.
+func (stats *UsageStats) flush() error {
+	stats.saveL.Lock()
+	defer stats.saveL.Unlock()
+
+	usage, ok := func() (map[string]Usage, bool) {
+		stats.l.Lock()
+		defer stats.l.Unlock()
+
+		if stats.pending == nil {
+			return nil, false
+		}
+		stats.stopPending()
+		return stats.copyUsage(), true
+	}()
+	if !ok {
+		return nil
+	}
+
+	err := stats.write(usage)
+
+	stats.l.Lock()
+	defer stats.l.Unlock()
+
+	stats.saveErr = err
+	return err
+}
+
+// stopPending cancels the pending save, if any.
+// stats.l must be held.
+func (stats *UsageStats) stopPending() {
+	if stats.pending != nil {
+		stats.pending.Stop()
+		stats.pending = nil
+	}
+}
+
+// copyUsage returns a copy of the usage statistics.
+// stats.l must be held.
+func (stats *UsageStats) copyUsage() map[string]Usage {
+	usage := make(map[string]Usage, len(stats.usage))
+	for key, u := range stats.usage {
+		usage[key] = u
+	}
+	return usage
+}
+
+// load loads usage statistics from the store, unless they have been loaded already.
+// stats.l must be held.
+func (stats *UsageStats) load() error {
+	if stats.loaded {
+		return nil
+	}
+
+	stats.usage = make(map[string]Usage)
+	if stats.Store == nil {
+		stats.loaded = true
+		return nil
+	}
+
+	usage, err := stats.Store.Read()
+	if err != nil {
+		return errors.Wrap(err, "unable to read usage")
+	}
+	for key, u := range usage {
+		stats.usage[key] = u
+	}
+	stats.loaded = true
+	return nil
+}
+
+// write writes the given usage statistics to the store.
+// stats.saveL must be held.
+func (stats *UsageStats) write(usage map[string]Usage) error {
+	if stats.Store == nil {
+		return nil
+	}
+	return errors.Wrap(stats.Store.Write(usage), "unable to write usage")
+}
+
+// usageKey returns a key identifying this action for usage statistics.
+// Modifiers such as the transition or schedule are not part of the key.
+//
+// Informational and special actions have an empty key.
+func (action Action) usageKey() string {
+	if action.Special != nil || action.ReadOnly() {
+		return ""
+	}
+
+	// the same object on different bridges is counted separately
+	if action.Bridge != "" {
+		untagged := action
+		untagged.Bridge = ""
+		if key := untagged.usageKey(); key != "" {
+			return "bridge:" + action.Bridge + "/" + key
+		}
+		return ""
+	}
+
+	if action.Macro != nil {
+		return "macro:" + action.Macro.ID
+	}
+
+	if len(action.Actions) > 0 {
+		keys := make([]string, len(action.Actions))
+		for i, part := range action.Actions {
+			keys[i] = part.usageKey()
+		}
+		sort.Strings(keys)
+		return strings.Join(keys, "+")
+	}
+
+	var key string
+	switch {
+	case action.Group != nil:
+		key = fmt.Sprintf("group:%d", action.Group.ID)
+	case action.Light != nil:
+		key = fmt.Sprintf("light:%d", action.Light.ID)
+	default:
+		return ""
+	}
+
+	switch {
+	case action.Scene != nil:
+		key += "/scene:" + action.Scene.ID
+	case action.OnOff != BoolAny:
+		key += "/" + string(action.OnOff)
+	case action.Color != "":
+		key += "/color:" + action.Color
+	case action.Temperature != TemperatureAny:
+		key += fmt.Sprintf("/ct:%d", action.Temperature)
+	case action.Brightness != BrightnessAny:
+		key += fmt.Sprintf("/bri:%d", action.Brightness)
+	case action.Effect != EffectAny:
+		key += "/effect:" + string(action.Effect)
+	}
+	return key
+}
+
+// UsageStore reads and writes usage statistics
+type UsageStore interface {
+	// Read reads usage statistics from this store.
+	// When no statistics exist, returns nil.
+	Read() (map[string]Usage, error)
+
+	// Write writes usage statistics to this store, replacing any existing ones.
+	Write(usage map[string]Usage) error
+}
+
+// JSONFileUsageStore stores usage statistics in the provided JSON file on disk.
+// Implements UsageStore.
+type JSONFileUsageStore string
+
+// Read reads usage statistics from the provided filename on disk.
+//
+// When the file does not exist, the store is considered empty.
+func (f JSONFileUsageStore) Read() (usage map[string]Usage, err error) {
+	h, err := os.Open(string(f))
+	if err != nil {
+		// file does not exist, meaning the store it empty
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer h.Close()
+
+	err = json.NewDecoder(h).Decode(&usage)
+	return usage, err
+}
+
+// Write writes usage statistics to the provided filename on disk.
+//
+// When creating a new file, uses chmod 0600 to prevent other users from accessing the file.
+func (f JSONFileUsageStore) Write(usage map[string]Usage) error {
+	h, err := os.OpenFile(string(f), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	if usage == nil {
+		usage = map[string]Usage{}
+	}
+	return json.NewEncoder(h).Encode(usage)
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryUsageStore is a UsageStore that keeps usage in memory and counts writes
+type memoryUsageStore struct {
+	l      sync.Mutex
+	usage  map[string]Usage
+	writes int
+
+	block chan struct{} // when non-nil, writes wait until it is closed
+}
+
+func (store *memoryUsageStore) Read() (map[string]Usage, error) {
+	store.l.Lock()
+	defer store.l.Unlock()
+
+	return store.usage, nil
+}
+
+func (store *memoryUsageStore) Write(usage map[string]Usage) error {
+	if store.block != nil {
+		<-store.block
+	}
+
+	store.l.Lock()
+	defer store.l.Unlock()
+
+	store.usage = usage
+	store.writes++
+	return nil
+}
+
+func (store *memoryUsageStore) Writes() int {
+	store.l.Lock()
+	defer store.l.Unlock()
+
+	return store.writes
+}
+
+func TestUsageStats_Record(t *testing.T) {
+	kitchen := Action{Group: &HueGroup{ID: 1}, OnOff: BoolOff}
+	now := time.Date(2022, 1, 1, 20, 0, 0, 0, time.Local)
+
+	t.Run("saves are batched", func(t *testing.T) {
+		store := &memoryUsageStore{}
+		stats := &UsageStats{Store: store, SaveDelay: 50 * time.Millisecond}
+
+		for i := 0; i < 10; i++ {
+			if err := stats.Record(kitchen, now); err != nil {
+				t.Fatalf("Record() err = %v", err)
+			}
+		}
+		if got := store.Writes(); got != 0 {
+			t.Errorf("Record() wrote %d times before SaveDelay, want 0", got)
+		}
+
+		time.Sleep(200 * time.Millisecond)
+		if got := store.Writes(); got != 1 {
+			t.Errorf("Record() wrote %d times after SaveDelay, want 1", got)
+		}
+		if got := store.usage[kitchen.usageKey()].Count; got != 10 {
+			t.Errorf("Record() saved count %d, want 10", got)
+		}
+	})
+
+	t.Run("flush saves immediately", func(t *testing.T) {
+		store := &memoryUsageStore{}
+		stats := &UsageStats{Store: store, SaveDelay: time.Hour}
+
+		if err := stats.Record(kitchen, now); err != nil {
+			t.Fatalf("Record() err = %v", err)
+		}
+		if err := stats.Flush(); err != nil {
+			t.Fatalf("Flush() err = %v", err)
+		}
+		if err := stats.Flush(); err != nil {
+			t.Fatalf("Flush() err = %v", err)
+		}
+		if got := store.Writes(); got != 1 {
+			t.Errorf("Flush() wrote %d times, want 1", got)
+		}
+	})
+
+	t.Run("recording does not wait for the store", func(t *testing.T) {
+		store := &memoryUsageStore{block: make(chan struct{})}
+		stats := &UsageStats{Store: store, SaveDelay: time.Millisecond}
+
+		if err := stats.Record(kitchen, now); err != nil {
+			t.Fatalf("Record() err = %v", err)
+		}
+		time.Sleep(50 * time.Millisecond) // the save is now blocked
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			stats.Record(kitchen, now)
+			stats.Boost(kitchen, now)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Record() blocked on a pending save")
+		}
+		close(store.block)
+	})
+}
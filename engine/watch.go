@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// watchFile calls load once, and then again whenever the file at path is modified.
+// The file is checked for changes every interval.
+//
+// watchFile blocks until ctx is closed.
+func watchFile(ctx context.Context, path string, interval time.Duration, logger zerolog.Logger, load func() error) {
+	var lastMod time.Time
+	var lastSize int64 = -1
+
+	reload := func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			logger.Error().Err(err).Msg("unable to stat file")
+			return
+		}
+		if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+			return
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+
+		if err := load(); err != nil {
+			logger.Error().Err(err).Msg("unable to load file")
+		}
+	}
+
+	reload()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reload()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
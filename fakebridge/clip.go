@@ -0,0 +1,597 @@
+package fakebridge
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amimof/huego"
+	"github.com/pkg/errors"
+	"github.com/tkw1536/huelio/clip"
+	"github.com/tkw1536/huelio/engine"
+)
+
+// This file implements the parts of the v2 api used by huelio.
+// Resources are derived from the in-memory bridge, and identified by ids derived from their v1 id.
+
+// clipID returns a stable id for the resource of the given type and key
+func clipID(rtype, key string) string {
+	sum := sha1.Sum([]byte(rtype + "/" + key))
+	h := hex.EncodeToString(sum[:16])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+func clipRef(rtype, key string) clip.Reference {
+	return clip.Reference{RID: clipID(rtype, key), RType: rtype}
+}
+
+// serveClip serves a request to the v2 api
+func (server *Server) serveClip(w http.ResponseWriter, r *http.Request) {
+	if !server.authorized(r.Header.Get(clip.KeyHeader)) {
+		server.writeClipError(w, http.StatusForbidden, "unauthorized user")
+		return
+	}
+
+	if r.URL.Path == clip.EventStreamPath {
+		server.serveEvents(w, r)
+		return
+	}
+
+	// resource[/type[/id]]
+	rest := strings.TrimPrefix(r.URL.Path, clip.ResourcePath)
+	parts := strings.FieldsFunc(rest, func(r rune) bool { return r == '/' })
+	if !strings.HasPrefix(r.URL.Path, clip.ResourcePath) || len(parts) > 2 {
+		server.writeClipError(w, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet:
+		resources, err := server.clipResources(r.Context())
+		if err != nil {
+			server.writeClipError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		data := make([]clip.Resource, 0, len(resources))
+		for _, resource := range resources {
+			if (len(parts) < 1 || resource.Type == parts[0]) && (len(parts) < 2 || resource.ID == parts[1]) {
+				data = append(data, resource)
+			}
+		}
+		if len(parts) == 2 && len(data) == 0 {
+			server.writeClipError(w, http.StatusNotFound, "resource not found")
+			return
+		}
+		server.writeClip(w, data)
+	case r.Method == http.MethodPut && len(parts) == 2:
+		var update clip.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			server.writeClipError(w, http.StatusBadRequest, "body contains invalid json")
+			return
+		}
+		if err := server.clipUpdate(r.Context(), parts[0], parts[1], update); err != nil {
+			server.writeClipError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		server.writeClip(w, []clip.Reference{{RID: parts[1], RType: parts[0]}})
+		server.changed(r.Context())
+	default:
+		server.writeClipError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// clipResources returns the current resources of the bridge in the v2 api
+func (server *Server) clipResources(ctx context.Context) ([]clip.Resource, error) {
+	groups, err := server.Bridge.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := server.Bridge.GetGroup(ctx, engine.AllLightsID)
+	if err != nil {
+		return nil, err
+	}
+	lights, err := server.Bridge.GetLights(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scenes, err := server.Bridge.GetScenes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sensors, err := server.Bridge.GetSensors(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []clip.Resource
+
+	// the bridge itself
+	bridgeDevice := clipID("device", "bridge")
+	resources = append(resources,
+		clip.Resource{
+			ID:          bridgeDevice,
+			Type:        "device",
+			Metadata:    &clip.Metadata{Name: server.Name, Archetype: "bridge_v2"},
+			ProductData: &clip.ProductData{ModelID: "BSB002", ProductName: "Hue Bridge"},
+			Services:    []clip.Reference{clipRef("bridge", "")},
+		},
+		clip.Resource{
+			ID:       clipID("bridge", ""),
+			Type:     "bridge",
+			Owner:    &clip.Reference{RID: bridgeDevice, RType: "device"},
+			BridgeID: strings.ToLower(server.ID),
+		},
+	)
+
+	// lights, each of which is a device
+	for _, light := range lights {
+		resources = append(resources, clipLight(light)...)
+	}
+
+	// groups, including the home
+	for _, group := range append([]huego.Group{*all}, groups...) {
+		resources = append(resources, clipGroup(group)...)
+	}
+
+	// scenes
+	for _, scene := range scenes {
+		resources = append(resources, clipScene(scene, groups))
+	}
+
+	// sensors, grouped into devices
+	resources = append(resources, clipSensors(sensors)...)
+
+	return resources, nil
+}
+
+func clipLight(light huego.Light) []clip.Resource {
+	key := strconv.Itoa(light.ID)
+	device := clipRef("device", "light/"+key)
+	state := light.State
+	if state == nil {
+		state = &huego.State{}
+	}
+
+	resource := clip.Resource{
+		ID:       clipID("light", key),
+		IDv1:     "/lights/" + key,
+		Type:     "light",
+		Owner:    &device,
+		Metadata: &clip.Metadata{Name: light.Name, Archetype: "classic_bulb"},
+	}
+	setClipState(&resource, *state, light.Type)
+
+	connectivity := "connected"
+	if !state.Reachable {
+		connectivity = "connectivity_issue"
+	}
+	status, _ := json.Marshal(connectivity)
+
+	return []clip.Resource{
+		{
+			ID:          device.RID,
+			Type:        "device",
+			Metadata:    &clip.Metadata{Name: light.Name, Archetype: "classic_bulb"},
+			ProductData: &clip.ProductData{ModelID: light.ModelID},
+			Services:    []clip.Reference{clipRef("light", key), clipRef("zigbee_connectivity", "light/"+key)},
+		},
+		resource,
+		{
+			ID:     clipID("zigbee_connectivity", "light/"+key),
+			Type:   "zigbee_connectivity",
+			Owner:  &device,
+			Status: status,
+		},
+	}
+}
+
+// setClipState sets the state of a light or grouped light.
+// Which parts of the state are set depends on the type of light in the v1 api.
+func setClipState(resource *clip.Resource, state huego.State, lightType string) {
+	resource.On = &clip.On{On: state.On}
+	resource.Dimming = &clip.Dimming{Brightness: math.Round(float64(state.Bri)/2.54*100) / 100}
+
+	lightType = strings.ToLower(lightType)
+	if strings.Contains(lightType, "extended") || strings.Contains(lightType, "temperature") {
+		ct := state.Ct
+		resource.ColorTemperature = &clip.ColorTemperature{Mirek: &ct, MirekValid: state.ColorMode == "ct"}
+	}
+	if strings.Contains(lightType, "color light") {
+		resource.Color = &clip.Color{GamutType: "C"}
+		if len(state.Xy) == 2 {
+			resource.Color.XY = clip.XY{X: float64(state.Xy[0]), Y: float64(state.Xy[1])}
+		}
+		effect := "no_effect"
+		if state.Effect == "colorloop" {
+			effect = "prism"
+		}
+		resource.Effects = &clip.Effects{Effect: effect, Status: effect}
+	}
+}
+
+func clipGroup(group huego.Group) []clip.Resource {
+	key := strconv.Itoa(group.ID)
+	resource := clip.Resource{
+		ID:       clipID("group", key),
+		IDv1:     "/groups/" + key,
+		Metadata: &clip.Metadata{Name: group.Name, Archetype: strings.ReplaceAll(strings.ToLower(group.Class), " ", "_")},
+	}
+
+	var lights []clip.Reference
+	for _, light := range group.Lights {
+		lights = append(lights, clipRef("light", light))
+	}
+	var devices []clip.Reference
+	for _, light := range group.Lights {
+		devices = append(devices, clipRef("device", "light/"+light))
+	}
+
+	switch {
+	case group.ID == engine.AllLightsID:
+		resource.Type = "bridge_home"
+		resource.Metadata = nil
+		resource.Children = devices
+	case group.Type == "Room":
+		resource.Type = "room"
+		resource.Children = devices
+	case group.Type == "Entertainment":
+		resource.Type = "entertainment_configuration"
+		resource.LightServices = lights
+		return []clip.Resource{resource}
+	default:
+		resource.Type = "zone"
+		resource.Children = lights
+	}
+
+	// a grouped light controls all lights of a room, zone or home
+	grouped := clip.Resource{
+		ID:    clipID("grouped_light", key),
+		IDv1:  "/groups/" + key,
+		Type:  "grouped_light",
+		Owner: &clip.Reference{RID: resource.ID, RType: resource.Type},
+		On:    &clip.On{On: group.GroupState != nil && group.GroupState.AnyOn},
+	}
+	if group.State != nil {
+		grouped.Dimming = &clip.Dimming{Brightness: math.Round(float64(group.State.Bri)/2.54*100) / 100}
+	}
+	resource.Services = []clip.Reference{{RID: grouped.ID, RType: grouped.Type}}
+
+	return []clip.Resource{resource, grouped}
+}
+
+func clipScene(scene huego.Scene, groups []huego.Group) clip.Resource {
+	resource := clip.Resource{
+		ID:       clipID("scene", scene.ID),
+		IDv1:     "/scenes/" + scene.ID,
+		Type:     "scene",
+		Metadata: &clip.Metadata{Name: scene.Name},
+	}
+	for _, group := range groups {
+		if strconv.Itoa(group.ID) != scene.Group {
+			continue
+		}
+		ref := clipRef("group", scene.Group)
+		if group.Type == "Room" {
+			ref.RType = "room"
+		} else {
+			ref.RType = "zone"
+		}
+		resource.Group = &ref
+	}
+
+	ids := make([]int, 0, len(scene.LightStates))
+	for id := range scene.LightStates {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		var light clip.Resource
+		setClipState(&light, scene.LightStates[id], "extended color light")
+		if !scene.LightStates[id].On {
+			light.Dimming = nil
+		}
+		if len(scene.LightStates[id].Xy) != 2 {
+			light.Color = nil
+		}
+		if scene.LightStates[id].Ct == 0 {
+			light.ColorTemperature = nil
+		}
+		light.Effects = nil
+
+		resource.Actions = append(resource.Actions, clip.SceneAction{
+			Target: clipRef("light", strconv.Itoa(id)),
+			Action: clip.Update{On: light.On, Dimming: light.Dimming, Color: light.Color, ColorTemperature: light.ColorTemperature},
+		})
+	}
+	return resource
+}
+
+// clipTypes maps sensor types of the v1 api to types of the v2 api
+var clipTypes = map[string]string{
+	"ZLLPresence":    "motion",
+	"ZLLTemperature": "temperature",
+	"ZLLLightLevel":  "light_level",
+}
+
+func clipSensors(sensors []huego.Sensor) []clip.Resource {
+	var resources []clip.Resource
+	devices := make(map[string]*clip.Resource)
+	var macs []string
+
+	for _, sensor := range sensors {
+		rtype, ok := clipTypes[sensor.Type]
+		if !ok {
+			continue
+		}
+
+		mac, _, _ := strings.Cut(sensor.UniqueID, "-")
+		if mac == "" {
+			mac = strconv.Itoa(sensor.ID)
+		}
+		device, ok := devices[mac]
+		if !ok {
+			device = &clip.Resource{
+				ID:          clipID("device", "sensor/"+mac),
+				Type:        "device",
+				Metadata:    &clip.Metadata{Name: sensor.Name, Archetype: "unknown_archetype"},
+				ProductData: &clip.ProductData{ModelID: sensor.ModelID},
+			}
+			devices[mac] = device
+			macs = append(macs, mac)
+
+			owner := clip.Reference{RID: device.ID, RType: "device"}
+			status, _ := json.Marshal("connected")
+			if reachable, ok := sensor.Config["reachable"].(bool); ok && !reachable {
+				status, _ = json.Marshal("connectivity_issue")
+			}
+			device.Services = append(device.Services, clipRef("zigbee_connectivity", "sensor/"+mac))
+			resources = append(resources, clip.Resource{ID: clipID("zigbee_connectivity", "sensor/"+mac), Type: "zigbee_connectivity", Owner: &owner, Status: status})
+
+			if battery, ok := sensor.Config["battery"].(float64); ok {
+				device.Services = append(device.Services, clipRef("device_power", "sensor/"+mac))
+				resources = append(resources, clip.Resource{ID: clipID("device_power", "sensor/"+mac), Type: "device_power", Owner: &owner, PowerState: &clip.PowerState{BatteryLevel: int(battery)}})
+			}
+		}
+		if rtype == "motion" {
+			device.Metadata.Name = sensor.Name
+		}
+
+		key := strconv.Itoa(sensor.ID)
+		enabled := true
+		resource := clip.Resource{
+			ID:      clipID(rtype, key),
+			IDv1:    "/sensors/" + key,
+			Type:    rtype,
+			Owner:   &clip.Reference{RID: device.ID, RType: "device"},
+			Enabled: &enabled,
+		}
+		switch rtype {
+		case "motion":
+			presence, _ := sensor.State["presence"].(bool)
+			resource.Motion = &clip.Motion{Motion: presence, MotionValid: true}
+		case "temperature":
+			temperature, _ := sensor.State["temperature"].(float64)
+			resource.Temperature = &clip.Temperature{Temperature: temperature / 100, TemperatureValid: true}
+		case "light_level":
+			level, _ := sensor.State["lightlevel"].(float64)
+			resource.Light = &clip.LightLevel{LightLevel: int(level), LightLevelValid: true}
+		}
+		device.Services = append(device.Services, clip.Reference{RID: resource.ID, RType: rtype})
+		resources = append(resources, resource)
+	}
+
+	for _, mac := range macs {
+		resources = append(resources, *devices[mac])
+	}
+	return resources
+}
+
+var errClipNotFound = errors.New("resource not found")
+
+// clipUpdate applies an update to the resource with the given type and id
+func (server *Server) clipUpdate(ctx context.Context, rtype, id string, update clip.Update) error {
+	resources, err := server.clipResources(ctx)
+	if err != nil {
+		return err
+	}
+
+	var resource *clip.Resource
+	for i := range resources {
+		if resources[i].Type == rtype && resources[i].ID == id {
+			resource = &resources[i]
+			break
+		}
+	}
+	if resource == nil {
+		return errClipNotFound
+	}
+
+	switch rtype {
+	case "light", "grouped_light":
+		kind := "/lights/"
+		set := server.Bridge.UpdateLight
+		if rtype == "grouped_light" {
+			kind = "/groups/"
+			set = server.Bridge.UpdateGroup
+		}
+		v1, err := strconv.Atoi(strings.TrimPrefix(resource.IDv1, kind))
+		if err != nil {
+			return errClipNotFound
+		}
+		return set(ctx, v1, v1Update(update))
+	case "scene":
+		if update.Recall == nil {
+			return nil
+		}
+		scene, err := server.Bridge.GetScene(ctx, strings.TrimPrefix(resource.IDv1, "/scenes/"))
+		if err != nil {
+			return err
+		}
+		group, _ := strconv.Atoi(scene.Group)
+		return server.Bridge.RecallScene(ctx, scene.ID, group, engine.Transition(update.Recall.Duration/100))
+	default:
+		return errClipNotFound
+	}
+}
+
+// v1Update turns an update into an update of the v1 api.
+// Attributes not present in update are not present in the returned update either.
+func v1Update(update clip.Update) (state engine.StateUpdate) {
+	if update.On != nil {
+		on := update.On.On
+		state.On = &on
+	}
+	if update.Dimming != nil {
+		bri := uint8(math.Max(1, math.Round(update.Dimming.Brightness*2.54)))
+		state.Bri = &bri
+	}
+	if update.Color != nil {
+		state.Xy = []float32{float32(update.Color.XY.X), float32(update.Color.XY.Y)}
+	}
+	if update.ColorTemperature != nil && update.ColorTemperature.Mirek != nil {
+		ct := *update.ColorTemperature.Mirek
+		state.Ct = &ct
+	}
+	if update.Effects != nil {
+		effect := "none"
+		if update.Effects.Effect == "prism" {
+			effect = "colorloop"
+		}
+		state.Effect = &effect
+	}
+	if update.Alert != nil {
+		alert := "select"
+		state.Alert = &alert
+	}
+	return
+}
+
+// serveEvents serves the event stream.
+// Clients receive an update of every light and grouped light whenever anything changes.
+func (server *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events := server.subscribe()
+	defer server.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": hi\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case message := <-events:
+			fmt.Fprintf(w, "id: %d:0\ndata: %s\n\n", time.Now().Unix(), message)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-server.Ctx.Done():
+			return
+		}
+	}
+}
+
+func (server *Server) subscribe() chan []byte {
+	server.l.Lock()
+	defer server.l.Unlock()
+
+	if server.subscribers == nil {
+		server.subscribers = make(map[chan []byte]struct{})
+	}
+	events := make(chan []byte, 16)
+	server.subscribers[events] = struct{}{}
+	return events
+}
+
+func (server *Server) unsubscribe(events chan []byte) {
+	server.l.Lock()
+	defer server.l.Unlock()
+
+	delete(server.subscribers, events)
+}
+
+// changed notifies subscribers of the event stream that lights may have changed
+func (server *Server) changed(ctx context.Context) {
+	resources, err := server.clipResources(ctx)
+	if err != nil {
+		return
+	}
+
+	var data []json.RawMessage
+	for _, resource := range resources {
+		if resource.Type != "light" && resource.Type != "grouped_light" {
+			continue
+		}
+		update := clip.Resource{
+			ID:               resource.ID,
+			IDv1:             resource.IDv1,
+			Type:             resource.Type,
+			Owner:            resource.Owner,
+			On:               resource.On,
+			Dimming:          resource.Dimming,
+			ColorTemperature: resource.ColorTemperature,
+			Color:            resource.Color,
+			Effects:          resource.Effects,
+		}
+		raw, err := json.Marshal(update)
+		if err != nil {
+			return
+		}
+		data = append(data, raw)
+	}
+
+	server.Publish(clip.Event{ID: clipID("event", time.Now().String()), Type: "update", Data: data})
+}
+
+// Publish sends a message holding the given events to all clients of the event stream.
+// Changes to the bridge are published automatically, Publish allows simulating other events, such as resources being added or deleted.
+//
+// Clients that are too slow to receive the message miss it.
+func (server *Server) Publish(events ...clip.Event) {
+	message, err := json.Marshal(events)
+	if err != nil {
+		return
+	}
+
+	server.l.Lock()
+	defer server.l.Unlock()
+
+	for subscriber := range server.subscribers {
+		select {
+		case subscriber <- message:
+		default: // slow subscribers miss events
+		}
+	}
+}
+
+// writeClip writes data in the envelope of the v2 api
+func (server *Server) writeClip(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": []interface{}{}, "data": data})
+}
+
+// writeClipError writes an error in the envelope of the v2 api
+func (server *Server) writeClipError(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"description": description}},
+		"data":   []interface{}{},
+	})
+}
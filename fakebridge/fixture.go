@@ -0,0 +1,83 @@
+package fakebridge
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/amimof/huego"
+	"github.com/pkg/errors"
+	"github.com/tkw1536/huelio/engine"
+)
+
+// Fixture holds the initial data of a fake bridge.
+// It uses the same format as the hue api, with objects keyed by their id.
+type Fixture struct {
+	Name string `json:"name,omitempty"`     // name of the bridge
+	ID   string `json:"bridgeid,omitempty"` // id of the bridge
+
+	// Users are usernames that are authorized without pressing the link button.
+	Users []string `json:"users,omitempty"`
+
+	Groups  map[int]huego.Group    `json:"groups"`
+	Lights  map[int]huego.Light    `json:"lights"`
+	Scenes  map[string]huego.Scene `json:"scenes"`
+	Sensors map[int]huego.Sensor   `json:"sensors,omitempty"`
+}
+
+//go:embed fixture.json
+var defaultFixture []byte
+
+// DefaultFixture returns a fixture of a small home with a few rooms, lights, scenes and sensors.
+func DefaultFixture() Fixture {
+	var fixture Fixture
+	if err := json.Unmarshal(defaultFixture, &fixture); err != nil {
+		panic("DefaultFixture: invalid fixture.json")
+	}
+	return fixture
+}
+
+// LoadFixture loads a fixture from the given path.
+func LoadFixture(path string) (fixture Fixture, err error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return fixture, errors.Wrap(err, "Unable to read fixture")
+	}
+	if err := json.Unmarshal(bytes, &fixture); err != nil {
+		return fixture, errors.Wrap(err, "Unable to parse fixture")
+	}
+	return fixture, nil
+}
+
+// Bridge returns an in-memory bridge holding the data of this fixture.
+func (fixture Fixture) Bridge(host string) *engine.MemoryBridge {
+	groups := make([]huego.Group, 0, len(fixture.Groups))
+	for id, group := range fixture.Groups {
+		group.ID = id
+		groups = append(groups, group)
+	}
+
+	lights := make([]huego.Light, 0, len(fixture.Lights))
+	for id, light := range fixture.Lights {
+		light.ID = id
+		lights = append(lights, light)
+	}
+
+	scenes := make([]huego.Scene, 0, len(fixture.Scenes))
+	for id, scene := range fixture.Scenes {
+		scene.ID = id
+		scenes = append(scenes, scene)
+	}
+
+	sensors := make([]huego.Sensor, 0, len(fixture.Sensors))
+	for id, sensor := range fixture.Sensors {
+		sensor.ID = id
+		sensors = append(sensors, sensor)
+	}
+	sort.Slice(sensors, func(i, j int) bool {
+		return sensors[i].ID < sensors[j].ID
+	})
+
+	return engine.NewMemoryBridge(host, groups, lights, scenes, sensors)
+}
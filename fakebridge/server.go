@@ -0,0 +1,458 @@
+// Package fakebridge implements a fake hue bridge serving the v1 REST API, and the parts of the v2 API used by huelio.
+//
+// It is intended for development and demos without a physical bridge.
+package fakebridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amimof/huego"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/tkw1536/huelio/engine"
+)
+
+// DefaultLinkWindow is the default time the link button stays pressed
+const DefaultLinkWindow = 30 * time.Second
+
+// Server serves the hue v1 REST API and parts of the v2 API, backed by an in-memory bridge.
+type Server struct {
+	Ctx context.Context
+
+	Bridge *engine.MemoryBridge
+
+	Name string // name of the bridge, as returned in its configuration
+	ID   string // id of the bridge, as returned in its configuration
+
+	// LinkWindow is how long the link button stays pressed.
+	// LinkWindow <= 0 indicates DefaultLinkWindow.
+	LinkWindow time.Duration
+
+	// AlwaysLinked simulates a link button that is always pressed.
+	AlwaysLinked bool
+
+	l         sync.Mutex
+	users     map[string]string // authorized usernames and their device types
+	linkUntil time.Time         // time the link button is released
+
+	subscribers map[chan []byte]struct{} // clients of the event stream
+}
+
+// NewServer creates a new server holding the data of the given fixture.
+func NewServer(fixture Fixture, ctx context.Context) *Server {
+	server := &Server{
+		Ctx:    ctx,
+		Bridge: fixture.Bridge("fakebridge"),
+		Name:   fixture.Name,
+		ID:     fixture.ID,
+		users:  make(map[string]string, len(fixture.Users)),
+	}
+	for _, user := range fixture.Users {
+		server.users[user] = ""
+	}
+	return server
+}
+
+func (server *Server) logger() zerolog.Logger {
+	return zerolog.Ctx(server.Ctx).With().Str("component", "fakebridge.Server").Logger()
+}
+
+// PressLinkButton presses the link button of this bridge.
+// Users can be created until the link window has passed.
+func (server *Server) PressLinkButton() {
+	window := server.LinkWindow
+	if window <= 0 {
+		window = DefaultLinkWindow
+	}
+
+	server.l.Lock()
+	defer server.l.Unlock()
+
+	server.linkUntil = time.Now().Add(window)
+
+	serverLogger := server.logger()
+	serverLogger.Info().Time("until", server.linkUntil).Msg("link button pressed")
+}
+
+// linkPressed checks if the link button is currently pressed.
+// server.l must be held.
+func (server *Server) linkPressed() bool {
+	return server.AlwaysLinked || time.Now().Before(server.linkUntil)
+}
+
+// AddUser authorizes the given username
+func (server *Server) AddUser(username string) {
+	server.l.Lock()
+	defer server.l.Unlock()
+
+	server.users[username] = ""
+}
+
+// authorized checks if the given username is authorized
+func (server *Server) authorized(username string) bool {
+	server.l.Lock()
+	defer server.l.Unlock()
+
+	_, ok := server.users[username]
+	return ok
+}
+
+// error types used by the hue api
+const (
+	errorUnauthorized      = 1
+	errorInvalidJSON       = 2
+	errorNotAvailable      = 3
+	errorMethodUnavailable = 4
+	errorMissingParameters = 5
+	errorLinkButton        = 101
+)
+
+type apiError struct {
+	Type        int    `json:"type"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+}
+
+type apiResponse struct {
+	Success map[string]interface{} `json:"success,omitempty"`
+	Error   *apiError              `json:"error,omitempty"`
+}
+
+// LinkButtonPath is the path used to press the link button using a POST request.
+// It is not part of the hue api.
+const LinkButtonPath = "/linkbutton"
+
+// ServeHTTP responds to a http request
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serverLogger := server.logger()
+
+	serverLogger.Info().Str("method", r.Method).Stringer("url", r.URL).Msg("request")
+
+	if r.URL.Path == LinkButtonPath {
+		if r.Method != http.MethodPost {
+			server.writeError(w, errorMethodUnavailable, r.URL.Path, "method, "+r.Method+", not available for resource, "+r.URL.Path)
+			return
+		}
+		server.PressLinkButton()
+		server.writeJSON(w, []apiResponse{{Success: map[string]interface{}{LinkButtonPath: true}}})
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/clip/") || strings.HasPrefix(r.URL.Path, "/eventstream/") {
+		server.serveClip(w, r)
+		return
+	}
+
+	parts := strings.FieldsFunc(r.URL.Path, func(r rune) bool { return r == '/' })
+	if len(parts) == 0 || parts[0] != "api" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// creating a user is the only unauthenticated request
+	if len(parts) == 1 {
+		if r.Method != http.MethodPost {
+			server.writeError(w, errorMethodUnavailable, "/", "method, "+r.Method+", not available for resource, /")
+			return
+		}
+		server.createUser(w, r)
+		return
+	}
+
+	if !server.authorized(parts[1]) {
+		server.writeError(w, errorUnauthorized, "/"+strings.Join(parts[2:], "/"), "unauthorized user")
+		return
+	}
+
+	server.serveResource(w, r, parts[2:])
+}
+
+// createUser creates a new user if the link button is pressed
+func (server *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DeviceType string `json:"devicetype"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		server.writeError(w, errorInvalidJSON, "", "body contains invalid json")
+		return
+	}
+	if body.DeviceType == "" {
+		server.writeError(w, errorMissingParameters, "/", "invalid/missing parameters in body")
+		return
+	}
+
+	server.l.Lock()
+	defer server.l.Unlock()
+
+	if !server.linkPressed() {
+		server.writeError(w, errorLinkButton, "", "link button not pressed")
+		return
+	}
+
+	username, err := newUsername()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	server.users[username] = body.DeviceType
+
+	serverLogger := server.logger()
+	serverLogger.Info().Str("devicetype", body.DeviceType).Msg("created user")
+
+	server.writeJSON(w, []apiResponse{{Success: map[string]interface{}{"username": username}}})
+}
+
+// newUsername generates a new random username
+func newUsername() (string, error) {
+	buffer := make([]byte, 20)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", errors.Wrap(err, "Unable to generate username")
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// serveResource serves a request for the resource identified by parts.
+func (server *Server) serveResource(w http.ResponseWriter, r *http.Request, parts []string) {
+	ctx := r.Context()
+	address := "/" + strings.Join(parts, "/")
+
+	var kind, id, sub string
+	switch len(parts) {
+	case 3:
+		sub = parts[2]
+		fallthrough
+	case 2:
+		id = parts[1]
+		fallthrough
+	case 1:
+		kind = parts[0]
+	}
+
+	var (
+		data interface{}
+		err  error
+	)
+
+	switch method := r.Method; {
+	case kind == "capabilities" && id == "" && method == http.MethodGet:
+		data = server.capabilities()
+	case kind == "config" && id == "" && method == http.MethodGet:
+		data = server.config()
+
+	case kind == "groups" && id == "" && method == http.MethodGet:
+		data, err = server.groups(ctx)
+	case kind == "groups" && sub == "" && method == http.MethodGet:
+		data, err = withID(id, func(id int) (interface{}, error) { return server.Bridge.GetGroup(ctx, id) })
+	case kind == "groups" && sub == "action" && method == http.MethodPut:
+		server.setState(w, r, address, id, true)
+		return
+
+	case kind == "lights" && id == "" && method == http.MethodGet:
+		data, err = server.lights(ctx)
+	case kind == "lights" && sub == "" && method == http.MethodGet:
+		data, err = withID(id, func(id int) (interface{}, error) { return server.Bridge.GetLight(ctx, id) })
+	case kind == "lights" && sub == "state" && method == http.MethodPut:
+		server.setState(w, r, address, id, false)
+		return
+
+	case kind == "scenes" && id == "" && method == http.MethodGet:
+		data, err = server.scenes(ctx)
+	case kind == "scenes" && sub == "" && method == http.MethodGet:
+		data, err = server.Bridge.GetScene(ctx, id)
+
+	case kind == "sensors" && id == "" && method == http.MethodGet:
+		data, err = server.sensors(ctx)
+	case kind == "sensors" && sub == "" && method == http.MethodGet:
+		var sensors map[string]huego.Sensor
+		sensors, err = server.sensors(ctx)
+		sensor, ok := sensors[id]
+		if err == nil && !ok {
+			err = engine.ErrMemoryBridgeNotFound
+		}
+		data = sensor
+
+	case kind == "capabilities", kind == "config", kind == "groups", kind == "lights", kind == "scenes", kind == "sensors":
+		server.writeError(w, errorMethodUnavailable, address, "method, "+r.Method+", not available for resource, "+address)
+		return
+	default:
+		server.writeError(w, errorNotAvailable, address, "resource, "+address+", not available")
+		return
+	}
+
+	if err != nil {
+		server.writeError(w, errorNotAvailable, address, "resource, "+address+", not available")
+		return
+	}
+	server.writeJSON(w, data)
+}
+
+// withID parses id as an integer and calls get with it
+func withID(id string, get func(id int) (interface{}, error)) (interface{}, error) {
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+	return get(i)
+}
+
+// stateRequest is the body of a request setting the state of a light or group.
+// Attributes that are not present are nil, and are left unchanged.
+type stateRequest struct {
+	engine.StateUpdate
+
+	Scene          *string `json:"scene,omitempty"`          // only for groups
+	TransitionTime *uint16 `json:"transitiontime,omitempty"` // only used for scenes
+}
+
+// setState parses a state from the request body and applies it to the light or group with the given id.
+// Only attributes present in the body are changed.
+// Responds with a success entry for every attribute that was set.
+func (server *Server) setState(w http.ResponseWriter, r *http.Request, address, id string, group bool) {
+	bytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var request stateRequest
+	var attributes map[string]json.RawMessage
+	if json.Unmarshal(bytes, &request) != nil || json.Unmarshal(bytes, &attributes) != nil {
+		server.writeError(w, errorInvalidJSON, address, "body contains invalid json")
+		return
+	}
+
+	i, err := strconv.Atoi(id)
+	if err == nil {
+		err = server.applyState(r.Context(), i, group, request)
+	}
+	if err != nil {
+		server.writeError(w, errorNotAvailable, address, "resource, "+address+", not available")
+		return
+	}
+	server.changed(r.Context())
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	responses := make([]apiResponse, len(names))
+	for i, name := range names {
+		responses[i].Success = map[string]interface{}{address + "/" + name: attributes[name]}
+	}
+	server.writeJSON(w, responses)
+}
+
+// applyState applies request to the light or group with the given id
+func (server *Server) applyState(ctx context.Context, id int, group bool, request stateRequest) error {
+	switch {
+	case group && request.Scene != nil:
+		var transition engine.Transition
+		if request.TransitionTime != nil {
+			transition = engine.Transition(*request.TransitionTime)
+		}
+		return server.Bridge.RecallScene(ctx, *request.Scene, id, transition)
+	case group:
+		return server.Bridge.UpdateGroup(ctx, id, request.StateUpdate)
+	default:
+		return server.Bridge.UpdateLight(ctx, id, request.StateUpdate)
+	}
+}
+
+func (server *Server) capabilities() huego.Capabilities {
+	var capabilities huego.Capabilities
+	capabilities.Groups.Available = 64
+	capabilities.Lights.Available = 63
+	capabilities.Scenes.Available = 200
+	capabilities.Sensors.Available = 250
+	return capabilities
+}
+
+func (server *Server) config() huego.Config {
+	var config huego.Config
+	config.Name = server.Name
+	config.BridgeID = server.ID
+	config.ModelID = "BSB002"
+	config.APIVersion = "1.50.0"
+	config.LinkButton = func() bool {
+		server.l.Lock()
+		defer server.l.Unlock()
+
+		return server.linkPressed()
+	}()
+	return config
+}
+
+func (server *Server) groups(ctx context.Context) (map[string]huego.Group, error) {
+	groups, err := server.Bridge.GetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]huego.Group, len(groups))
+	for _, group := range groups {
+		data[strconv.Itoa(group.ID)] = group
+	}
+	return data, nil
+}
+
+func (server *Server) lights(ctx context.Context) (map[string]huego.Light, error) {
+	lights, err := server.Bridge.GetLights(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]huego.Light, len(lights))
+	for _, light := range lights {
+		data[strconv.Itoa(light.ID)] = light
+	}
+	return data, nil
+}
+
+func (server *Server) scenes(ctx context.Context) (map[string]huego.Scene, error) {
+	scenes, err := server.Bridge.GetScenes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]huego.Scene, len(scenes))
+	for _, scene := range scenes {
+		// like a real bridge, light states are only included for individual scenes
+		scene.LightStates = nil
+		data[scene.ID] = scene
+	}
+	return data, nil
+}
+
+func (server *Server) sensors(ctx context.Context) (map[string]huego.Sensor, error) {
+	sensors, err := server.Bridge.GetSensors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]huego.Sensor, len(sensors))
+	for _, sensor := range sensors {
+		data[strconv.Itoa(sensor.ID)] = sensor
+	}
+	return data, nil
+}
+
+// writeError writes a single error in the format of the hue api
+func (server *Server) writeError(w http.ResponseWriter, tp int, address, description string) {
+	server.writeJSON(w, []apiResponse{{Error: &apiError{Type: tp, Address: address, Description: description}}})
+}
+
+// writeJSON writes data as json.
+// Like a real bridge, errors are reported in the body, so the status code is always 200.
+func (server *Server) writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,233 @@
+package fakebridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amimof/huego"
+	"github.com/tkw1536/huelio/creds"
+	"github.com/tkw1536/huelio/engine"
+	"github.com/tkw1536/huelio/fakebridge"
+)
+
+// testUser is a username that is authorized on servers returned by newTestServer
+const testUser = "testuser"
+
+// newTestServer starts a new fake bridge holding the default fixture
+func newTestServer(t *testing.T) (*fakebridge.Server, *httptest.Server) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	server := fakebridge.NewServer(fakebridge.DefaultFixture(), ctx)
+	server.AddUser(testUser)
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	return server, ts
+}
+
+// put sends a PUT request with the given body, and decodes the response
+func put(t *testing.T, url, body string) (responses []map[string]map[string]interface{}) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PUT %s err = %v", url, err)
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(&responses); err != nil {
+		t.Fatalf("PUT %s: unable to decode response: %v", url, err)
+	}
+	return
+}
+
+// lightState returns the current state of the light with the given id
+func lightState(t *testing.T, server *fakebridge.Server, id int) huego.State {
+	t.Helper()
+
+	light, err := server.Bridge.GetLight(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetLight(%d) err = %v", id, err)
+	}
+	return *light.State
+}
+
+func TestServer_setState(t *testing.T) {
+	t.Run("light", func(t *testing.T) {
+		server, ts := newTestServer(t)
+
+		responses := put(t, ts.URL+"/api/"+testUser+"/lights/1/state", `{"bri":100}`)
+		if len(responses) != 1 || responses[0]["success"]["/lights/1/state/bri"] != float64(100) {
+			t.Errorf("PUT state responses = %v, want success for bri", responses)
+		}
+
+		if state := lightState(t, server, 1); !state.On || state.Bri != 100 || state.ColorMode != "ct" {
+			t.Errorf("light 1 = %+v, want on with brightness 100", state)
+		}
+	})
+
+	t.Run("group", func(t *testing.T) {
+		server, ts := newTestServer(t)
+
+		put(t, ts.URL+"/api/"+testUser+"/groups/1/action", `{"ct":447}`)
+		for _, id := range []int{1, 2, 3} {
+			state := lightState(t, server, id)
+			if state.Ct != 447 || state.ColorMode != "ct" {
+				t.Errorf("light %d = %+v, want color temperature 447", id, state)
+			}
+			if want := id != 3; state.On != want {
+				t.Errorf("light %d on = %v, want %v", id, state.On, want)
+			}
+		}
+	})
+
+	t.Run("off", func(t *testing.T) {
+		server, ts := newTestServer(t)
+
+		put(t, ts.URL+"/api/"+testUser+"/lights/2/state", `{"on":false}`)
+		if state := lightState(t, server, 2); state.On || state.Bri != 120 {
+			t.Errorf("light 2 = %+v, want off with unchanged brightness", state)
+		}
+	})
+
+	t.Run("scene", func(t *testing.T) {
+		server, ts := newTestServer(t)
+
+		put(t, ts.URL+"/api/"+testUser+"/groups/2/action", `{"scene":"cook-kitchen"}`)
+		for _, id := range []int{4, 5} {
+			if state := lightState(t, server, id); !state.On || state.Bri != 254 {
+				t.Errorf("light %d = %+v, want concentrate scene", id, state)
+			}
+		}
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, ts := newTestServer(t)
+
+		responses := put(t, ts.URL+"/api/"+testUser+"/lights/1/state", `{"bri":`)
+		if len(responses) != 1 || responses[0]["error"] == nil {
+			t.Errorf("PUT state responses = %v, want error", responses)
+		}
+	})
+}
+
+func TestFinder(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	finder := creds.Finder{Ctx: context.Background(), NewName: "huelio#test", Hostname: ts.URL}
+
+	if _, err := finder.Find(); err == nil {
+		t.Fatal("Find() err = nil, want error when link button is not pressed")
+	}
+
+	res, err := http.Post(ts.URL+fakebridge.LinkButtonPath, "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST %s err = %v", fakebridge.LinkButtonPath, err)
+	}
+	res.Body.Close()
+
+	credentials, err := finder.Find()
+	if err != nil {
+		t.Fatalf("Find() err = %v", err)
+	}
+	if credentials.Username == "" {
+		t.Fatal("Find() returned empty username")
+	}
+
+	bridge, err := creds.NewBridge(credentials)
+	if err != nil {
+		t.Fatalf("NewBridge() err = %v", err)
+	}
+	if credentials.Name != "Fake bridge" || credentials.ID != "001788FFFE000001" {
+		t.Errorf("NewBridge() credentials = %+v, want name and id of fixture", credentials)
+	}
+
+	lights, err := bridge.GetLights(context.Background())
+	if err != nil {
+		t.Fatalf("GetLights() err = %v", err)
+	}
+	if len(lights) != 6 {
+		t.Errorf("GetLights() returned %d lights, want 6", len(lights))
+	}
+}
+
+func TestEngine(t *testing.T) {
+	server, ts := newTestServer(t)
+
+	bridge, err := creds.NewBridge(&creds.Credentials{Hostname: ts.URL, Username: testUser})
+	if err != nil {
+		t.Fatalf("NewBridge() err = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	e := engine.NewEngine(bridge, ctx)
+	if err := e.RefreshIndex(); err != nil {
+		t.Fatalf("RefreshIndex() err = %v", err)
+	}
+
+	// do performs the most relevant result of input accepted by match
+	do := func(input string, match func(action engine.Action) bool) {
+		t.Helper()
+
+		actions, _, _, err := e.Query(input, 0)
+		if err != nil {
+			t.Fatalf("Query(%q) err = %v", input, err)
+		}
+		for _, action := range actions {
+			if match(action) {
+				if err := e.Do(action); err != nil {
+					t.Fatalf("Do(%s) err = %v", action, err)
+				}
+				return
+			}
+		}
+		t.Fatalf("Query(%q) returned no matching action", input)
+	}
+
+	do("ceiling 50%", func(action engine.Action) bool {
+		return action.Light != nil && action.Light.ID == 1 && action.Brightness.Valid()
+	})
+	if state := lightState(t, server, 1); !state.On || state.Bri != uint8(engine.BrightnessFromPercent(50)) {
+		t.Errorf("light 1 = %+v, want on at 50%%", state)
+	}
+
+	do("kitchen on", func(action engine.Action) bool {
+		return action.Group != nil && action.Group.ID == 2 && action.OnOff == engine.BoolOn
+	})
+	for _, id := range []int{4, 5} {
+		if state := lightState(t, server, id); !state.On {
+			t.Errorf("light %d is off, want on", id)
+		}
+	}
+
+	do("living room movie", func(action engine.Action) bool {
+		return action.Scene != nil && action.Scene.ID == "movie-living"
+	})
+	if state := lightState(t, server, 1); state.On {
+		t.Error("light 1 is on, want off after recalling movie scene")
+	}
+	if state := lightState(t, server, 3); !state.On || state.Bri != 100 {
+		t.Errorf("light 3 = %+v, want movie scene", state)
+	}
+
+	if err := e.Undo(); err != nil {
+		t.Fatalf("Undo() err = %v", err)
+	}
+	if state := lightState(t, server, 1); !state.On || state.Bri != uint8(engine.BrightnessFromPercent(50)) {
+		t.Errorf("light 1 = %+v, want state before movie scene", state)
+	}
+}
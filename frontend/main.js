@@ -34,7 +34,7 @@ if (isHuelioG) {
 
 // Changing the search placeholder regularly
 window.setInterval(() => {
-    var placeholders = ['link','<room> <scene>', '<room> <color>', '<scene>', '<room> on', '<room> off', 'off', 'on']
+    var placeholders = ['link', 'undo', '<room> <scene>', '<room> <color>', '<scene>', '<room> on', '<room> off', '<room> toggle', '<room> 40%', '<room> dim', '<room> warm white', '<room> off over 30s', '<room> colorloop', '<light> flash', '<room> and <room> off', 'zone <zone> off', 'everything off', 'all red', '<room> off in 20m', 'jobs', '<sensor> temperature', '<room>?', 'status <light>', 'off', 'on']
 
     var pick = Math.trunc(Math.random() * placeholders.length - 1)
 
@@ -51,6 +51,9 @@ document.onkeydown = function checkKey(e) {
 
         case 'Enter':
             runSelected().then(response => {
+                if(response.readOnly) {
+                    return
+                }
                 if(!response.ok) {
                     throw new Error('POST response not OK')
                 } else {
@@ -81,6 +84,9 @@ document.onkeydown = function checkKey(e) {
             }
 
             runAction(resultList[idx].getAttribute('data-action')).then(response => {
+                if(response.readOnly) {
+                    return
+                }
                 if (!response.ok) {
                     throw new Error('POST response not OK')
                 } else {
@@ -166,7 +172,82 @@ function updateResults(term) {
     ])
     */
 
-    fetch(baseURL + '?query=' + encodeURIComponent(term)).then(res => res.json()).then(data => handleResults(data))
+    fetch(baseURL + '?query=' + encodeURIComponent(term)).then(res => {
+        updateStale(res.headers.get('X-Huelio-Stale') === 'true', res.headers.get('X-Huelio-Updated'))
+        return res.json()
+    }).then(data => handleResults(data))
+}
+
+// updateStale shows or hides the marker for results from an outdated index
+function updateStale(stale, updated) {
+    var marker = document.querySelector('#stale')
+    if(!stale) {
+        marker.classList.remove('visible')
+        return
+    }
+
+    marker.classList.add('visible')
+    marker.setAttribute('title', 'Results may be outdated' + (updated ? ' (from ' + new Date(updated).toLocaleString() + ')' : '') + ', refreshing')
+}
+
+// listen for events of the server, to update shown results live
+(function() {
+    if(typeof EventSource !== 'function') {
+        return
+    }
+
+    var source = new EventSource(baseURL + 'events')
+    source.addEventListener('state', e => updateStatuses(JSON.parse(e.data)))
+    source.addEventListener('resync', () => updateResults()) // events were missed, so query the current state again
+    source.addEventListener('index', e => {
+        if(!JSON.parse(e.data).error) {
+            updateStale(false)
+        }
+    })
+    source.addEventListener('link', e => {
+        var marker = document.querySelector('#unlinked')
+        if(JSON.parse(e.data).linked) {
+            marker.classList.remove('visible')
+        } else {
+            marker.classList.add('visible')
+        }
+    })
+})();
+
+// updateStatuses updates the status and sensor readings of shown results from a state event
+function updateStatuses(event) {
+    var results = document.querySelectorAll('.results .result')
+    results.forEach((result, i) => {
+        var obj = JSON.parse(result.getAttribute('data-action'))
+        if((obj.bridge || '') !== (event.bridge || '')) {
+            return
+        }
+
+        if(obj.status) {
+            var list = obj.light ? event.state.lights : event.state.groups
+            var id = obj.light ? obj.light.id : obj.group.id
+            var found = list.find(e => e.id === id)
+            if(!found) {
+                return
+            }
+            obj.status = found.status
+        } else if(obj.sensor) {
+            var found = event.state.sensors.find(e => e.id === obj.sensor.id)
+            if(!found) {
+                return
+            }
+            obj.sensor.reading = found.reading
+        } else {
+            return
+        }
+
+        var updated = buildResult(obj)
+        numberResult(updated, i)
+        if(result.classList.contains('active')) {
+            updated.classList.add('active')
+        }
+        result.replaceWith(updated)
+    })
 }
 
 function handleResults(resultsArray) {
@@ -179,14 +260,7 @@ function handleResults(resultsArray) {
         const e = resultsArray[i];
         const res = buildResult(e)
 
-        // Add numbers for the first 9 results (can select with number keys)
-        if(i < 9) {
-            const number = document.createElement('div')
-            number.innerHTML = '<span>' + (i + 1) + '</span>';
-            number.classList.add('crumb', 'no-border')   
-            res.prepend(number)
-        }
-
+        numberResult(res, i)
         resultDivs.push(res)
     }
 
@@ -202,6 +276,16 @@ function handleResults(resultsArray) {
     oldResults.replaceWith(newResults)
 }
 
+// numberResult adds numbers to the first 9 results (can select with number keys)
+function numberResult(res, i) {
+    if(i < 9) {
+        const number = document.createElement('div')
+        number.innerHTML = '<span>' + (i + 1) + '</span>';
+        number.classList.add('crumb', 'no-border')
+        res.prepend(number)
+    }
+}
+
 function buildResult(obj) {
     var result = document.createElement('div')
     result.classList.add('result')
@@ -210,6 +294,9 @@ function buildResult(obj) {
 
     result.addEventListener('click', function(e) {
         runAction(this.getAttribute('data-action')).then((r) => {
+            if(r.readOnly) {
+                return
+            }
             if(r.ok) {
                 resetSearch()
             } else {
@@ -229,23 +316,244 @@ function buildResult(obj) {
         return result
     }
 
+    // results are only tagged with a bridge when there are several
+    if(obj.bridge) {
+        result.append(buildBridge(obj.bridge))
+    }
+
+    if(obj.sensor) {
+        result.classList.add('readonly')
+        result.append(...buildSensor(obj.sensor))
+
+        return result
+    }
+
+    if(obj.status) {
+        result.classList.add('readonly')
+        result.append(buildTarget(obj), ...buildStatus(obj.status))
+
+        return result
+    }
+
+    // composite actions show all their targets, but only the change of the last part
+    var parts = obj.actions ? obj.actions : [obj]
+    var change = parts[parts.length - 1]
+
+    var targets = []
+    for (let i = 0; i < parts.length; i++) {
+        targets.push(buildTarget(parts[i]))
+    }
+
+    var arrow = document.createElement('div')
+    arrow.innerHTML = '<i class="fas fa-arrow-right"></i>'
+    arrow.classList.add('crumb', 'no-border')
+
+
+    result.append(...targets, arrow, buildChange(change))
+
+    if(change.transition) {
+        var transition = document.createElement('div')
+        transition.classList.add('crumb', 'no-border')
+        transition.innerHTML = '<i class="fas fa-hourglass-half">&nbsp;</i><span>' + (change.transition / 10) + 's</span>'
+        result.append(transition)
+    }
+
+    if(obj.schedule) {
+        var schedule = document.createElement('div')
+        schedule.classList.add('crumb', 'no-border')
+        schedule.innerHTML = '<i class="fas fa-clock">&nbsp;</i><span>' + escapeHTML(formatSchedule(obj.schedule)) + '</span>'
+        result.append(schedule)
+    }
+
+    // For debug
+    if(obj.debug) {
+        var debug = document.createElement('div')
+        debug.classList.add('crumb')
+        debug.innerHTML = JSON.stringify(obj.debug)
+
+        result.append(debug)
+    }
+
+    return result
+}
+
+function buildSensor(sensor) {
+    var reading = sensor.reading
+
+    var name = document.createElement('div')
+    name.classList.add('crumb', 'blue')
+    name.innerHTML = '<i class="fas fa-broadcast-tower"></i>&nbsp;<span>' + escapeHTML(sensor.device) + '</span>'
+
+    var value = document.createElement('div')
+    value.classList.add('crumb', 'white')
+    switch(reading.kind) {
+        case 'temperature':
+            value.innerHTML = '<i class="fas fa-thermometer-half">&nbsp;</i><span>' + (reading.temperature !== undefined ? reading.temperature.toFixed(1) + ' °C' : '?') + '</span>'
+            break
+        case 'presence':
+            value.innerHTML = '<i class="fas fa-walking">&nbsp;</i><span>' + (reading.presence ? 'Motion' : 'No motion') + '</span>'
+            break
+        case 'lightlevel':
+            value.innerHTML = '<i class="fas fa-sun">&nbsp;</i><span>' + (reading.lightlevel !== undefined ? reading.lightlevel + ' lx' : '?') + '</span>'
+            break
+        case 'daylight':
+            value.innerHTML = '<i class="fas fa-sun">&nbsp;</i><span>' + (reading.daylight ? 'Daylight' : 'No daylight') + '</span>'
+            break
+        case 'switch':
+            value.innerHTML = '<i class="fas fa-toggle-on">&nbsp;</i><span>' + (reading.buttonevent !== undefined ? 'Button ' + reading.buttonevent : 'Switch') + '</span>'
+            break
+    }
+
+    var crumbs = [name, value]
+
+    if(reading.battery !== undefined) {
+        var battery = document.createElement('div')
+        battery.classList.add('crumb', 'no-border')
+        battery.innerHTML = '<i class="fas fa-battery-half">&nbsp;</i><span>' + reading.battery + '%</span>'
+        crumbs.push(battery)
+    }
 
+    if(reading.reachable === false) {
+        var unreachable = document.createElement('div')
+        unreachable.classList.add('crumb', 'red')
+        unreachable.innerHTML = '<i class="fas fa-exclamation-triangle">&nbsp;</i><span>Unreachable</span>'
+        crumbs.push(unreachable)
+    }
+
+    return crumbs
+}
+
+function buildStatus(status) {
+    var onoff = document.createElement('div')
+    onoff.classList.add('crumb')
+    if(!status.on) {
+        onoff.innerHTML = '<i class="fas fa-toggle-off">&nbsp;</i><span>Off</span>'
+        onoff.classList.add('red')
+    } else {
+        onoff.innerHTML = '<i class="fas fa-toggle-on">&nbsp;</i><span>' + (status.allOn ? 'On' : 'Partially on') + '</span>'
+        onoff.classList.add('green')
+    }
+
+    var crumbs = [onoff]
+    if(!status.on) {
+        return crumbs
+    }
+
+    if(status.brightness) {
+        var brightness = document.createElement('div')
+        brightness.classList.add('crumb', 'white')
+        brightness.innerHTML = '<i class="fas fa-sun">&nbsp;</i><span>' + Math.round(status.brightness * 100 / 254) + '%</span>'
+        crumbs.push(brightness)
+    }
+
+    if(status.color) {
+        var color = document.createElement('div')
+        color.classList.add('crumb', 'white')
+        color.innerHTML = '<span class="circle" style="background-color:'+ status.color+ '"></span><span>' + status.color.toUpperCase() + '</span>'
+        crumbs.push(color)
+    } else if(status.ct) {
+        var ct = document.createElement('div')
+        ct.classList.add('crumb', 'white')
+        ct.innerHTML = '<i class="fas fa-thermometer-half">&nbsp;</i><span>' + Math.round(10000 / status.ct) * 100 + 'K</span>'
+        crumbs.push(ct)
+    }
+
+    if(status.scene) {
+        var scene = document.createElement('div')
+        scene.classList.add('crumb', 'blue')
+        scene.innerHTML = '<i class="fas fa-toggle-on">&nbsp;</i><span>' + escapeHTML(status.scene) + '</span>'
+        crumbs.push(scene)
+    }
+
+    if(status.reachable === false) {
+        var unreachable = document.createElement('div')
+        unreachable.classList.add('crumb', 'red')
+        unreachable.innerHTML = '<i class="fas fa-exclamation-triangle">&nbsp;</i><span>Unreachable</span>'
+        crumbs.push(unreachable)
+    }
+
+    return crumbs
+}
+
+function formatSchedule(schedule) {
+    if(schedule.at) {
+        return 'at ' + schedule.at
+    }
+
+    // delay is given in nanoseconds
+    var seconds = Math.round(schedule.delay / 1e9)
+    if(seconds % 3600 === 0) {
+        return 'in ' + (seconds / 3600) + 'h'
+    }
+    if(seconds % 60 === 0) {
+        return 'in ' + (seconds / 60) + 'm'
+    }
+    return 'in ' + seconds + 's'
+}
+
+function buildTarget(obj) {
     var lightRoom = document.createElement('div')
 
-    if(obj.light) {
+    if(obj.macro) {
+        lightRoom.classList.add('crumb', 'purple')
+        lightRoom.innerHTML = '<i class="fas fa-scroll"></i>&nbsp;<span>' + escapeHTML(obj.macro.data.name) + '</span>'
+    } else if(obj.light) {
         lightRoom.classList.add('crumb', 'yellow')
-        lightRoom.innerHTML = '<i class="fas fa-lightbulb"></i>&nbsp;<span>' + escapeHTML(obj.light.data.name) + '</span>'
+        lightRoom.innerHTML = '<i class="fas fa-lightbulb"></i>&nbsp;<span>' + escapeHTML(obj.light.data.name) + '</span>' + buildAlias(obj.light.alias)
     } else {
         lightRoom.classList.add('crumb', 'orange')
-        lightRoom.innerHTML = '<i class="fas fa-layer-group"></i>&nbsp;<span>' + escapeHTML(obj.group.data.name) + '</span>'
+        lightRoom.setAttribute('title', obj.group.type)
+        lightRoom.innerHTML = '<i class="fas ' + groupIcon(obj.group.type) + '"></i>&nbsp;<span>' + escapeHTML(obj.group.data.name) + '</span>' + buildAlias(obj.group.alias)
+    }
+
+    return lightRoom
+}
+
+// buildBridge returns a crumb showing the name of a bridge
+function buildBridge(bridge) {
+    var crumb = document.createElement('div')
+    crumb.classList.add('crumb', 'no-border')
+    crumb.setAttribute('title', 'Bridge')
+    crumb.innerHTML = '<i class="fas fa-server"></i>&nbsp;<span>' + escapeHTML(bridge) + '</span>'
+    return crumb
+}
+
+// buildAlias returns html indicating that a name was matched using an alias
+function buildAlias(alias) {
+    if(!alias) {
+        return ''
+    }
+    return '&nbsp;<i class="fas fa-tag" title="Matched alias"></i>&nbsp;<span>' + escapeHTML(alias) + '</span>'
+}
+
+function groupIcon(type) {
+    switch(type) {
+        case 'Zone':
+            return 'fa-map'
+        case 'Entertainment':
+            return 'fa-tv'
+        case 'LightGroup':
+            return 'fa-object-group'
+        case 'All':
+            return 'fa-home'
+        default:
+            return 'fa-layer-group'
     }
+}
 
+function buildChange(obj) {
     var toggleOrScene = document.createElement('div')
     toggleOrScene.classList.add('crumb')
-    if(obj.onoff) {
+    if(obj.macro) {
+        toggleOrScene.innerHTML = '<i class="fas fa-play">&nbsp;</i><span>Run</span>'
+        toggleOrScene.classList.add('green')
+    } else if(obj.onoff) {
         if(obj.onoff === 'off') {
             toggleOrScene.innerHTML = '<i class="fas fa-toggle-off">&nbsp;</i><span>Off</span></div>'
             toggleOrScene.classList.add('red')
+        } else if(obj.onoff === 'toggle') {
+            toggleOrScene.innerHTML = '<i class="fas fa-exchange-alt">&nbsp;</i><span>Toggle</span>'
+            toggleOrScene.classList.add('purple')
         } else {
             toggleOrScene.innerHTML = '<i class="fas fa-toggle-on">&nbsp;</i><span>On</span>'
             toggleOrScene.classList.add('green')
@@ -253,28 +561,21 @@ function buildResult(obj) {
     } else if(obj.color) {
         toggleOrScene.innerHTML = '<i class="fas fa-toggle-on" style="color:'+ obj.color+ '">&nbsp;</i><span class="circle" style="background-color:'+ obj.color+ '"></span><span>' + obj.color.toUpperCase() + '</span>'
         toggleOrScene.classList.add('white')
+    } else if(obj.ct) {
+        toggleOrScene.innerHTML = '<i class="fas fa-thermometer-half">&nbsp;</i><span>' + Math.round(10000 / obj.ct) * 100 + 'K</span>'
+        toggleOrScene.classList.add('white')
+    } else if(obj.effect) {
+        toggleOrScene.innerHTML = '<i class="fas fa-magic">&nbsp;</i><span>' + (obj.effect === 'stop' ? 'Stop effects' : escapeHTML(obj.effect)) + '</span>'
+        toggleOrScene.classList.add('purple')
+    } else if(obj.brightness) {
+        toggleOrScene.innerHTML = '<i class="fas fa-sun">&nbsp;</i><span>' + Math.round(obj.brightness * 100 / 254) + '%</span>'
+        toggleOrScene.classList.add('white')
     } else {
-        toggleOrScene.innerHTML = '<i class="fas fa-toggle-on">&nbsp;</i><span>' + escapeHTML(obj.scene.data.name) + '</span>'
+        toggleOrScene.innerHTML = '<i class="fas fa-toggle-on">&nbsp;</i><span>' + escapeHTML(obj.scene.data.name) + '</span>' + buildAlias(obj.scene.alias)
         toggleOrScene.classList.add('blue')
     }
 
-    var arrow = document.createElement('div')
-    arrow.innerHTML = '<i class="fas fa-arrow-right"></i>'
-    arrow.classList.add('crumb', 'no-border')
-
-
-    result.append(lightRoom, arrow, toggleOrScene)
-
-    // For debug
-    if(obj.debug) {
-        var debug = document.createElement('div')
-        debug.classList.add('crumb')
-        debug.innerHTML = JSON.stringify(obj.debug)
-
-        result.append(debug)
-    }
-
-    return result
+    return toggleOrScene
 }
 
 function runSelected() {
@@ -291,6 +592,12 @@ function runSelected() {
 var actionsRun = 0;
 
 function runAction(action) {
+    // informational results can not be run
+    var parsed = JSON.parse(action)
+    if(parsed.sensor || parsed.status) {
+        return Promise.resolve({ok: false, readOnly: true})
+    }
+
     if(++actionsRun === 3) {
         var storage = window.localStorage
         if(storage) {
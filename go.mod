@@ -12,11 +12,11 @@ require (
 	github.com/rs/zerolog v1.26.0
 	github.com/webview/webview v0.0.0-20210330151455-f540d88dde4e
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	golang.org/x/text v0.3.8
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/stretchr/testify v1.5.1 // indirect
-	golang.org/x/text v0.3.8 // indirect
 	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/tkw1536/huelio/engine"
+)
+
+func Test_result_MarshalJSON(t *testing.T) {
+	actions := []engine.Action{{OnOff: engine.BoolOff}}
+
+	// results are always an array; staleness is only reported in headers
+	tests := []struct {
+		name   string
+		result result
+		want   string
+	}{
+		{"empty", result{}, `[]`},
+		{"actions", result{Results: actions}, `[{"onoff":"off"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.result)
+			if err != nil {
+				t.Fatalf("MarshalJSON() err = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("MarshalJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -15,12 +16,12 @@ import (
 type Server struct {
 	Ctx context.Context
 
-	RefreshInterval time.Duration // how often should the index be refreshed
-
 	DebugData bool // should we marshal out extra debug info (like scores, errors, etc)?
 
 	CORSDomains string // should we include cors headers on every API response?
 
+	AliasesPath string // file to save edited aliases to, if any
+
 	Engine *engine.Engine
 }
 
@@ -38,26 +39,20 @@ func (server *Server) Start() {
 		serverLogger.Info().Msg("exiting server background tasks")
 	}()
 
+	// indexes are refreshed by the engine, each bridge on its own schedule
 	go server.Engine.Link()
+	go server.Engine.RunScheduler()
 
-	var c <-chan time.Time
-	if server.RefreshInterval > 0 {
-		ticker := time.NewTicker(server.RefreshInterval)
-		defer ticker.Stop()
-
-		c = ticker.C
-	}
-
-	for {
-		select {
-		case <-c:
-			server.Engine.RefreshIndex()
-		case <-server.Ctx.Done():
-			return
-		}
-	}
+	<-server.Ctx.Done()
 }
 
+// StaleHeader is set on query responses when results come from a cached index that has not been refreshed yet.
+// UpdatedHeader then holds the time the cached index was fetched from the bridge.
+const (
+	StaleHeader   = "X-Huelio-Stale"
+	UpdatedHeader = "X-Huelio-Updated"
+)
+
 type jsonMessage struct {
 	Message string `json:"message"`
 }
@@ -87,12 +82,25 @@ func (server *Server) serveQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, matches, scores, err := server.Engine.Query(strings.Join(the_query, " "))
+	// locales are given explicitly, or taken from the browser
+	lang := query.Get("lang")
+	if lang == "" {
+		lang = r.Header.Get("Accept-Language")
+	}
+
+	res, matches, scores, err := server.Engine.Query(strings.Join(the_query, " "), engine.ParseLocales(lang))
 	if err != nil {
 		server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: err.Error()})
 		return
 	}
 
+	// results from a cached index may be outdated
+	if stale, updated := server.Engine.IndexStatus(); stale {
+		h := w.Header()
+		h.Set(StaleHeader, "true")
+		h.Set(UpdatedHeader, updated.Format(time.RFC3339))
+	}
+
 	server.writeJSON(w, http.StatusOK, result{
 		Results: res,
 
@@ -121,6 +129,291 @@ func (server *Server) doAction(w http.ResponseWriter, r *http.Request) error {
 
 }
 
+// ServeUndo responds to a request to undo the most recent action
+func (server *Server) ServeUndo(w http.ResponseWriter, r *http.Request) {
+	serverLogger := server.logger()
+
+	serverLogger.Info().Str("method", r.Method).Stringer("url", r.URL).Msg("request")
+	switch r.Method {
+	case http.MethodOptions:
+		server.writeJSON(w, http.StatusOK, jsonMessage{Message: "this is fine"})
+	case http.MethodPost:
+		if err := server.Engine.Undo(); err != nil {
+			server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: err.Error()})
+			return
+		}
+		server.writeJSON(w, http.StatusOK, jsonMessage{Message: "Success"})
+	default:
+		server.writeJSON(w, http.StatusMethodNotAllowed, jsonMessage{Message: "method allowed"})
+	}
+}
+
+// ServeJobs lists pending jobs, or cancels the job given by the 'id' url parameter
+func (server *Server) ServeJobs(w http.ResponseWriter, r *http.Request) {
+	serverLogger := server.logger()
+
+	serverLogger.Info().Str("method", r.Method).Stringer("url", r.URL).Msg("request")
+
+	if server.Engine.Scheduler == nil {
+		server.writeJSON(w, http.StatusNotFound, jsonMessage{Message: engine.ErrEngineNoScheduler.Error()})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		server.writeJSON(w, http.StatusOK, jsonMessage{Message: "this is fine"})
+	case http.MethodGet:
+		jobs, err := server.Engine.Scheduler.Jobs()
+		if err != nil {
+			server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: err.Error()})
+			return
+		}
+		if jobs == nil {
+			jobs = []engine.Job{}
+		}
+		server.writeJSON(w, http.StatusOK, jobs)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			server.writeJSON(w, http.StatusBadRequest, jsonMessage{Message: "missing 'id' url parameter"})
+			return
+		}
+
+		err := server.Engine.Scheduler.Cancel(id)
+		switch {
+		case errors.Is(err, engine.ErrSchedulerUnknownJob):
+			server.writeJSON(w, http.StatusNotFound, jsonMessage{Message: err.Error()})
+		case err != nil:
+			server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: err.Error()})
+		default:
+			server.writeJSON(w, http.StatusOK, jsonMessage{Message: "Success"})
+		}
+	default:
+		server.writeJSON(w, http.StatusMethodNotAllowed, jsonMessage{Message: "method allowed"})
+	}
+}
+
+// ServeState serves the current state of every group, light and sensor.
+func (server *Server) ServeState(w http.ResponseWriter, r *http.Request) {
+	serverLogger := server.logger()
+
+	serverLogger.Info().Str("method", r.Method).Stringer("url", r.URL).Msg("request")
+
+	switch r.Method {
+	case http.MethodOptions:
+		server.writeJSON(w, http.StatusOK, jsonMessage{Message: "this is fine"})
+	case http.MethodGet:
+		state, err := server.Engine.State()
+		switch {
+		case errors.Is(err, engine.ErrEngineMissingBridge):
+			server.writeJSON(w, http.StatusServiceUnavailable, jsonMessage{Message: err.Error()})
+		case err != nil:
+			server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: err.Error()})
+		default:
+			server.writeJSON(w, http.StatusOK, state)
+		}
+	default:
+		server.writeJSON(w, http.StatusMethodNotAllowed, jsonMessage{Message: "method allowed"})
+	}
+}
+
+// ServeEvents streams the events of the engine to the client using server-sent events.
+// Each event is sent as a json object, with the kind of event as the event type.
+//
+// When the client does not keep up with the events of the engine, it misses events.
+// It is then sent a resync event, upon which it should fetch the state again.
+func (server *Server) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	serverLogger := server.logger()
+
+	serverLogger.Info().Str("method", r.Method).Stringer("url", r.URL).Msg("request")
+
+	switch r.Method {
+	case http.MethodOptions:
+		server.writeJSON(w, http.StatusOK, jsonMessage{Message: "this is fine"})
+		return
+	case http.MethodGet:
+	default:
+		server.writeJSON(w, http.StatusMethodNotAllowed, jsonMessage{Message: "method allowed"})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: "streaming not supported"})
+		return
+	}
+
+	events, cancel := server.Engine.Subscribe()
+	defer func() { cancel() }()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	if server.CORSDomains != "" {
+		h.Add("Access-Control-Allow-Origin", server.CORSDomains)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// tell the client about the current state of the engine
+	linked := len(server.Engine.Bridges()) > 0
+	server.writeEvent(w, engine.Event{Kind: engine.EventLink, Time: time.Now(), Linked: &linked})
+	flusher.Flush()
+
+	keepalive := time.NewTicker(EventsKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				// the client did not keep up and missed events, so it has to fetch the state again
+				serverLogger.Warn().Msg("event stream too slow, resyncing")
+
+				cancel()
+				events, cancel = server.Engine.Subscribe()
+
+				linked := len(server.Engine.Bridges()) > 0
+				server.writeEvent(w, engine.Event{Kind: engine.EventResync, Time: time.Now()})
+				server.writeEvent(w, engine.Event{Kind: engine.EventLink, Time: time.Now(), Linked: &linked})
+				break
+			}
+			server.writeEvent(w, event)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-server.Ctx.Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// EventsKeepalive is the interval in which comments are sent to clients of the event stream, to keep the connection open
+const EventsKeepalive = 30 * time.Second
+
+// writeEvent writes a single server-sent event
+func (server *Server) writeEvent(w http.ResponseWriter, event engine.Event) {
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		serverLogger := server.logger()
+		serverLogger.Error().Err(err).Msg("unable to marshal event")
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, bytes)
+}
+
+// ServeUsage serves usage statistics, and resets them upon a DELETE request
+func (server *Server) ServeUsage(w http.ResponseWriter, r *http.Request) {
+	serverLogger := server.logger()
+
+	serverLogger.Info().Str("method", r.Method).Stringer("url", r.URL).Msg("request")
+
+	usage := server.Engine.Usage
+	if usage == nil {
+		server.writeJSON(w, http.StatusNotFound, jsonMessage{Message: "learning is disabled"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		server.writeJSON(w, http.StatusOK, jsonMessage{Message: "this is fine"})
+	case http.MethodGet:
+		stats, err := usage.Usage()
+		if err != nil {
+			server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: err.Error()})
+			return
+		}
+		server.writeJSON(w, http.StatusOK, stats)
+	case http.MethodDelete:
+		if err := usage.Reset(); err != nil {
+			server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: err.Error()})
+			return
+		}
+		server.writeJSON(w, http.StatusOK, jsonMessage{Message: "Success"})
+	default:
+		server.writeJSON(w, http.StatusMethodNotAllowed, jsonMessage{Message: "method allowed"})
+	}
+}
+
+// ServeAliases serves and edits the aliases of groups, lights and scenes.
+//
+// A PUT request either replaces all aliases, or when the 'kind' and 'id' url parameters are given, the aliases of a single object.
+func (server *Server) ServeAliases(w http.ResponseWriter, r *http.Request) {
+	serverLogger := server.logger()
+
+	serverLogger.Info().Str("method", r.Method).Stringer("url", r.URL).Msg("request")
+
+	switch r.Method {
+	case http.MethodOptions:
+		server.writeJSON(w, http.StatusOK, jsonMessage{Message: "this is fine"})
+	case http.MethodGet:
+		server.writeJSON(w, http.StatusOK, server.Engine.Aliases())
+	case http.MethodPut:
+		update, err := server.readAliases(r)
+		if err != nil {
+			server.writeJSON(w, http.StatusBadRequest, jsonMessage{Message: err.Error()})
+			return
+		}
+
+		// saving happens while the engine is locked, so that concurrent edits are written in the same order they are applied.
+		aliases, err := server.Engine.UpdateAliases(func(aliases engine.Aliases) (engine.Aliases, error) {
+			aliases, err := update(aliases)
+			if err != nil {
+				return aliases, err
+			}
+			if server.AliasesPath != "" {
+				if err := engine.SaveAliases(server.AliasesPath, aliases); err != nil {
+					return aliases, err
+				}
+			}
+			return aliases, nil
+		})
+
+		switch {
+		case errors.Is(err, engine.ErrAliasInvalidKind):
+			server.writeJSON(w, http.StatusBadRequest, jsonMessage{Message: err.Error()})
+			return
+		case err != nil:
+			server.writeJSON(w, http.StatusInternalServerError, jsonMessage{Message: err.Error()})
+			return
+		}
+
+		server.writeJSON(w, http.StatusOK, aliases)
+	default:
+		server.writeJSON(w, http.StatusMethodNotAllowed, jsonMessage{Message: "method allowed"})
+	}
+}
+
+// readAliases reads a PUT request editing aliases.
+// It returns a function that applies the edit to the current aliases.
+func (server *Server) readAliases(r *http.Request) (func(engine.Aliases) (engine.Aliases, error), error) {
+	query := r.URL.Query()
+	kind, id := query.Get("kind"), query.Get("id")
+
+	if kind == "" && id == "" {
+		var aliases engine.Aliases
+		if err := json.NewDecoder(r.Body).Decode(&aliases); err != nil {
+			return nil, errors.Wrap(err, "Unable to parse body")
+		}
+		return func(engine.Aliases) (engine.Aliases, error) {
+			return aliases, nil
+		}, nil
+	}
+
+	if id == "" {
+		return nil, errors.New("missing 'id' url parameter")
+	}
+
+	var names []string
+	if err := json.NewDecoder(r.Body).Decode(&names); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse body")
+	}
+	return func(aliases engine.Aliases) (engine.Aliases, error) {
+		return aliases.With(engine.AliasKind(kind), id, names)
+	}, nil
+}
+
 func (server *Server) writeJSON(w http.ResponseWriter, statusCode int, content interface{}) {
 	serverLogger := server.logger()
 	serverLogger.Info().Int("status", statusCode).Msg("response")
@@ -135,8 +428,9 @@ func (server *Server) writeJSON(w http.ResponseWriter, statusCode int, content i
 	h.Add("Content-Type", "application/json")
 	if server.CORSDomains != "" {
 		h.Add("Access-Control-Allow-Origin", server.CORSDomains)
-		h.Add("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
+		h.Add("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE,OPTIONS")
 		h.Add("Access-Control-Allow-Headers", "*")
+		h.Add("Access-Control-Expose-Headers", StaleHeader+","+UpdatedHeader)
 	}
 	w.WriteHeader(statusCode)
 
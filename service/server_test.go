@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tkw1536/huelio/engine"
+)
+
+// slowWriter is a ResponseWriter that stops accepting writes after the first flush, until it is released
+type slowWriter struct {
+	header http.Header
+
+	flushOnce sync.Once
+	flushed   chan struct{} // closed upon the first flush
+	release   chan struct{} // writes after the first flush wait until release is closed
+
+	l   sync.Mutex
+	buf bytes.Buffer
+}
+
+func newSlowWriter() *slowWriter {
+	return &slowWriter{
+		header:  make(http.Header),
+		flushed: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func (w *slowWriter) Header() http.Header { return w.header }
+func (w *slowWriter) WriteHeader(int)     {}
+
+func (w *slowWriter) Write(data []byte) (int, error) {
+	select {
+	case <-w.flushed:
+		<-w.release
+	default:
+	}
+
+	w.l.Lock()
+	defer w.l.Unlock()
+	return w.buf.Write(data)
+}
+
+func (w *slowWriter) Flush() {
+	w.flushOnce.Do(func() { close(w.flushed) })
+}
+
+func (w *slowWriter) String() string {
+	w.l.Lock()
+	defer w.l.Unlock()
+	return w.buf.String()
+}
+
+func TestServer_ServeEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := engine.NewEngine(engine.NewMemoryBridge("memory", nil, nil, nil, nil), ctx)
+	if err := e.RefreshIndex(); err != nil {
+		t.Fatalf("RefreshIndex() err = %v", err)
+	}
+	server := &Server{Ctx: ctx, Engine: e}
+
+	w := newSlowWriter()
+	r := httptest.NewRequest(http.MethodGet, "/api/events", nil).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ServeEvents(w, r)
+	}()
+
+	// the client is stuck while events keep being published
+	<-w.flushed
+	for i := 0; i < 100; i++ {
+		e.RefreshIndex()
+	}
+	close(w.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(w.String(), "event: "+string(engine.EventResync)+"\n") {
+		if time.Now().After(deadline) {
+			t.Fatalf("ServeEvents() did not send a resync event, got %q", w.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// events are delivered again after resyncing
+	e.RefreshIndex()
+	resync := strings.Index(w.String(), "event: "+string(engine.EventResync)+"\n")
+	for !strings.Contains(w.String()[resync:], "event: "+string(engine.EventIndex)+"\n") {
+		if time.Now().After(deadline) {
+			t.Fatalf("ServeEvents() did not send events after resyncing, got %q", w.String()[resync:])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
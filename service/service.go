@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -28,15 +29,39 @@ type ServiceConfig struct {
 
 	CredsPath string
 
+	MacrosPath  string
+	AliasesPath string
+
+	GroupTypes []engine.GroupType
+
+	Learn bool
+
 	HueHost        string
 	HueUsername    string
 	HueNewUsername string
+
+	Clip bool // use version 2 of the hue api
 }
 
 func (s *ServiceConfig) logger() zerolog.Logger {
 	return zerolog.Ctx(s.Ctx).With().Str("component", "service.Service").Logger()
 }
 
+// JobsFilename is the name of the file scheduled jobs are stored in.
+// It is placed in the same directory as the credentials store.
+const JobsFilename = "huelio-jobs.json"
+
+// UsageFilename is the name of the file usage statistics are stored in.
+// It is placed in the same directory as the credentials store.
+const UsageFilename = "huelio-usage.json"
+
+// IndexFilename is the name of the file the index is cached in.
+// It is placed in the same directory as the credentials store.
+const IndexFilename = "huelio-index.json"
+
+// MacrosReloadInterval is the interval in which the macros and aliases files are checked for changes
+const MacrosReloadInterval = 5 * time.Second
+
 // DefaultConfig returns a new default config
 func DefaultConfig() ServiceConfig {
 	return ServiceConfig{
@@ -48,6 +73,10 @@ func DefaultConfig() ServiceConfig {
 
 		CacheRefresh: 1 * time.Minute,
 
+		GroupTypes: engine.DefaultGroupTypes,
+
+		Learn: true,
+
 		HueHost:        os.Getenv("HUE_HOST"),
 		HueUsername:    os.Getenv("HUE_USER"),
 		HueNewUsername: fmt.Sprintf("hueliod-%d", time.Now().UnixMilli()),
@@ -67,10 +96,40 @@ func (s *ServiceConfig) AddFlagsTo(flagset *flag.FlagSet) {
 
 	flagset.DurationVar(&s.CacheRefresh, "refresh", s.CacheRefresh, "time to automatically refresh credentials on")
 
-	flagset.StringVar(&s.CredsPath, "store", s.CredsPath, "Path to read/write credentials from. When omitted, stores credentials in memory only. ")
-	flagset.StringVar(&s.HueHost, "host", s.HueHost, "Host to use for connection to Hue Bridge. Can also be given via HUE_HOST environment variable. ")
-	flagset.StringVar(&s.HueUsername, "user", s.HueUsername, "Username to use for connection to Hue Bridge. Can also be given via HUE_USER envionment variable. ")
+	flagset.StringVar(&s.CredsPath, "store", s.CredsPath, "Path to read/write credentials from. Scheduled jobs, usage statistics and a cache of the index are stored in the same directory. When omitted, stores credentials, jobs and usage statistics in memory only. ")
+	flagset.BoolVar(&s.Learn, "learn", s.Learn, "Learn from performed actions, and rank frequently used actions higher")
+	flagset.StringVar(&s.MacrosPath, "macros", s.MacrosPath, "Path to a JSON file to read user-defined macros from. Reloaded automatically when it changes. ")
+	flagset.StringVar(&s.AliasesPath, "aliases", s.AliasesPath, "Path to a JSON file to read aliases of groups, lights and scenes from. Reloaded automatically when it changes, and updated when aliases are edited. ")
+	flagset.Func("groups", "Comma-separated types of groups to search, out of Room, Zone, LightGroup, Entertainment and Other. Defaults to "+engine.FormatGroupTypes(s.GroupTypes)+". ", func(value string) (err error) {
+		s.GroupTypes, err = engine.ParseGroupTypes(value)
+		return
+	})
+	flagset.StringVar(&s.HueHost, "host", s.HueHost, "Host to use for connection to Hue Bridge. Use a comma-separated list to connect to several bridges. Can also be given via HUE_HOST environment variable. ")
+	flagset.StringVar(&s.HueUsername, "user", s.HueUsername, "Username to use for connection to Hue Bridge. Use a comma-separated list matching the hosts for several bridges. Can also be given via HUE_USER envionment variable. ")
 	flagset.StringVar(&s.HueNewUsername, "new-user", s.HueNewUsername, "Username to use when generating new username for hue bridge. Dynamically determined based on current time. ")
+	flagset.BoolVar(&s.Clip, "clip", s.Clip, "Use version 2 of the hue api (CLIP v2) via https, and update the index as soon as lights change. ")
+}
+
+// finders returns a finder for each of the configured hosts.
+// HueHost and HueUsername may hold comma-separated lists, in which case the n-th username belongs to the n-th host.
+// When no host is configured, returns a single finder that discovers a bridge.
+func (s ServiceConfig) finders() []creds.Finder {
+	hosts := strings.Split(s.HueHost, ",")
+	users := strings.Split(s.HueUsername, ",")
+
+	finders := make([]creds.Finder, len(hosts))
+	for i, host := range hosts {
+		finders[i] = creds.Finder{
+			Ctx:     s.Ctx,
+			NewName: s.HueNewUsername,
+
+			Hostname: strings.TrimSpace(host),
+		}
+		if i < len(users) {
+			finders[i].Username = strings.TrimSpace(users[i])
+		}
+	}
+	return finders
 }
 
 // Main Starts the service and returns when it is finished
@@ -78,29 +137,45 @@ func (s ServiceConfig) Main(listener net.Listener) {
 	serviceLogger := s.logger()
 	// create a manager and a store
 	manager := &creds.Manager{
-		Ctx:   s.Ctx,
-		Store: &creds.InMemoryStore{},
-		Finder: creds.Finder{
-			Ctx:     s.Ctx,
-			NewName: s.HueNewUsername,
-
-			Username: s.HueUsername,
-			Hostname: s.HueHost,
-		},
+		Ctx:     s.Ctx,
+		Store:   &creds.InMemoryStore{},
+		Finders: s.finders(),
+	}
+	if s.Clip {
+		manager.Connector = creds.NewClipBridge
+	}
+	// jobs, usage and the index cache are stored next to the credentials
+	scheduler := &engine.Scheduler{}
+	var indexStore engine.IndexStore
+	var usage *engine.UsageStats
+	if s.Learn {
+		usage = &engine.UsageStats{}
 	}
 	if s.CredsPath != "" {
 		manager.Store = creds.JSONFileStore(s.CredsPath)
+		scheduler.Store = engine.JSONFileJobStore(filepath.Join(filepath.Dir(s.CredsPath), JobsFilename))
+		indexStore = engine.JSONFileIndexStore(filepath.Join(filepath.Dir(s.CredsPath), IndexFilename))
+		if usage != nil {
+			usage.Store = engine.JSONFileUsageStore(filepath.Join(filepath.Dir(s.CredsPath), UsageFilename))
+		}
 	}
 
 	server := &Server{
 		Ctx: s.Ctx,
 
 		Engine: &engine.Engine{
-			Ctx:     s.Ctx,
-			Connect: manager.Connect,
+			Ctx:       s.Ctx,
+			Connect:   manager.Connect,
+			Scheduler: scheduler,
+			Usage:     usage,
+
+			RefreshInterval: s.CacheRefresh,
+			IndexStore:      indexStore,
+
+			GroupTypes: s.GroupTypes,
 		},
 
-		RefreshInterval: s.CacheRefresh,
+		AliasesPath: s.AliasesPath,
 
 		DebugData: s.Debug,
 	}
@@ -110,8 +185,21 @@ func (s ServiceConfig) Main(listener net.Listener) {
 
 	go server.Start()
 
+	if s.MacrosPath != "" {
+		go engine.WatchMacros(s.Ctx, s.MacrosPath, MacrosReloadInterval, server.Engine.SetMacros)
+	}
+	if s.AliasesPath != "" {
+		go engine.WatchAliases(s.Ctx, s.AliasesPath, MacrosReloadInterval, server.Engine.SetAliases)
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle("/api/", server)
+	mux.HandleFunc("/api/undo", server.ServeUndo)
+	mux.HandleFunc("/api/jobs", server.ServeJobs)
+	mux.HandleFunc("/api/state", server.ServeState)
+	mux.HandleFunc("/api/events", server.ServeEvents)
+	mux.HandleFunc("/api/aliases", server.ServeAliases)
+	mux.HandleFunc("/api/usage", server.ServeUsage)
 
 	if !s.Debug {
 		mux.Handle("/", frontend.StaticHandler)
@@ -140,4 +228,11 @@ func (s ServiceConfig) Main(listener net.Listener) {
 	}()
 
 	<-errChan
+
+	// save usage that is still pending
+	if usage != nil {
+		if err := usage.Flush(); err != nil {
+			serviceLogger.Error().Err(err).Msg("unable to save usage")
+		}
+	}
 }